@@ -0,0 +1,176 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// FieldManager is the field manager of the objects applied by kf
+	FieldManager = "kubeform-cli"
+
+	DryRunNone   = "none"
+	DryRunClient = "client"
+	DryRunServer = "server"
+)
+
+// conflictManagerRegex matches the manager in the message of a field manager conflict, e.g.
+// conflict with "kubectl-client-side-apply" using v1: .data.token
+var conflictManagerRegex = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+// applyConflict is a field owned by another field manager
+type applyConflict struct {
+	Field   string
+	Manager string
+}
+
+// applyConflictError is returned when the applied object conflicts with the fields owned by
+// other field managers
+type applyConflictError struct {
+	Kind      string
+	Name      string
+	Conflicts []applyConflict
+}
+
+func (e *applyConflictError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "applying %s %s conflicts with the fields managed by others:", e.Kind, e.Name)
+	for _, c := range e.Conflicts {
+		fmt.Fprintf(&sb, "\n  - %s, managed by %q", c.Field, c.Manager)
+	}
+	sb.WriteString("\nuse --force-conflicts to take over the fields")
+	return sb.String()
+}
+
+// applier applies the generated manifests with server-side apply
+type applier struct {
+	out            io.Writer
+	client         dynamic.Interface
+	mapper         meta.RESTMapper
+	dryRun         string
+	forceConflicts bool
+}
+
+// apply applies the objects, given as yaml, in order
+func (a *applier) apply(manifests ...[]byte) error {
+	for _, manifest := range manifests {
+		obj := &unstructured.Unstructured{}
+		data, err := yaml.YAMLToJSON(manifest)
+		if err != nil {
+			return err
+		}
+		if err := obj.UnmarshalJSON(data); err != nil {
+			return err
+		}
+
+		if err := a.applyObject(obj, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *applier) applyObject(obj *unstructured.Unstructured, data []byte) error {
+	gvk := obj.GroupVersionKind()
+	name := strings.ToLower(gvk.GroupKind().String()) + "/" + obj.GetName()
+
+	if a.dryRun == DryRunClient {
+		fmt.Fprintf(a.out, "%s applied (dry run)\n", name)
+		return nil
+	}
+
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("failed to find the resource of %s, is its CRD installed? %v", gvk, err)
+	}
+
+	var ri dynamic.ResourceInterface = a.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		ri = a.client.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	}
+
+	opts := metav1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &a.forceConflicts,
+	}
+	if a.dryRun == DryRunServer {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	_, err = ri.Patch(context.TODO(), obj.GetName(), types.ApplyPatchType, data, opts)
+	if err != nil {
+		if conflicts := applyConflicts(err); len(conflicts) > 0 {
+			return &applyConflictError{
+				Kind:      gvk.Kind,
+				Name:      obj.GetName(),
+				Conflicts: conflicts,
+			}
+		}
+		return fmt.Errorf("failed to apply %s: %v", name, err)
+	}
+
+	if a.dryRun == DryRunServer {
+		fmt.Fprintf(a.out, "%s applied (server dry run)\n", name)
+	} else {
+		fmt.Fprintf(a.out, "%s applied\n", name)
+	}
+
+	return nil
+}
+
+// applyConflicts returns the field manager conflicts of the failed apply, if any
+func applyConflicts(err error) []applyConflict {
+	if !kerr.IsConflict(err) {
+		return nil
+	}
+	status, ok := err.(kerr.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return nil
+	}
+
+	var conflicts []applyConflict
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+
+		c := applyConflict{
+			Field:   cause.Field,
+			Manager: cause.Message,
+		}
+		if m := conflictManagerRegex.FindStringSubmatch(cause.Message); m != nil {
+			c.Manager = m[1]
+		}
+		conflicts = append(conflicts, c)
+	}
+
+	return conflicts
+}
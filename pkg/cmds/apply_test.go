@@ -0,0 +1,229 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	testSecretManifest = `apiVersion: v1
+kind: Secret
+metadata:
+  name: vpc-git-cred
+  namespace: default
+data:
+  token: dG9rZW4=
+`
+	testModuleDefinitionManifest = `apiVersion: tf.kubeform.com/v1alpha1
+kind: ModuleDefinition
+metadata:
+  name: vpc
+`
+)
+
+// applyRequest is a server-side apply request received by the stand-in api server
+type applyRequest struct {
+	Path         string
+	FieldManager string
+	Force        string
+	DryRun       string
+}
+
+// applyTestServer is a stand-in api server answering server-side apply requests. The
+// patches of the objects named in conflicts fail with a field manager conflict.
+func applyTestServer(t *testing.T, conflicts map[string]*metav1.Status) (*httptest.Server, *[]applyRequest) {
+	t.Helper()
+
+	var requests []applyRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.Header.Get("Content-Type") != string(types.ApplyPatchType) {
+			t.Errorf("unexpected %s request of %s with content type %s", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		q := r.URL.Query()
+		requests = append(requests, applyRequest{
+			Path:         r.URL.Path,
+			FieldManager: q.Get("fieldManager"),
+			Force:        q.Get("force"),
+			DryRun:       q.Get("dryRun"),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if status, found := conflicts[name]; found {
+			w.WriteHeader(int(status.Code))
+			_ = json.NewEncoder(w).Encode(status)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func testApplier(t *testing.T, server *httptest.Server, out io.Writer, dryRun string, forceConflicts bool) *applier {
+	t.Helper()
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(v1alpha1.GroupVersion.WithKind("ModuleDefinition"), meta.RESTScopeRoot)
+
+	return &applier{
+		out:            out,
+		client:         client,
+		mapper:         mapper,
+		dryRun:         dryRun,
+		forceConflicts: forceConflicts,
+	}
+}
+
+func TestApplier(t *testing.T) {
+	cases := []struct {
+		name     string
+		dryRun   string
+		force    bool
+		out      string
+		requests []applyRequest
+	}{
+		{
+			name:   "apply",
+			dryRun: DryRunNone,
+			out:    "secret/vpc-git-cred applied\nmoduledefinition.tf.kubeform.com/vpc applied\n",
+			requests: []applyRequest{
+				{Path: "/api/v1/namespaces/default/secrets/vpc-git-cred", FieldManager: FieldManager, Force: "false"},
+				{Path: "/apis/tf.kubeform.com/v1alpha1/moduledefinitions/vpc", FieldManager: FieldManager, Force: "false"},
+			},
+		},
+		{
+			name:   "force conflicts",
+			dryRun: DryRunNone,
+			force:  true,
+			out:    "secret/vpc-git-cred applied\nmoduledefinition.tf.kubeform.com/vpc applied\n",
+			requests: []applyRequest{
+				{Path: "/api/v1/namespaces/default/secrets/vpc-git-cred", FieldManager: FieldManager, Force: "true"},
+				{Path: "/apis/tf.kubeform.com/v1alpha1/moduledefinitions/vpc", FieldManager: FieldManager, Force: "true"},
+			},
+		},
+		{
+			name:   "server dry run",
+			dryRun: DryRunServer,
+			out:    "secret/vpc-git-cred applied (server dry run)\nmoduledefinition.tf.kubeform.com/vpc applied (server dry run)\n",
+			requests: []applyRequest{
+				{Path: "/api/v1/namespaces/default/secrets/vpc-git-cred", FieldManager: FieldManager, Force: "false", DryRun: metav1.DryRunAll},
+				{Path: "/apis/tf.kubeform.com/v1alpha1/moduledefinitions/vpc", FieldManager: FieldManager, Force: "false", DryRun: metav1.DryRunAll},
+			},
+		},
+		{
+			name:   "client dry run",
+			dryRun: DryRunClient,
+			out:    "secret/vpc-git-cred applied (dry run)\nmoduledefinition.tf.kubeform.com/vpc applied (dry run)\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server, requests := applyTestServer(t, nil)
+			var out bytes.Buffer
+			a := testApplier(t, server, &out, c.dryRun, c.force)
+
+			if err := a.apply([]byte(testSecretManifest), []byte(testModuleDefinitionManifest)); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != c.out {
+				t.Errorf("expected output %q, got %q", c.out, out.String())
+			}
+			if !reflect.DeepEqual(*requests, c.requests) {
+				t.Errorf("expected requests %+v, got %+v", c.requests, *requests)
+			}
+		})
+	}
+}
+
+func TestApplierConflicts(t *testing.T) {
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Reason:   metav1.StatusReasonConflict,
+		Code:     http.StatusConflict,
+		Message:  "Apply failed with 2 conflicts",
+		Details: &metav1.StatusDetails{
+			Causes: []metav1.StatusCause{
+				{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl-client-side-apply" using v1`, Field: ".data.token"},
+				{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "helm"`, Field: ".metadata.labels.app"},
+				{Type: metav1.CauseTypeFieldValueInvalid, Message: "not a conflict", Field: ".data"},
+			},
+		},
+	}
+	server, requests := applyTestServer(t, map[string]*metav1.Status{"vpc-git-cred": status})
+
+	var out bytes.Buffer
+	err := testApplier(t, server, &out, DryRunNone, false).apply([]byte(testSecretManifest), []byte(testModuleDefinitionManifest))
+	conflictErr, ok := err.(*applyConflictError)
+	if !ok {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+
+	want := []applyConflict{
+		{Field: ".data.token", Manager: "kubectl-client-side-apply"},
+		{Field: ".metadata.labels.app", Manager: "helm"},
+	}
+	if conflictErr.Kind != "Secret" || conflictErr.Name != "vpc-git-cred" || !reflect.DeepEqual(conflictErr.Conflicts, want) {
+		t.Errorf("unexpected conflict error %+v", conflictErr)
+	}
+	if msg := err.Error(); !strings.Contains(msg, `.data.token, managed by "kubectl-client-side-apply"`) || !strings.Contains(msg, "--force-conflicts") {
+		t.Errorf("unexpected error message %q", msg)
+	}
+
+	// the objects after the failed one are not applied
+	if len(*requests) != 1 || out.Len() != 0 {
+		t.Errorf("expected nothing to be applied after the conflict, got %d requests and output %q", len(*requests), out.String())
+	}
+}
+
+func TestApplierUnknownKind(t *testing.T) {
+	server, _ := applyTestServer(t, nil)
+	a := testApplier(t, server, io.Discard, DryRunNone, false)
+
+	err := a.apply([]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n"))
+	if err == nil || !strings.Contains(err.Error(), "is its CRD installed") {
+		t.Errorf("expected an error for the unknown kind, got %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+)
+
+// moduleManifest lists the modules generated by a single gen-module run, e.g.
+//
+//	modules:
+//	- name: vpc
+//	  source: github.com/org/terraform-modules//vpc
+//	  ref: v1.2.0
+//	  provider:
+//	    name: aws
+//	  credentials:
+//	    tokenEnv: GITHUB_TOKEN
+type moduleManifest struct {
+	Modules []moduleManifestEntry `json:"modules"`
+}
+
+type moduleManifestEntry struct {
+	Name        string                 `json:"name"`
+	Source      string                 `json:"source"`
+	Ref         string                 `json:"ref,omitempty"`
+	Version     string                 `json:"version,omitempty"`
+	ModuleRef   string                 `json:"moduleRef,omitempty"`
+	Directory   string                 `json:"directory,omitempty"`
+	Provider    moduleManifestProvider `json:"provider,omitempty"`
+	Credentials *moduleCredentials     `json:"credentials,omitempty"`
+}
+
+type moduleManifestProvider struct {
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// moduleCredentials are the credentials of the module repository. The token and password
+// can be read from environment variables, so that the manifest can be kept in git.
+type moduleCredentials struct {
+	Token       string `json:"token,omitempty"`
+	TokenEnv    string `json:"tokenEnv,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+	SSHKey      string `json:"sshKey,omitempty"`
+	KnownHosts  string `json:"knownHosts,omitempty"`
+	// Secret is an existing git cred secret, as namespace/name, like --cred-secret
+	Secret          string `json:"secret,omitempty"`
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+}
+
+// moduleResult is the outcome of the generation of a module of the manifest
+type moduleResult struct {
+	Name string
+	Err  error
+}
+
+func loadModuleManifest(filename string) (*moduleManifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module manifest %s: %v", filename, err)
+	}
+
+	manifest := &moduleManifest{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid module manifest %s: %v", filename, err)
+	}
+
+	if len(manifest.Modules) == 0 {
+		return nil, fmt.Errorf("no module is listed in the module manifest %s", filename)
+	}
+
+	names := map[string]bool{}
+	for i, entry := range manifest.Modules {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("module %d of the module manifest %s has no name", i+1, filename)
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("module %s is listed more than once in the module manifest %s", entry.Name, filename)
+		}
+		names[entry.Name] = true
+	}
+
+	return manifest, nil
+}
+
+// needsKubeClient tells whether any module refers to an existing git cred secret
+func (m *moduleManifest) needsKubeClient() bool {
+	for _, entry := range m.Modules {
+		if entry.Credentials != nil && entry.Credentials.Secret != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// forEntry returns the options generating the module of the manifest entry. The flags apply
+// to every module unless overridden by the entry. Relative paths in the entry are relative to
+// the manifest file.
+func (o *GenModuleOptions) forEntry(entry *moduleManifestEntry, baseDir string) (*GenModuleOptions, error) {
+	eo := *o
+	eo.Filename = ""
+	eo.ModuleDefName = entry.Name
+	eo.Source = relativeTo(baseDir, entry.Source)
+	eo.Ref = entry.Ref
+	eo.Version = entry.Version
+	eo.ModuleRef = entry.ModuleRef
+
+	if entry.Directory != "" {
+		eo.Directory = relativeTo(baseDir, entry.Directory)
+	}
+	if entry.Provider.Name != "" {
+		eo.ProviderName = entry.Provider.Name
+	}
+	if entry.Provider.Source != "" {
+		eo.ProviderSource = entry.Provider.Source
+	}
+
+	if c := entry.Credentials; c != nil {
+		eo.Token, eo.Username, eo.Password, eo.SSHKey, eo.KnownHosts, eo.CredSecret = c.Token, c.Username, c.Password, "", "", c.Secret
+		if c.TokenEnv != "" {
+			eo.Token = os.Getenv(c.TokenEnv)
+			if eo.Token == "" {
+				return nil, fmt.Errorf("environment variable %s of the token is not set", c.TokenEnv)
+			}
+		}
+		if c.PasswordEnv != "" {
+			eo.Password = os.Getenv(c.PasswordEnv)
+			if eo.Password == "" {
+				return nil, fmt.Errorf("environment variable %s of the password is not set", c.PasswordEnv)
+			}
+		}
+		if c.SSHKey != "" {
+			eo.SSHKey = filepath.Join(baseDir, c.SSHKey)
+			if filepath.IsAbs(c.SSHKey) {
+				eo.SSHKey = c.SSHKey
+			}
+		}
+		if c.KnownHosts != "" {
+			eo.KnownHosts = filepath.Join(baseDir, c.KnownHosts)
+			if filepath.IsAbs(c.KnownHosts) {
+				eo.KnownHosts = c.KnownHosts
+			}
+		}
+		if c.SecretNamespace != "" {
+			eo.GenSecretNamespace = c.SecretNamespace
+		}
+	}
+
+	if entry.Source == "" {
+		return nil, fmt.Errorf("module has no source")
+	}
+	if err := eo.Validate(nil); err != nil {
+		return nil, err
+	}
+
+	return &eo, nil
+}
+
+// relativeTo resolves the relative local path, i.e. starting with ./ or ../, against the
+// directory. Other sources are returned as they are.
+func relativeTo(dir, p string) string {
+	if strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || p == "." || p == ".." {
+		return filepath.Join(dir, p)
+	}
+	return p
+}
+
+// runBatch generates the modules of the manifest with a bounded number of parallel workers.
+// Every module is attempted, the failures are reported together at the end.
+func (o *GenModuleOptions) runBatch() error {
+	baseDir := filepath.Dir(o.Filename)
+	results := make([]moduleResult, len(o.Manifest.Modules))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < o.Parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entry := &o.Manifest.Modules[i]
+				results[i] = moduleResult{
+					Name: entry.Name,
+					Err:  o.runEntry(entry, baseDir),
+				}
+			}
+		}()
+	}
+	for i := range o.Manifest.Modules {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return printModuleResults(o.Out, results)
+}
+
+// printModuleResults prints the summary of the generated modules and fails if any of them failed
+func printModuleResults(out io.Writer, results []moduleResult) error {
+	failed := 0
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tSTATUS\tERROR")
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(w, "%s\tFailed\t%s\n", r.Name, strings.ReplaceAll(r.Err.Error(), "\n", " "))
+		} else {
+			fmt.Fprintf(w, "%s\tSucceeded\t\n", r.Name)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d modules failed", failed, len(results))
+	}
+
+	return nil
+}
+
+func (o *GenModuleOptions) runEntry(entry *moduleManifestEntry, baseDir string) error {
+	eo, err := o.forEntry(entry, baseDir)
+	if err != nil {
+		return err
+	}
+
+	if err := eo.generateModuleTRD(); err != nil {
+		return errors.New(redact(err.Error(), eo.Token, eo.Password))
+	}
+
+	return nil
+}
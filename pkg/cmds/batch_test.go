@@ -0,0 +1,334 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestLoadModuleManifest(t *testing.T) {
+	cases := []struct {
+		name       string
+		manifest   string
+		want       *moduleManifest
+		kubeClient bool
+		err        bool
+	}{
+		{
+			name: "modules",
+			manifest: `
+modules:
+- name: vpc
+  source: github.com/org/terraform-modules//vpc
+  ref: v1.2.0
+  provider:
+    name: aws
+  credentials:
+    tokenEnv: GITHUB_TOKEN
+- name: db
+  source: ./db
+`,
+			want: &moduleManifest{Modules: []moduleManifestEntry{
+				{
+					Name:        "vpc",
+					Source:      "github.com/org/terraform-modules//vpc",
+					Ref:         "v1.2.0",
+					Provider:    moduleManifestProvider{Name: "aws"},
+					Credentials: &moduleCredentials{TokenEnv: "GITHUB_TOKEN"},
+				},
+				{Name: "db", Source: "./db"},
+			}},
+		},
+		{
+			name: "existing cred secret",
+			manifest: `
+modules:
+- name: vpc
+  source: github.com/org/vpc
+  credentials:
+    secret: platform/github
+`,
+			want: &moduleManifest{Modules: []moduleManifestEntry{
+				{Name: "vpc", Source: "github.com/org/vpc", Credentials: &moduleCredentials{Secret: "platform/github"}},
+			}},
+			kubeClient: true,
+		},
+		{name: "unknown field", manifest: "modules:\n- name: vpc\n  sorce: ./vpc\n", err: true},
+		{name: "no modules", manifest: "modules: []\n", err: true},
+		{name: "no name", manifest: "modules:\n- source: ./vpc\n", err: true},
+		{name: "duplicate name", manifest: "modules:\n- name: vpc\n  source: ./a\n- name: vpc\n  source: ./b\n", err: true},
+		{name: "invalid yaml", manifest: "modules: [", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "modules.yaml")
+			if err := os.WriteFile(filename, []byte(strings.TrimLeft(c.manifest, "\n")), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadModuleManifest(filename)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+			if got.needsKubeClient() != c.kubeClient {
+				t.Errorf("expected needsKubeClient %v", c.kubeClient)
+			}
+		})
+	}
+}
+
+func TestGenModuleForEntry(t *testing.T) {
+	t.Setenv("KF_TEST_TOKEN", "env-token")
+	t.Setenv("KF_TEST_PASSWORD", "env-password")
+
+	base := GenModuleOptions{
+		Directory:          ".",
+		ProviderName:       "aws",
+		Token:              "flag-token",
+		Ref:                "main",
+		GenSecretNamespace: "default",
+		DryRun:             DryRunNone,
+		Parallel:           4,
+		Filename:           "/manifests/modules.yaml",
+	}
+
+	cases := []struct {
+		name  string
+		entry moduleManifestEntry
+		want  func(o *GenModuleOptions)
+		err   bool
+	}{
+		{
+			name:  "flags apply to the entry",
+			entry: moduleManifestEntry{Name: "vpc", Source: "github.com/org/vpc"},
+			want: func(o *GenModuleOptions) {
+				o.ModuleDefName, o.Source, o.Ref = "vpc", "github.com/org/vpc", ""
+			},
+		},
+		{
+			name: "entry overrides the flags",
+			entry: moduleManifestEntry{
+				Name:      "vpc",
+				Source:    "./vpc",
+				Ref:       "v1.2.0",
+				Directory: "../out",
+				Provider:  moduleManifestProvider{Name: "google", Source: "hashicorp/google"},
+			},
+			want: func(o *GenModuleOptions) {
+				o.ModuleDefName, o.Source, o.Ref, o.Directory = "vpc", "/manifests/vpc", "v1.2.0", "/out"
+				o.ProviderName, o.ProviderSource = "google", "hashicorp/google"
+			},
+		},
+		{
+			name: "token from the environment",
+			entry: moduleManifestEntry{
+				Name:        "vpc",
+				Source:      "gitlab.com/org/vpc",
+				Credentials: &moduleCredentials{TokenEnv: "KF_TEST_TOKEN", Username: "oauth2"},
+			},
+			want: func(o *GenModuleOptions) {
+				o.ModuleDefName, o.Source, o.Ref = "vpc", "gitlab.com/org/vpc", ""
+				o.Token, o.Username = "env-token", "oauth2"
+			},
+		},
+		{
+			name: "password from the environment",
+			entry: moduleManifestEntry{
+				Name:        "vpc",
+				Source:      "git.example.com/org/vpc",
+				Credentials: &moduleCredentials{Username: "ci", PasswordEnv: "KF_TEST_PASSWORD"},
+			},
+			want: func(o *GenModuleOptions) {
+				o.ModuleDefName, o.Source, o.Ref = "vpc", "git.example.com/org/vpc", ""
+				o.Token, o.Username, o.Password = "", "ci", "env-password"
+			},
+		},
+		{
+			name: "ssh key relative to the manifest",
+			entry: moduleManifestEntry{
+				Name:        "vpc",
+				Source:      "git@github.com:org/vpc.git",
+				Credentials: &moduleCredentials{SSHKey: "keys/id_rsa", KnownHosts: "/etc/ssh/known_hosts"},
+			},
+			want: func(o *GenModuleOptions) {
+				o.ModuleDefName, o.Source, o.Ref = "vpc", "git@github.com:org/vpc.git", ""
+				o.Token, o.SSHKey, o.KnownHosts = "", "/manifests/keys/id_rsa", "/etc/ssh/known_hosts"
+			},
+		},
+		{
+			name: "existing cred secret",
+			entry: moduleManifestEntry{
+				Name:        "vpc",
+				Source:      "github.com/org/vpc",
+				Credentials: &moduleCredentials{Secret: "platform/github", SecretNamespace: "platform"},
+			},
+			want: func(o *GenModuleOptions) {
+				o.ModuleDefName, o.Source, o.Ref = "vpc", "github.com/org/vpc", ""
+				o.Token, o.CredSecret, o.GenSecretNamespace = "", "platform/github", "platform"
+			},
+		},
+		{
+			name:  "unset token variable",
+			entry: moduleManifestEntry{Name: "vpc", Source: "github.com/org/vpc", Credentials: &moduleCredentials{TokenEnv: "KF_TEST_UNSET"}},
+			err:   true,
+		},
+		{
+			name:  "no source",
+			entry: moduleManifestEntry{Name: "vpc"},
+			err:   true,
+		},
+		{
+			name:  "token and ssh key",
+			entry: moduleManifestEntry{Name: "vpc", Source: "github.com/org/vpc", Credentials: &moduleCredentials{Token: "t", SSHKey: "/id_rsa"}},
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := base
+			got, err := o.forEntry(&c.entry, "/manifests")
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := base
+			want.Filename = ""
+			c.want(&want)
+			if !reflect.DeepEqual(got, &want) {
+				t.Errorf("expected %+v, got %+v", want, *got)
+			}
+		})
+	}
+}
+
+func TestRelativeTo(t *testing.T) {
+	cases := []struct {
+		path string
+		want string
+	}{
+		{path: "./vpc", want: "/manifests/vpc"},
+		{path: "../vpc", want: "/vpc"},
+		{path: ".", want: "/manifests"},
+		{path: "/abs/vpc", want: "/abs/vpc"},
+		{path: "github.com/org/vpc", want: "github.com/org/vpc"},
+		{path: "git::https://example.com/vpc.git", want: "git::https://example.com/vpc.git"},
+	}
+
+	for _, c := range cases {
+		if got := relativeTo("/manifests", c.path); got != c.want {
+			t.Errorf("relativeTo(%q): expected %q, got %q", c.path, c.want, got)
+		}
+	}
+}
+
+func TestPrintModuleResults(t *testing.T) {
+	var out bytes.Buffer
+	err := printModuleResults(&out, []moduleResult{
+		{Name: "vpc"},
+		{Name: "db", Err: errors.New("failed to clone\nrepository not found")},
+	})
+	if err == nil || err.Error() != "1 of 2 modules failed" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	want := "MODULE  STATUS     ERROR\n" +
+		"vpc     Succeeded  \n" +
+		"db      Failed     failed to clone repository not found\n"
+	if out.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out.String())
+	}
+}
+
+func TestGenModuleRunBatch(t *testing.T) {
+	modules := writeModule(t, map[string]string{
+		"vpc/main.tf": `variable "cidr" {
+  type = string
+}
+`,
+		"db/main.tf": `variable "size" {
+  type = number
+}
+`,
+		"modules.yaml": `modules:
+- name: vpc
+  source: ./vpc
+- name: missing
+  source: ./missing
+- name: db
+  source: ./db
+`,
+	})
+	outDir := t.TempDir()
+
+	manifestFile := filepath.Join(modules, "modules.yaml")
+	manifest, err := loadModuleManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	o := &GenModuleOptions{
+		Directory:          outDir,
+		ProviderName:       "aws",
+		ProviderSource:     "hashicorp/aws",
+		GenSecretNamespace: "default",
+		DryRun:             DryRunNone,
+		Parallel:           2,
+		Filename:           manifestFile,
+		Manifest:           manifest,
+		IOStreams:          genericclioptions.IOStreams{Out: &out, ErrOut: &out},
+	}
+
+	if err := o.Run(); err == nil || err.Error() != "1 of 3 modules failed" {
+		t.Errorf("unexpected error %v", err)
+	}
+	// the modules after the failed one are generated as well
+	for _, name := range []string{"vpc", "db"} {
+		if _, err := os.Stat(filepath.Join(outDir, name+".yaml")); err != nil {
+			t.Errorf("Module Definition %s is not generated: %v", name, err)
+		}
+	}
+	for _, line := range []string{"vpc      Succeeded", "missing  Failed", "db       Succeeded"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("summary misses %q:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+type CacheListOptions struct {
+	genericclioptions.IOStreams
+}
+
+type CachePruneOptions struct {
+	OlderThan time.Duration
+
+	genericclioptions.IOStreams
+}
+
+func NewCmdCache(streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "cache",
+		Short:             "Manage the cache of the module repositories cloned by gen-module",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(NewCmdCacheList(streams))
+	cmd.AddCommand(NewCmdCachePrune(streams))
+
+	return cmd
+}
+
+func NewCmdCacheList(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &CacheListOptions{
+		IOStreams: streams,
+	}
+
+	cmd := &cobra.Command{
+		Use:               "list",
+		Short:             "List the cached module repositories",
+		DisableAutoGenTag: true,
+		Args:              cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	return cmd
+}
+
+func (o *CacheListOptions) Run() error {
+	cache, err := openModuleCache()
+	if err != nil {
+		return err
+	}
+
+	entries, err := cache.list()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(o.Out, "no module repository is cached in", cache.Dir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSOURCE\tSIZE\tLAST USED")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Key, entry.Source, humanSize(entry.Size), entry.LastUsed.Local().Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
+
+func NewCmdCachePrune(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &CachePruneOptions{
+		IOStreams: streams,
+	}
+
+	cmd := &cobra.Command{
+		Use:               "prune",
+		Short:             "Remove the cached module repositories",
+		DisableAutoGenTag: true,
+		Args:              cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmd.Flags().DurationVar(&o.OlderThan, "older-than", 0, "only remove the repositories not used within the duration, e.g. 720h")
+
+	return cmd
+}
+
+func (o *CachePruneOptions) Run() error {
+	cache, err := openModuleCache()
+	if err != nil {
+		return err
+	}
+
+	pruned, err := cache.prune(o.OlderThan)
+	for _, entry := range pruned {
+		fmt.Fprintln(o.Out, "removed", entry.Source)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "%d module repositories removed from %s\n", len(pruned), cache.Dir)
+
+	return nil
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
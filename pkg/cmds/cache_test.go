@@ -0,0 +1,172 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// writeTestCacheEntry adds a cached repository last used at the time
+func writeTestCacheEntry(t *testing.T, cache *moduleCache, repo string, lastUsed time.Time) string {
+	t.Helper()
+
+	entryDir := filepath.Join(cache.Dir, cacheKey(repo))
+	if err := os.MkdirAll(filepath.Join(entryDir, cacheRepoDir), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(entryDir, cacheRepoDir, "main.tf"), []byte(sourceTestModule), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCacheEntry(entryDir, &cacheEntry{Source: repo, LastUsed: lastUsed}); err != nil {
+		t.Fatal(err)
+	}
+
+	return entryDir
+}
+
+func TestCacheKey(t *testing.T) {
+	if cacheKey("github.com/org/repo") != cacheKey("GitHub.com/Org/Repo") {
+		t.Error("cache key depends on the case of the repository")
+	}
+	if cacheKey("github.com/org/repo") == cacheKey("github.com/org/other") {
+		t.Error("repositories share a cache key")
+	}
+}
+
+func TestCacheList(t *testing.T) {
+	t.Setenv(CacheDirEnv, t.TempDir())
+	cache, err := openModuleCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	o := &CacheListOptions{IOStreams: genericclioptions.IOStreams{Out: &out}}
+	if err := o.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "no module repository is cached") {
+		t.Errorf("unexpected output of an empty cache: %q", out.String())
+	}
+
+	now := time.Now()
+	writeTestCacheEntry(t, cache, "github.com/org/old", now.Add(-48*time.Hour))
+	writeTestCacheEntry(t, cache, "github.com/org/new", now)
+	// an entry whose first checkout hasn't finished yet
+	if err := os.MkdirAll(filepath.Join(cache.Dir, cacheKey("github.com/org/pending")), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := cache.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Source != "github.com/org/new" || entries[1].Source != "github.com/org/old" {
+		t.Fatalf("expected the entries sorted by last use, got %+v", entries)
+	}
+	if entries[0].Key != cacheKey("github.com/org/new") || entries[0].Size == 0 {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+
+	out.Reset()
+	if err := o.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "KEY") || !strings.Contains(lines[1], "github.com/org/new") || !strings.Contains(lines[2], "github.com/org/old") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	t.Setenv(CacheDirEnv, t.TempDir())
+	cache, err := openModuleCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	oldDir := writeTestCacheEntry(t, cache, "github.com/org/old", now.Add(-48*time.Hour))
+	lockedDir := writeTestCacheEntry(t, cache, "github.com/org/locked", now.Add(-48*time.Hour))
+	newDir := writeTestCacheEntry(t, cache, "github.com/org/new", now)
+
+	// an entry in use by another run is skipped
+	unlock, err := lockFile(filepath.Join(lockedDir, cacheLockFile), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	o := &CachePruneOptions{
+		OlderThan: 24 * time.Hour,
+		IOStreams: genericclioptions.IOStreams{Out: &out},
+	}
+	if err := o.Run(); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	if want := "removed github.com/org/old\n1 module repositories removed from " + cache.Dir + "\n"; out.String() != want {
+		t.Errorf("expected output %q, got %q", want, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(oldDir, cacheRepoDir)); !os.IsNotExist(err) {
+		t.Error("old entry is not removed")
+	}
+	for _, dir := range []string{lockedDir, newDir} {
+		if _, err := readCacheEntry(dir); err != nil {
+			t.Errorf("entry %s is removed: %v", dir, err)
+		}
+	}
+
+	pruned, err := cache.prune(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 {
+		t.Errorf("expected the remaining 2 entries to be pruned, got %d", len(pruned))
+	}
+	entries, err := cache.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected an empty cache, got %+v", entries)
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	cases := map[int64]string{
+		0:               "0B",
+		1023:            "1023B",
+		1024:            "1.0KiB",
+		1536:            "1.5KiB",
+		5 * 1024 * 1024: "5.0MiB",
+		3 << 30:         "3.0GiB",
+	}
+	for size, want := range cases {
+		if got := humanSize(size); got != want {
+			t.Errorf("%d: expected %s, got %s", size, want, got)
+		}
+	}
+}
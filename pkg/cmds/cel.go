@@ -0,0 +1,350 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var celOperators = map[*hclsyntax.Operation]string{
+	hclsyntax.OpLogicalOr:          "||",
+	hclsyntax.OpLogicalAnd:         "&&",
+	hclsyntax.OpLogicalNot:         "!",
+	hclsyntax.OpEqual:              "==",
+	hclsyntax.OpNotEqual:           "!=",
+	hclsyntax.OpGreaterThan:        ">",
+	hclsyntax.OpGreaterThanOrEqual: ">=",
+	hclsyntax.OpLessThan:           "<",
+	hclsyntax.OpLessThanOrEqual:    "<=",
+	hclsyntax.OpAdd:                "+",
+	hclsyntax.OpSubtract:           "-",
+	hclsyntax.OpMultiply:           "*",
+	hclsyntax.OpDivide:             "/",
+	hclsyntax.OpModulo:             "%",
+	hclsyntax.OpNegate:             "-",
+}
+
+// celMethods maps the terraform string functions onto the equivalent receiver style
+// functions available in the kubernetes CEL environment
+var celMethods = map[string]string{
+	"startswith": "startsWith",
+	"endswith":   "endsWith",
+	"lower":      "lowerAscii",
+	"upper":      "upperAscii",
+	"trimspace":  "trim",
+}
+
+// celExpr translates the condition of a validation block of the variable into a CEL rule
+// evaluated on the property of the variable, so `var.<name>` becomes `self`. locals holds
+// the names of the iteration variables of the enclosing for expressions. The numbers of the
+// schema are doubles in CEL, which doesn't mix int and double operands, so every number of
+// the rule is kept a double and only the indexes are ints.
+func celExpr(expr hclsyntax.Expression, name string, locals map[string]bool) (string, error) {
+	switch e := expr.(type) {
+	case *hclsyntax.LiteralValueExpr:
+		return celLiteral(e.Val)
+	case *hclsyntax.TemplateWrapExpr:
+		return celExpr(e.Wrapped, name, locals)
+	case *hclsyntax.TemplateExpr:
+		var parts []string
+		for _, part := range e.Parts {
+			if lit, ok := part.(*hclsyntax.LiteralValueExpr); ok {
+				s, err := celLiteral(lit.Val)
+				if err != nil {
+					return "", err
+				}
+				parts = append(parts, s)
+				continue
+			}
+
+			s, err := celExpr(part, name, locals)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "string("+s+")")
+		}
+		if len(parts) == 0 {
+			return `""`, nil
+		}
+		return strings.Join(parts, " + "), nil
+	case *hclsyntax.ScopeTraversalExpr:
+		return celTraversal(e.Traversal, name, locals)
+	case *hclsyntax.RelativeTraversalExpr:
+		src, err := celExpr(e.Source, name, locals)
+		if err != nil {
+			return "", err
+		}
+		return celTraversalSteps(src, e.Traversal)
+	case *hclsyntax.IndexExpr:
+		coll, err := celExpr(e.Collection, name, locals)
+		if err != nil {
+			return "", err
+		}
+		if lit, ok := e.Key.(*hclsyntax.LiteralValueExpr); ok {
+			key, err := celIndex(lit.Val)
+			if err != nil {
+				return "", err
+			}
+			return coll + "[" + key + "]", nil
+		}
+		key, err := celExpr(e.Key, name, locals)
+		if err != nil {
+			return "", err
+		}
+		return coll + "[" + key + "]", nil
+	case *hclsyntax.TupleConsExpr:
+		items := make([]string, 0, len(e.Exprs))
+		for _, item := range e.Exprs {
+			s, err := celExpr(item, name, locals)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case *hclsyntax.ObjectConsExpr:
+		items := make([]string, 0, len(e.Items))
+		for _, item := range e.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || key.Type() != cty.String || key.IsNull() {
+				return "", fmt.Errorf("object keys must be constant strings")
+			}
+			k := strconv.Quote(key.AsString())
+
+			v, err := celExpr(item.ValueExpr, name, locals)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, k+": "+v)
+		}
+		return "{" + strings.Join(items, ", ") + "}", nil
+	case *hclsyntax.UnaryOpExpr:
+		val, err := celExpr(e.Val, name, locals)
+		if err != nil {
+			return "", err
+		}
+		return celOperators[e.Op] + "(" + val + ")", nil
+	case *hclsyntax.BinaryOpExpr:
+		lhs, err := celExpr(e.LHS, name, locals)
+		if err != nil {
+			return "", err
+		}
+		rhs, err := celExpr(e.RHS, name, locals)
+		if err != nil {
+			return "", err
+		}
+		if e.Op == hclsyntax.OpModulo {
+			// the modulo is only defined on ints
+			return "double(int(" + lhs + ") % int(" + rhs + "))", nil
+		}
+		return "(" + lhs + " " + celOperators[e.Op] + " " + rhs + ")", nil
+	case *hclsyntax.ConditionalExpr:
+		cond, err := celExpr(e.Condition, name, locals)
+		if err != nil {
+			return "", err
+		}
+		t, err := celExpr(e.TrueResult, name, locals)
+		if err != nil {
+			return "", err
+		}
+		f, err := celExpr(e.FalseResult, name, locals)
+		if err != nil {
+			return "", err
+		}
+		return "(" + cond + " ? " + t + " : " + f + ")", nil
+	case *hclsyntax.FunctionCallExpr:
+		return celFunctionCall(e, name, locals)
+	}
+
+	return "", fmt.Errorf("unsupported expression at %s", expr.Range())
+}
+
+func celFunctionCall(e *hclsyntax.FunctionCallExpr, name string, locals map[string]bool) (string, error) {
+	if e.ExpandFinal {
+		return "", fmt.Errorf("expanding function arguments is not supported at %s", e.Range())
+	}
+
+	args := func(exprs ...hclsyntax.Expression) ([]string, error) {
+		out := make([]string, 0, len(exprs))
+		for _, expr := range exprs {
+			s, err := celExpr(expr, name, locals)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+
+	switch {
+	case e.Name == "length" && len(e.Args) == 1:
+		a, err := args(e.Args...)
+		if err != nil {
+			return "", err
+		}
+		return "double(size(" + a[0] + "))", nil
+	case e.Name == "contains" && len(e.Args) == 2:
+		a, err := args(e.Args...)
+		if err != nil {
+			return "", err
+		}
+		return "(" + a[1] + " in " + a[0] + ")", nil
+	case e.Name == "can" && len(e.Args) == 1:
+		// only the regex match is supported, other functions have no failure semantic in CEL
+		re, ok := e.Args[0].(*hclsyntax.FunctionCallExpr)
+		if !ok || re.Name != "regex" || len(re.Args) != 2 {
+			return "", fmt.Errorf("function can is only supported with regex at %s", e.Range())
+		}
+		a, err := args(re.Args...)
+		if err != nil {
+			return "", err
+		}
+		return a[1] + ".matches(" + a[0] + ")", nil
+	case (e.Name == "alltrue" || e.Name == "anytrue") && len(e.Args) == 1:
+		return celQuantifier(e, name, locals)
+	case celMethods[e.Name] != "" && len(e.Args) >= 1:
+		a, err := args(e.Args...)
+		if err != nil {
+			return "", err
+		}
+		return a[0] + "." + celMethods[e.Name] + "(" + strings.Join(a[1:], ", ") + ")", nil
+	}
+
+	return "", fmt.Errorf("unsupported function %s at %s", e.Name, e.Range())
+}
+
+// celQuantifier translates alltrue([for v in coll : cond]) and anytrue(...) into the all and
+// exists macros of CEL
+func celQuantifier(e *hclsyntax.FunctionCallExpr, name string, locals map[string]bool) (string, error) {
+	forExpr, ok := e.Args[0].(*hclsyntax.ForExpr)
+	if !ok || forExpr.KeyExpr != nil || forExpr.KeyVar != "" {
+		return "", fmt.Errorf("function %s is only supported with a for expression over a list at %s", e.Name, e.Range())
+	}
+
+	coll, err := celExpr(forExpr.CollExpr, name, locals)
+	if err != nil {
+		return "", err
+	}
+
+	scope := map[string]bool{forExpr.ValVar: true}
+	for k := range locals {
+		scope[k] = true
+	}
+
+	cond, err := celExpr(forExpr.ValExpr, name, scope)
+	if err != nil {
+		return "", err
+	}
+
+	macro := "all"
+	if e.Name == "anytrue" {
+		macro = "exists"
+	}
+
+	if forExpr.CondExpr != nil {
+		filter, err := celExpr(forExpr.CondExpr, name, scope)
+		if err != nil {
+			return "", err
+		}
+
+		if macro == "all" {
+			cond = "(!" + filter + " || " + cond + ")"
+		} else {
+			cond = "(" + filter + " && " + cond + ")"
+		}
+	}
+
+	return coll + "." + macro + "(" + forExpr.ValVar + ", " + cond + ")", nil
+}
+
+func celTraversal(traversal hcl.Traversal, name string, locals map[string]bool) (string, error) {
+	root := traversal.RootName()
+
+	switch {
+	case locals[root]:
+		return celTraversalSteps(root, traversal[1:])
+	case root == "var" && len(traversal) > 1:
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok && attr.Name == name {
+			return celTraversalSteps("self", traversal[2:])
+		}
+	}
+
+	return "", fmt.Errorf("unsupported reference at %s, only var.%s can be referred", traversal.SourceRange(), name)
+}
+
+func celTraversalSteps(src string, traversal hcl.Traversal) (string, error) {
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseAttr:
+			src += "." + s.Name
+		case hcl.TraverseIndex:
+			key, err := celIndex(s.Key)
+			if err != nil {
+				return "", err
+			}
+			src += "[" + key + "]"
+		default:
+			return "", fmt.Errorf("unsupported traversal at %s", step.SourceRange())
+		}
+	}
+
+	return src, nil
+}
+
+func celLiteral(val cty.Value) (string, error) {
+	if val.IsNull() {
+		return "null", nil
+	}
+
+	switch val.Type() {
+	case cty.String:
+		return strconv.Quote(val.AsString()), nil
+	case cty.Bool:
+		return strconv.FormatBool(val.True()), nil
+	case cty.Number:
+		bf := val.AsBigFloat()
+		if bf.IsInt() {
+			return bf.Text('f', 0) + ".0", nil
+		}
+		s := bf.Text('g', -1)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	}
+
+	return "", fmt.Errorf("unsupported literal of type %s", val.Type().FriendlyName())
+}
+
+// celIndex returns the literal of a list index or a map key, the list indexes are ints
+func celIndex(val cty.Value) (string, error) {
+	if !val.IsNull() && val.Type() == cty.Number {
+		bf := val.AsBigFloat()
+		if !bf.IsInt() {
+			return "", fmt.Errorf("list index %s is not an integer", bf.Text('g', -1))
+		}
+		return bf.Text('f', 0), nil
+	}
+
+	return celLiteral(val)
+}
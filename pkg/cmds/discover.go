@@ -0,0 +1,180 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// discoveredModule is a module directory found in the fetched module source
+type discoveredModule struct {
+	Name string
+	// Path is the slash separated path of the module relative to the module source
+	Path string
+}
+
+// discoverModules walks dir and returns every module directory in it, skipping hidden
+// directories and the directories listed in exclude
+func discoverModules(dir string, exclude []string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && (strings.HasPrefix(info.Name(), ".") || contains(exclude, info.Name())) {
+			return filepath.SkipDir
+		}
+
+		if tfconfig.IsModuleDir(p) {
+			if rel == "." {
+				rel = ""
+			}
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// discoveredModuleNames derives the Module Definition names from the paths of the modules.
+// The root module is named after prefix, the others after their path with the leading
+// modules/ directory dropped, e.g. modules/vpc-peering becomes <prefix>-vpc-peering.
+func discoveredModuleNames(prefix string, paths []string) ([]discoveredModule, error) {
+	var modules []discoveredModule
+	seen := map[string]string{}
+	for _, p := range paths {
+		name := moduleDefNameOf(strings.TrimPrefix(p, "modules/"))
+		switch {
+		case name == "":
+			name = prefix
+		case prefix != "":
+			name = prefix + "-" + name
+		}
+
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+			return nil, fmt.Errorf("invalid Module Definition name %q derived from module %s: %s", name, displayPath(p), strings.Join(msgs, ", "))
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("modules %s and %s both get the Module Definition name %s", displayPath(other), displayPath(p), name)
+		}
+		seen[name] = p
+
+		modules = append(modules, discoveredModule{
+			Name: name,
+			Path: p,
+		})
+	}
+
+	return modules, nil
+}
+
+// moduleDefNameOf turns a module path into a Module Definition name
+func moduleDefNameOf(p string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, p)
+
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+	return strings.Trim(name, "-")
+}
+
+func displayPath(p string) string {
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// generateDiscovered generates the Module Definitions of every module found in the fetched
+// module source
+func (o *GenModuleOptions) generateDiscovered(fetched *fetchedModule) error {
+	paths, err := discoverModules(fetched.Dir, o.DiscoverExclude)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no terraform module is found in the module source %s", o.Source)
+	}
+
+	prefix := o.ModuleDefName
+	if prefix == "" {
+		prefix = moduleDefNameOf(path.Base(strings.TrimSuffix(filepath.ToSlash(fetched.Dir), "/")))
+		if fetched.GitRef != "" {
+			prefix = moduleDefNameOf(path.Base(strings.TrimSuffix(fetched.GitRef, ".git")))
+		}
+	}
+	modules, err := discoveredModuleNames(prefix, paths)
+	if err != nil {
+		return err
+	}
+
+	results := make([]moduleResult, 0, len(modules))
+	for _, m := range modules {
+		sub := *fetched
+		sub.cleanup = nil
+		err := sub.subdir(m.Path)
+		if err == nil {
+			// --module-ref names the repository, every module points at its own subdirectory of it
+			do := *o
+			if o.ModuleRef != "" && m.Path != "" {
+				do.ModuleRef = subdirRef(o.ModuleRef, m.Path)
+			}
+			err = do.generateModule(m.Name, &sub)
+		}
+		if err != nil {
+			err = errors.New(redact(err.Error(), o.Token, o.Password))
+		}
+		results = append(results, moduleResult{
+			Name: m.Name,
+			Err:  err,
+		})
+	}
+
+	return printModuleResults(o.Out, results)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestDiscoverModules(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"main.tf":                       `variable "name" {}`,
+		"modules/vpc/main.tf":           `variable "cidr" {}`,
+		"modules/vpc-peering/main.tf":   `variable "peer" {}`,
+		"modules/db/variables.tf.json":  `{"variable": {"size": {}}}`,
+		"modules/db/README.md":          "db module",
+		"modules/docs/README.md":        "no module",
+		"examples/basic/main.tf":        `module "vpc" { source = "../../modules/vpc" }`,
+		".terraform/modules/x/main.tf":  `variable "x" {}`,
+		"test/fixtures/simple/main.tf":  `variable "y" {}`,
+		"modules/vpc/.hidden/z/main.tf": `variable "z" {}`,
+	})
+
+	cases := []struct {
+		name    string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "every module",
+			want: []string{"", "examples/basic", "modules/db", "modules/vpc", "modules/vpc-peering", "test/fixtures/simple"},
+		},
+		{
+			name:    "excluded directories",
+			exclude: []string{"examples", "test"},
+			want:    []string{"", "modules/db", "modules/vpc", "modules/vpc-peering"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := discoverModules(dir, c.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestDiscoveredModuleNames(t *testing.T) {
+	cases := []struct {
+		name   string
+		prefix string
+		paths  []string
+		want   []discoveredModule
+		err    bool
+	}{
+		{
+			name:   "modules layout",
+			prefix: "network",
+			paths:  []string{"", "modules/vpc", "modules/vpc_peering", "examples/Basic"},
+			want: []discoveredModule{
+				{Name: "network", Path: ""},
+				{Name: "network-vpc", Path: "modules/vpc"},
+				{Name: "network-vpc-peering", Path: "modules/vpc_peering"},
+				{Name: "network-examples-basic", Path: "examples/Basic"},
+			},
+		},
+		{
+			name:  "no prefix",
+			paths: []string{"modules/vpc", "db"},
+			want: []discoveredModule{
+				{Name: "vpc", Path: "modules/vpc"},
+				{Name: "db", Path: "db"},
+			},
+		},
+		{
+			name:   "name clash",
+			prefix: "network",
+			paths:  []string{"modules/vpc", "vpc"},
+			err:    true,
+		},
+		{
+			name:  "root module without prefix",
+			paths: []string{""},
+			err:   true,
+		},
+		{
+			name:   "name too long",
+			prefix: "network",
+			paths:  []string{"modules/" + strings.Repeat("a", 260)},
+			err:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := discoveredModuleNames(c.prefix, c.paths)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestModuleDefNameOf(t *testing.T) {
+	cases := map[string]string{
+		"vpc":                   "vpc",
+		"VPC_Peering":           "vpc-peering",
+		"modules/vpc":           "modules-vpc",
+		"terraform-aws-vpc.git": "terraform-aws-vpc-git",
+		"--a__b--":              "a-b",
+		"":                      "",
+	}
+	for p, want := range cases {
+		if got := moduleDefNameOf(p); got != want {
+			t.Errorf("moduleDefNameOf(%q): expected %q, got %q", p, want, got)
+		}
+	}
+}
+
+func TestGenModuleGenerateDiscovered(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"network/main.tf":             `variable "name" {}`,
+		"network/modules/vpc/main.tf": `variable "cidr" {}`,
+		"network/modules/db/main.tf":  `variable "size" {}`,
+	})
+	outDir := t.TempDir()
+
+	var out bytes.Buffer
+	o := &GenModuleOptions{
+		Directory:      outDir,
+		ProviderName:   "aws",
+		ProviderSource: "hashicorp/aws",
+		ModuleRef:      "github.com/org/network",
+		IOStreams:      genericclioptions.IOStreams{Out: &out, ErrOut: &out},
+	}
+	if err := o.generateDiscovered(&fetchedModule{Dir: filepath.Join(dir, "network")}); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	refs := map[string]string{
+		"network":     "github.com/org/network",
+		"network-db":  "github.com/org/network//modules/db",
+		"network-vpc": "github.com/org/network//modules/vpc",
+	}
+	for name, ref := range refs {
+		data, err := os.ReadFile(filepath.Join(outDir, name+".yaml"))
+		if err != nil {
+			t.Errorf("Module Definition %s is not generated: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), "ref: "+ref+"\n") {
+			t.Errorf("Module Definition %s doesn't point at %s:\n%s", name, ref, data)
+		}
+		if !strings.Contains(out.String(), name+" ") {
+			t.Errorf("summary misses %s:\n%s", name, out.String())
+		}
+	}
+}
@@ -17,22 +17,28 @@ limitations under the License.
 package cmds
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"kubeform.dev/module/api/v1alpha1"
 
 	"github.com/ghodss/yaml"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/terraform-config-inspect/tfconfig"
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 	apiv1 "kmodules.xyz/client-go/api/v1"
 )
@@ -50,271 +56,399 @@ type GenModuleOptions struct {
 	ProviderSource     string
 	Directory          string
 	Token              string
+	TokenEnv           string
+	TokenFile          string
+	Username           string
+	Password           string
+	SSHKey             string
+	KnownHosts         string
+	GitHostTypes       map[string]string
 	Source             string
 	Ref                string
+	Version            string
+	ModuleRef          string
 	Apply              bool
+	DryRun             string
+	ForceConflicts     bool
 	GenSecretNamespace string
+	CredSecret         string
+	Filename           string
+	Parallel           int
+	Discover           bool
+	DiscoverExclude    []string
+	GPGKeyring         string
+	SSHAllowedSigners  string
 
-	NewBuilder func() *resource.Builder
+	Manifest *moduleManifest
+
+	SkipUntranslatableValidations bool
+
+	NewBuilder    func() *resource.Builder
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+	Mapper        meta.RESTMapper
 
 	BuilderArgs []string
+
+	genericclioptions.IOStreams
 }
 
-func NewCmdGenModule(parent string, f cmdutil.Factory) *cobra.Command {
-	var directory, providerName, providerSource, source, token, genSecretNamespace, ref string
-	var apply bool
+func NewCmdGenModule(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	var directory, providerName, providerSource, source, token, tokenEnv, tokenFile, username, password, sshKey, knownHosts, genSecretNamespace, credSecret, ref, version, moduleRef string
+	var gitHostTypes map[string]string
+	var dryRun, filename string
+	var parallel int
+	var apply, forceConflicts, discover bool
+	var discoverExclude []string
+	var gpgKeyring, sshAllowedSigners string
+	var skipUntranslatableValidations bool
 
 	cmd := &cobra.Command{
-		Use:               "gen-module",
+		Use:               "gen-module [name]",
 		Short:             "Generate the module definition of given module",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o := &GenModuleOptions{
 				CmdParent:          parent,
-				ModuleDefName:      args[0],
 				ProviderName:       providerName,
 				ProviderSource:     providerSource,
 				Directory:          directory,
 				Ref:                ref,
+				Version:            version,
+				ModuleRef:          moduleRef,
 				Token:              token,
+				TokenEnv:           tokenEnv,
+				TokenFile:          tokenFile,
+				Username:           username,
+				Password:           password,
+				SSHKey:             sshKey,
+				KnownHosts:         knownHosts,
+				GitHostTypes:       gitHostTypes,
 				GenSecretNamespace: genSecretNamespace,
+				CredSecret:         credSecret,
 				Source:             source,
 				Apply:              apply,
+				DryRun:             dryRun,
+				ForceConflicts:     forceConflicts,
+				Filename:           filename,
+				Parallel:           parallel,
+				Discover:           discover,
+				DiscoverExclude:    discoverExclude,
+				GPGKeyring:         gpgKeyring,
+				SSHAllowedSigners:  sshAllowedSigners,
+
+				SkipUntranslatableValidations: skipUntranslatableValidations,
+
+				IOStreams: streams,
 			}
 			cmdutil.CheckErr(o.Complete(f, cmd, args))
+			cmdutil.CheckErr(o.Validate(args))
 			cmdutil.CheckErr(o.Run())
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&directory, "directory", "", "directory where generated module definition and git cred secret should store")
-	cmd.Flags().StringVar(&token, "token", "", "personal access token for cloning private github module repo")
+	cmd.Flags().StringVar(&token, "token", "", "personal access token for cloning private module repo, for bitbucket in the format of username:app-password")
+	_ = cmd.Flags().MarkDeprecated("token", "the token shows up in the process table, use --token-env or --token-file instead")
+	cmd.Flags().StringVar(&tokenEnv, "token-env", "", "environment variable holding the personal access token for cloning private module repo, for bitbucket in the format of username:app-password")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "file holding the personal access token for cloning private module repo, for bitbucket in the format of username:app-password")
+	cmd.Flags().StringVar(&username, "username", "", "username for cloning private module repo, used with --password or --token")
+	cmd.Flags().StringVar(&password, "password", "", "password for cloning private module repo")
+	cmd.Flags().StringVar(&sshKey, "ssh-key", "", "path of the private ssh key, e.g. a deploy key, for cloning private module repo over ssh")
+	cmd.Flags().StringVar(&knownHosts, "known-hosts", "", "path of the known_hosts file for verifying the ssh host key of the git host")
+	cmd.Flags().StringToStringVar(&gitHostTypes, "git-host-type", nil, "type of self-hosted git hosts, e.g. git.example.com=gitlab, one of github, gitlab, bitbucket, gitea, azure-devops, generic")
 	cmd.Flags().StringVar(&genSecretNamespace, "secret-namespace", "default", "namespace where git cred secret will be generated by Kubeform CLI")
-	cmd.Flags().StringVar(&source, "source", "", "source where module tf files are located")
-	cmd.Flags().StringVar(&providerName, "provider-name", "", "module's provider name")
-	cmd.Flags().StringVar(&providerSource, "provider-source", "", "module's provider source")
+	cmd.Flags().StringVar(&credSecret, "cred-secret", "", "existing git cred secret, as namespace/name, referred by the Module Definition instead of generating one")
+	cmd.Flags().StringVar(&source, "source", "", "source where module tf files are located, either a git repo url, a local directory, a local archive or an http(s) archive url")
+	cmd.Flags().StringVar(&providerName, "provider-name", "", "module's provider name, detected from the required_providers of the module if not given")
+	cmd.Flags().StringVar(&providerSource, "provider-source", "", "module's provider source, detected from the required_providers of the module if not given")
 	cmd.Flags().BoolVarP(&apply, "apply", "a", false, "whether we want to apply the generated Module Definition or not")
+	cmd.Flags().StringVar(&dryRun, "dry-run", DryRunNone, `dry run of --apply, one of "none", "server" or "client"`)
+	cmd.Flags().BoolVar(&forceConflicts, "force-conflicts", false, "take over the fields of the applied objects managed by others")
 	cmd.Flags().StringVar(&ref, "ref", "", "ref for doing git checkout")
+	cmd.Flags().BoolVar(&skipUntranslatableValidations, "skip-untranslatable-validations", false, "leave out the parts of the variable validations that can't be translated into schema constraints or CEL rules instead of failing")
+	cmd.Flags().StringVar(&version, "version", "", "version constraint of the module, only for terraform registry sources, the registry token is read from TF_TOKEN_<host> like terraform does")
+	cmd.Flags().StringVarP(&filename, "filename", "f", "", "manifest file listing the modules to generate, instead of generating a single module")
+	cmd.Flags().IntVar(&parallel, "parallel", 4, "number of modules of the manifest file generated in parallel")
+	cmd.Flags().BoolVar(&discover, "discover", false, "generate every module found in the source, the name is used as the prefix of the Module Definition names")
+	cmd.Flags().StringSliceVar(&discoverExclude, "discover-exclude", []string{"examples", "example", "test", "tests"}, "directories skipped by --discover")
+	cmd.Flags().StringVar(&gpgKeyring, "gpg-keyring", "", "file of the trusted gpg public keys, the checked out tag or commit must be signed by one of them")
+	cmd.Flags().StringVar(&sshAllowedSigners, "ssh-allowed-signers", "", "allowed signers file of the trusted ssh keys, the checked out tag or commit must be signed by one of them")
+	cmd.Flags().StringVar(&moduleRef, "module-ref", "", "git repo recorded in the moduleRef of the generated Module Definition, defaults to the git origin of the source")
 
 	return cmd
 }
 
 func (o *GenModuleOptions) Complete(f cmdutil.Factory, cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("you must specify the name of the module to generate Module Definition")
+	if o.Filename != "" {
+		if len(args) != 0 {
+			return fmt.Errorf("the names of the modules are taken from the manifest file, you must not specify a name with --filename")
+		}
+
+		if o.Discover {
+			return fmt.Errorf("--discover can't be used with --filename")
+		}
+
+		var err error
+		o.Manifest, err = loadModuleManifest(o.Filename)
+		if err != nil {
+			return err
+		}
+	} else if len(args) == 0 {
+		if !o.Discover {
+			return fmt.Errorf("you must specify the name of the module to generate Module Definition")
+		}
 	} else if len(args) != 1 {
 		return fmt.Errorf("you must specify only the name of the module to generate Module Definition")
+	} else {
+		o.ModuleDefName = args[0]
 	}
 
 	o.BuilderArgs = args
 
 	o.NewBuilder = f.NewBuilder
 
-	return nil
-}
+	if err := o.completeToken(); err != nil {
+		return err
+	}
+
+	if o.CredSecret != "" || (o.Manifest != nil && o.Manifest.needsKubeClient()) {
+		var err error
+		o.KubeClient, err = f.KubernetesClientSet()
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.Apply && o.DryRun != DryRunClient {
+		var err error
+		o.DynamicClient, err = f.DynamicClient()
+		if err != nil {
+			return err
+		}
+		o.Mapper, err = f.ToRESTMapper()
+		if err != nil {
+			return err
+		}
+	}
 
-func (o *GenModuleOptions) Validate(args []string) error {
 	return nil
 }
 
-func (o *GenModuleOptions) Run() error {
-	err := generateModuleTRD(o.Source, o.ModuleDefName, o.ProviderName, o.ProviderSource, o.Directory, o.Token, o.Apply, o.GenSecretNamespace, o.Ref)
-	if err != nil {
-		return err
+// completeToken reads the token from the environment variable or the file, if given
+func (o *GenModuleOptions) completeToken() error {
+	given := 0
+	for _, v := range []string{o.Token, o.TokenEnv, o.TokenFile} {
+		if v != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return fmt.Errorf("only one of --token, --token-env and --token-file can be given")
+	}
+
+	switch {
+	case o.TokenEnv != "":
+		o.Token = os.Getenv(o.TokenEnv)
+		if o.Token == "" {
+			return fmt.Errorf("environment variable %s of --token-env is empty", o.TokenEnv)
+		}
+	case o.TokenFile != "":
+		data, err := os.ReadFile(o.TokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read --token-file: %v", err)
+		}
+		o.Token = strings.TrimSpace(string(data))
+		if o.Token == "" {
+			return fmt.Errorf("token file %s is empty", o.TokenFile)
+		}
 	}
 
 	return nil
 }
 
-func generateModuleTRD(source, moduleDefName, providerName, providerSource, directory, token string, apply bool, credSecretNamespace, ref string) error {
-	modifiedUrl, err := url.Parse(source)
-	if err != nil {
-		return err
+func (o *GenModuleOptions) Validate(args []string) error {
+	switch o.DryRun {
+	case DryRunNone:
+	case DryRunClient, DryRunServer:
+		if !o.Apply {
+			return fmt.Errorf("--dry-run=%s requires --apply", o.DryRun)
+		}
+	default:
+		return fmt.Errorf(`invalid --dry-run %q, must be one of "none", "server" or "client"`, o.DryRun)
 	}
-	source = modifiedUrl.Host + modifiedUrl.Path
-	sourceSlice := strings.Split(source, "/")
-	if len(sourceSlice) == 0 {
-		return fmt.Errorf("given github repo source link is invalid")
+	if o.Parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
 	}
-	repoName := sourceSlice[len(sourceSlice)-1]
-	hostName := sourceSlice[0]
-
-	path := filepath.Join("/tmp", moduleDefName)
-	err = createGitRepoTempPath(path)
-	if err != nil {
+	if err := o.signatureVerifier().validate(); err != nil {
 		return err
 	}
 
-	src := source
-	var credSecretName string
-	secretObj := corev1.Secret{}
+	return o.gitAuth().validate()
+}
 
-	if token != "" {
-		// for bitbucket token need to be in the format of "username:app-password"
-		// for github and gitlab it's only the personal access token
-		if strings.Contains(hostName, "github.com") || strings.Contains(hostName, "bitbucket.org") {
-			src = "https://" + token + "@" + src + ".git"
-		} else if strings.Contains(hostName, "gitlab.com") {
-			src = "https://oauth2:" + token + "@" + src + ".git"
-		}
+func (o *GenModuleOptions) gitAuth() *gitAuth {
+	hostTypes := make(map[string]string, len(o.GitHostTypes))
+	for host, typ := range o.GitHostTypes {
+		hostTypes[strings.ToLower(host)] = typ
+	}
 
-		credSecretName = moduleDefName + "-git-cred"
+	return &gitAuth{
+		Token:      o.Token,
+		Username:   o.Username,
+		Password:   o.Password,
+		SSHKey:     o.SSHKey,
+		KnownHosts: o.KnownHosts,
+		HostTypes:  hostTypes,
+	}
+}
 
-		secretObj = corev1.Secret{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Secret",
-				APIVersion: corev1.SchemeGroupVersion.String(),
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      credSecretName,
-				Namespace: credSecretNamespace,
-			},
-			Data: map[string][]byte{
-				"token": []byte(token),
-			},
-		}
-	} else {
-		src = "https://" + src + ".git"
+func (o *GenModuleOptions) signatureVerifier() *signatureVerifier {
+	return &signatureVerifier{
+		GPGKeyring:        o.GPGKeyring,
+		SSHAllowedSigners: o.SSHAllowedSigners,
 	}
+}
 
-	repoPath := filepath.Join(path, repoName)
-	err = gitRepoClone(path, src, repoPath)
+func (o *GenModuleOptions) Run() error {
+	if o.Manifest != nil {
+		return o.runBatch()
+	}
+
+	err := o.generateModuleTRD()
 	if err != nil {
-		return err
+		return errors.New(redact(err.Error(), o.Token, o.Password))
 	}
 
-	err = checkGitRef(repoPath, ref)
+	return nil
+}
+
+func (o *GenModuleOptions) generateModuleTRD() error {
+	fetched, err := fetchModule(o.Source, o.gitAuth(), o.Ref, o.Version)
 	if err != nil {
 		return err
 	}
+	defer fetched.Close()
 
-	if tfconfig.IsModuleDir(repoPath) {
-		module, diag := tfconfig.LoadModule(repoPath)
-		if diag.HasErrors() {
-			return diag.Err()
-		}
+	if o.Discover {
+		return o.generateDiscovered(fetched)
+	}
 
-		variables := module.Variables
-		outputs := module.Outputs
+	return o.generateModule(o.ModuleDefName, fetched)
+}
 
-		var varKeys []string
-		for k := range variables {
-			varKeys = append(varKeys, k)
-		}
+// generateModule generates the Module Definition of the fetched module
+func (o *GenModuleOptions) generateModule(moduleDefName string, fetched *fetchedModule) error {
+	source, directory, credSecretNamespace := o.Source, o.Directory, o.GenSecretNamespace
+	auth := o.gitAuth()
+
+	var err error
+	repoPath := fetched.Dir
+	gitRef := fetched.GitRef
+	if o.ModuleRef != "" {
+		gitRef = o.ModuleRef
+	}
 
-		var outKeys []string
-		for k := range outputs {
-			outKeys = append(outKeys, k)
+	// nothing is generated from a module that isn't signed by a trusted key
+	var signer *moduleSigner
+	if verifier := o.signatureVerifier(); verifier.enabled() {
+		signer, err = verifier.verify(fetched)
+		if err != nil {
+			return err
 		}
+	}
+
+	var credRef *apiv1.ObjectReference
+	var secretObj *corev1.Secret
 
-		input, required, err := processInput(varKeys, variables)
+	switch {
+	case o.CredSecret != "":
+		// the secret is managed elsewhere, nothing is generated for it
+		credRef, err = o.existingCredSecret(auth, fetched)
 		if err != nil {
 			return err
 		}
-		output, err := processOutput(outKeys, outputs)
+	case fetched.Git:
+		secretObj, err = auth.credSecret(moduleDefName+"-git-cred", credSecretNamespace, fetched.GitRef)
 		if err != nil {
 			return err
 		}
-
-		jsonSchemaProps := v1.JSONSchemaProps{
-			Type: "object",
-			Properties: map[string]v1.JSONSchemaProps{
-				"input": {
-					Type:       "object",
-					Properties: input,
-					Required:   required,
-				},
-				"output": {
-					Type:       "object",
-					Properties: output,
-				},
-			},
-			Required: []string{
-				"input",
-			},
+		if secretObj != nil {
+			credRef = &apiv1.ObjectReference{
+				Namespace: secretObj.Namespace,
+				Name:      secretObj.Name,
+			}
 		}
+	}
 
-		modObj := v1alpha1.ModuleDefinition{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "ModuleDefinition",
-				APIVersion: v1alpha1.GroupVersion.String(),
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name: moduleDefName,
-			},
-			Spec: v1alpha1.ModuleDefinitionSpec{
-				Schema: jsonSchemaProps,
-				ModuleRef: v1alpha1.ModuleRef{
-					Git: v1alpha1.Git{
-						Ref: source,
-					},
-				},
-				Provider: v1alpha1.Provider{
-					Name:   providerName,
-					Source: providerSource,
-				},
-			},
-		}
+	modObj, extensions, err := buildModuleDefinition(moduleDefName, repoPath, o.ProviderName, o.ProviderSource, o.SkipUntranslatableValidations)
+	if err != nil {
+		return err
+	}
+	modObj.Spec.ModuleRef.Git.Ref = gitRef
 
-		var secretYaml []byte
-		if credSecretName != "" {
-			modObj.Spec.ModuleRef.Git.Cred = &apiv1.ObjectReference{
-				Namespace: credSecretNamespace,
-				Name:      credSecretName,
-			}
+	if err := setProvenanceAnnotations(modObj, fetched); err != nil {
+		return err
+	}
+	if signer != nil {
+		setSignerAnnotations(modObj, signer)
+	}
 
-			secretYaml, err = yaml.Marshal(secretObj)
-			if err != nil {
-				return err
-			}
-		}
-		if ref != "" {
-			modObj.Spec.ModuleRef.Git.CheckOut = &ref
-		}
+	modObj.Spec.ModuleRef.Git.Cred = credRef
 
-		modYml, err := yaml.Marshal(modObj)
+	var secretYaml []byte
+	if secretObj != nil {
+		secretYaml, err = yaml.Marshal(secretObj)
 		if err != nil {
 			return err
 		}
+	}
+	if fetched.CheckOut != "" {
+		modObj.Spec.ModuleRef.Git.CheckOut = &fetched.CheckOut
+	}
+	if gitRef == "" {
+		fmt.Fprintf(o.Out, "module source %s has no git origin, set spec.moduleRef.git.ref of the Module Definition to the git repository of the module or regenerate it with --module-ref\n", source)
+	}
+
+	modYml, err := marshalModuleDefinition(modObj, extensions)
+	if err != nil {
+		return err
+	}
 
-		modDefYamlPath := filepath.Join(directory, moduleDefName+".yaml")
-		err = os.WriteFile(modDefYamlPath, modYml, 0o774)
+	modDefYamlPath := filepath.Join(directory, moduleDefName+".yaml")
+	err = os.WriteFile(modDefYamlPath, modYml, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if secretObj != nil {
+		secretYamlPath := filepath.Join(directory, secretObj.Name+".yaml")
+		err = writeSecretFile(secretYamlPath, secretYaml)
 		if err != nil {
 			return err
 		}
+	}
 
-		var secretYamlPath string
-		if credSecretName != "" {
-			secretYamlPath = filepath.Join(directory, credSecretName+".yaml")
-			err = os.WriteFile(secretYamlPath, secretYaml, 0o774)
-			if err != nil {
-				return err
-			}
+	if o.Apply {
+		if gitRef == "" {
+			return fmt.Errorf("can't apply Module Definition %s without a git ref, use --module-ref to specify the git repository of the module", moduleDefName)
 		}
 
-		if apply {
-			if err := yamlsApply(modDefYamlPath); err != nil {
-				return err
-			}
-
-			if credSecretName != "" {
-				if err = yamlsApply(secretYamlPath); err != nil {
-					return err
-				}
-			}
+		a := &applier{
+			out:            o.Out,
+			client:         o.DynamicClient,
+			mapper:         o.Mapper,
+			dryRun:         o.DryRun,
+			forceConflicts: o.ForceConflicts,
 		}
-
-		return nil
-	}
-
-	return fmt.Errorf("no terraform configuration file is found in the path : %v\n", path)
-}
-
-func createGitRepoTempPath(path string) error {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(path, 0o777)
-		if err != nil {
+		// the secret first, the module operator clones the repository as soon as the
+		// Module Definition shows up
+		manifests := [][]byte{modYml}
+		if secretObj != nil {
+			manifests = [][]byte{secretYaml, modYml}
+		}
+		if err := a.apply(manifests...); err != nil {
 			return err
 		}
 	}
@@ -322,40 +456,148 @@ func createGitRepoTempPath(path string) error {
 	return nil
 }
 
-func gitRepoClone(path, src, repoPath string) error {
-	_, err := os.Stat(repoPath)
-	if os.IsNotExist(err) {
-		cmd := exec.Command("git", "clone", src)
-		cmd.Dir = path
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return err
-		}
+// buildModuleDefinition generates the Module Definition of the module in dir, only the schema and
+// the provider are filled in
+func buildModuleDefinition(name, dir, providerName, providerSource string, skipUntranslatable bool) (*v1alpha1.ModuleDefinition, schemaExtensions, error) {
+	if !tfconfig.IsModuleDir(dir) {
+		return nil, nil, fmt.Errorf("no terraform configuration file is found in the path : %v\n", dir)
 	}
 
-	return nil
+	module, err := loadModule(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	variables := module.Variables
+	outputs := module.Outputs
+
+	var varKeys []string
+	for k := range variables {
+		varKeys = append(varKeys, k)
+	}
+	sort.Strings(varKeys)
+
+	var outKeys []string
+	for k := range outputs {
+		outKeys = append(outKeys, k)
+	}
+	sort.Strings(outKeys)
+
+	files, err := parseModuleFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validations, err := loadVariableValidations(files, skipUntranslatable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values, err := loadOutputValues(files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, err := detectProvider(module, providerName, providerSource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	input, required, extensions, err := processInput(varKeys, variables, validations, skipUntranslatable)
+	if err != nil {
+		return nil, nil, err
+	}
+	output, err := processOutput(outKeys, outputs, values, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jsonSchemaProps := v1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]v1.JSONSchemaProps{
+			"input": {
+				Type:       "object",
+				Properties: input,
+				Required:   required,
+			},
+			"output": {
+				Type:       "object",
+				Properties: output,
+			},
+		},
+		Required: []string{
+			"input",
+		},
+	}
+
+	modObj := &v1alpha1.ModuleDefinition{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ModuleDefinition",
+			APIVersion: v1alpha1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: v1alpha1.ModuleDefinitionSpec{
+			Schema: jsonSchemaProps,
+			Provider: v1alpha1.Provider{
+				Name:   provider.Name,
+				Source: provider.Source,
+			},
+		},
+	}
+
+	if len(provider.VersionConstraints) > 0 {
+		metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, ProviderVersionConstraintsAnnotation, strings.Join(provider.VersionConstraints, ", "))
+	}
+	if provider.LockedVersion != "" {
+		metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, ProviderLockedVersionAnnotation, provider.LockedVersion)
+	}
+
+	return modObj, extensions, nil
 }
 
-func checkGitRef(path, ref string) error {
-	if ref == "" {
-		return nil
+// existingCredSecret checks that the git cred secret given with --cred-secret can be used to
+// clone the repository of the module
+func (o *GenModuleOptions) existingCredSecret(auth *gitAuth, fetched *fetchedModule) (*apiv1.ObjectReference, error) {
+	namespace, name := o.GenSecretNamespace, o.CredSecret
+	if parts := strings.SplitN(o.CredSecret, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid --cred-secret %q, must be namespace/name", o.CredSecret)
 	}
 
-	cmd := exec.Command("git", "checkout", ref)
-	cmd.Dir = path
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	secret, err := o.KubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git cred secret %s/%s: %v", namespace, name, err)
+	}
+
+	host, _ := splitGitRepo(fetched.GitRef)
+	if err := validateCredSecret(secret, host, auth.hostType(host), fetched.SSH); err != nil {
+		return nil, err
+	}
+
+	return &apiv1.ObjectReference{
+		Namespace: namespace,
+		Name:      name,
+	}, nil
+}
+
+// writeSecretFile writes the file readable by the owner only, tightening the permissions of
+// an existing file as well
+func writeSecretFile(filename string, data []byte) error {
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Chmod(filename, 0o600)
 }
 
-func processInput(keys []string, variables map[string]*tfconfig.Variable) (map[string]v1.JSONSchemaProps, []string, error) {
+func processInput(keys []string, variables map[string]*tfconfig.Variable, validations map[string][]variableValidation, skipUntranslatable bool) (map[string]v1.JSONSchemaProps, []string, schemaExtensions, error) {
 	mp := map[string]v1.JSONSchemaProps{}
 	var required []string
+	extensions := schemaExtensions{}
 
 	for _, key := range keys {
 		variable := variables[key]
@@ -368,180 +610,55 @@ func processInput(keys []string, variables map[string]*tfconfig.Variable) (map[s
 	for _, key := range keys {
 		variable := variables[key]
 
-		if variable.Type == "" || variable.Type == "any" {
-			mp[key] = v1.JSONSchemaProps{
-				Description: variable.Description,
-				AnyOf: []v1.JSONSchemaProps{
-					{
-						Type: Number,
-					},
-					{
-						Type: String,
-					},
-					{
-						Type: "object",
-					},
-				},
-			}
-		} else if variable.Type == Number {
-			mp[key] = v1.JSONSchemaProps{
-				Type:        Number,
-				Description: variable.Description,
-			}
-		} else if variable.Type == String {
-			mp[key] = v1.JSONSchemaProps{
-				Type:        String,
-				Description: variable.Description,
-			}
-		} else if variable.Type == Bool {
-			mp[key] = v1.JSONSchemaProps{
-				Type:        "boolean",
-				Description: variable.Description,
-			}
-		} else if strings.Contains(variable.Type, "list") || strings.Contains(variable.Type, "set") {
-			typ := strings.FieldsFunc(variable.Type, func(r rune) bool {
-				return r == '(' || r == ')'
-			})
-
-			if len(typ) == 1 {
-				mp[key] = v1.JSONSchemaProps{
-					Type:        "array",
-					Description: variable.Description,
-					Items: &v1.JSONSchemaPropsOrArray{
-						Schema: &v1.JSONSchemaProps{
-							AnyOf: []v1.JSONSchemaProps{
-								{
-									Type: Number,
-								},
-								{
-									Type: String,
-								},
-								{
-									Type: "object",
-								},
-							},
-						},
-					},
-				}
-			} else if typ[1] == Bool {
-				mp[key] = v1.JSONSchemaProps{
-					Type:        "array",
-					Description: variable.Description,
-					Items: &v1.JSONSchemaPropsOrArray{
-						Schema: &v1.JSONSchemaProps{
-							Type: "boolean",
-						},
-					},
-				}
-			} else if typ[1] == Number {
-				mp[key] = v1.JSONSchemaProps{
-					Type:        "array",
-					Description: variable.Description,
-					Items: &v1.JSONSchemaPropsOrArray{
-						Schema: &v1.JSONSchemaProps{
-							Type: Number,
-						},
-					},
-				}
-			} else if typ[1] == String {
-				mp[key] = v1.JSONSchemaProps{
-					Type:        "array",
-					Description: variable.Description,
-					Items: &v1.JSONSchemaPropsOrArray{
-						Schema: &v1.JSONSchemaProps{
-							Type: String,
-						},
-					},
-				}
+		prop, err := parseTypeExpr(variable.Type)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("not supported variable, name: %s and type: %s, reason: %v", variable.Name, variable.Type, err)
+		}
+		prop.Description = variable.Description
+
+		if !variable.Required {
+			if variable.Default == nil {
+				// `default = null`, the module handles the absence of the value itself
+				prop.Nullable = true
 			} else {
-				return nil, nil, fmt.Errorf("not supported vairable, name: %s and type: %s\n", variable.Name, variable.Type)
-			}
-		} else if strings.Contains(variable.Type, "map") {
-			typ := strings.FieldsFunc(variable.Type, func(r rune) bool {
-				return r == '(' || r == ')'
-			})
-
-			if typ[1] == Bool {
-				mp[key] = v1.JSONSchemaProps{
-					Type:        "object",
-					Description: variable.Description,
-					AdditionalProperties: &v1.JSONSchemaPropsOrBool{
-						Schema: &v1.JSONSchemaProps{
-							Type: "boolean",
-						},
-					},
-				}
-			} else if typ[1] == Number {
-				mp[key] = v1.JSONSchemaProps{
-					Type:        "object",
-					Description: variable.Description,
-					AdditionalProperties: &v1.JSONSchemaPropsOrBool{
-						Schema: &v1.JSONSchemaProps{
-							Type: Number,
-						},
-					},
+				prop.Default, err = defaultJSON(prop, variable.Default)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("invalid default value of variable %s: %v", variable.Name, err)
 				}
-			} else if typ[1] == String {
-				mp[key] = v1.JSONSchemaProps{
-					Type:        "object",
-					Description: variable.Description,
-					AdditionalProperties: &v1.JSONSchemaPropsOrBool{
-						Schema: &v1.JSONSchemaProps{
-							Type: String,
-						},
-					},
-				}
-			} else {
-				return nil, nil, fmt.Errorf("not supported vairable, name: %s and type: %s\n", variable.Name, variable.Type)
 			}
-		} else {
-			return nil, nil, fmt.Errorf("not supported vairable, name: %s and type: %s\n", variable.Name, variable.Type)
 		}
-	}
 
-	return mp, required, nil
-}
+		if variable.Sensitive {
+			extensions.set(key, SensitiveExtension, true)
+		}
 
-func processOutput(keys []string, outputs map[string]*tfconfig.Output) (map[string]v1.JSONSchemaProps, error) {
-	if len(keys) == 0 {
-		return nil, fmt.Errorf("no output is defined in the module path")
+		if err := applyValidations(key, prop, validations[key], extensions, skipUntranslatable); err != nil {
+			return nil, nil, nil, err
+		}
+
+		mp[key] = *prop
 	}
 
+	return mp, required, extensions, nil
+}
+
+func processOutput(keys []string, outputs map[string]*tfconfig.Output, values map[string]hclsyntax.Expression, inputs map[string]v1.JSONSchemaProps) (map[string]v1.JSONSchemaProps, error) {
 	mp := make(map[string]v1.JSONSchemaProps)
 
 	for _, key := range keys {
 		output := outputs[key]
 
-		mp[key] = v1.JSONSchemaProps{
-			Description: output.Description,
-			AnyOf: []v1.JSONSchemaProps{
-				{
-					Type: Number,
-				},
-				{
-					Type: String,
-				},
-				{
-					Type: "boolean",
-				},
-				{
-					Type: "object",
-				},
-			},
+		prop := outputTypeHint(output.Description)
+		if prop == nil && values[key] != nil {
+			prop = inferOutputSchema(values[key], inputs)
+		}
+		if prop == nil {
+			prop = anySchema()
 		}
+		prop.Description = output.Description
+
+		mp[key] = *prop
 	}
 
 	return mp, nil
 }
-
-func yamlsApply(filePath string) error {
-	cmd := exec.Command("kubectl", "apply", "-f", filePath)
-	cmd.Dir = filePath
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,133 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const gitGetter = "git"
+
+var (
+	// forcedGetterRegex matches the forced getter prefix of a source, e.g. git::https://example.com/repo.git
+	forcedGetterRegex = regexp.MustCompile(`^([A-Za-z0-9]+)::(.+)$`)
+	// scpLikeRegex matches the scp like syntax of git ssh urls, e.g. git@github.com:org/repo.git
+	scpLikeRegex = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+)
+
+// getterSource is a module source in the go-getter syntax used by terraform, i.e.
+// [<getter>::]<address>[//<subdir>][?ref=<ref>&depth=<depth>]
+type getterSource struct {
+	// Getter is the forced getter, e.g. git for git::https://example.com/repo.git
+	Getter string
+	// Address of the package holding the module, without the subdirectory, ref and depth
+	Address string
+	// Subdir is the directory of the module inside the package
+	Subdir string
+	Ref    string
+	Depth  int
+}
+
+func parseGetterSource(source string) (*getterSource, error) {
+	s := &getterSource{}
+
+	if m := forcedGetterRegex.FindStringSubmatch(source); m != nil {
+		s.Getter, source = m[1], m[2]
+		if s.Getter != gitGetter {
+			return nil, fmt.Errorf("getter %q of module source %q is not supported, only %s:: can be forced", s.Getter, source, gitGetter)
+		}
+	}
+
+	source, subdir := splitSubdir(source)
+	if subdir != "" {
+		subdir = path.Clean(subdir)
+		if path.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+			return nil, fmt.Errorf("subdirectory %q of module source %q is outside of the package", subdir, source)
+		}
+		if subdir != "." {
+			s.Subdir = subdir
+		}
+	}
+
+	if i := strings.Index(source, "?"); i >= 0 {
+		query, err := url.ParseQuery(source[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid query of module source %q: %v", source, err)
+		}
+		source = source[:i]
+
+		s.Ref = query.Get("ref")
+		query.Del("ref")
+		if depth := query.Get("depth"); depth != "" {
+			s.Depth, err = strconv.Atoi(depth)
+			if err != nil || s.Depth < 0 {
+				return nil, fmt.Errorf("invalid depth %q of module source %q", depth, source)
+			}
+		}
+		query.Del("depth")
+
+		if len(query) > 0 {
+			source += "?" + query.Encode()
+		}
+	}
+	s.Address = source
+
+	return s, nil
+}
+
+// splitSubdir splits the //subdir part off the source, keeping the query, if any, in the
+// returned source. The // of the url scheme is not a subdirectory separator.
+func splitSubdir(source string) (string, string) {
+	stop := len(source)
+	if i := strings.Index(source, "?"); i >= 0 {
+		stop = i
+	}
+
+	offset := 0
+	if i := strings.Index(source[:stop], "://"); i >= 0 {
+		offset = i + len("://")
+	}
+
+	i := strings.Index(source[offset:stop], "//")
+	if i < 0 {
+		return source, ""
+	}
+	i += offset
+
+	src, subdir := source[:i], source[i+len("//"):]
+	if j := strings.Index(subdir, "?"); j >= 0 {
+		src += subdir[j:]
+		subdir = subdir[:j]
+	}
+
+	return src, subdir
+}
+
+// isSSHGitURL tells whether the git url is cloned over ssh, in which case the credentials are
+// taken from the ssh agent instead of the token
+func isSSHGitURL(source string) bool {
+	if scpLikeRegex.MatchString(source) {
+		return true
+	}
+	u, err := url.Parse(source)
+	return err == nil && (u.Scheme == "ssh" || u.Scheme == "git+ssh")
+}
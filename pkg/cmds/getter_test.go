@@ -0,0 +1,173 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGetterSource(t *testing.T) {
+	cases := []struct {
+		source string
+		want   *getterSource
+		err    bool
+	}{
+		{
+			source: "github.com/org/repo",
+			want:   &getterSource{Address: "github.com/org/repo"},
+		},
+		{
+			source: "git::https://host/org/repo.git//modules/vpc?ref=v1.2.0",
+			want:   &getterSource{Getter: "git", Address: "https://host/org/repo.git", Subdir: "modules/vpc", Ref: "v1.2.0"},
+		},
+		{
+			source: "https://gitlab.com/group/subgroup/repo.git?ref=main&depth=1",
+			want:   &getterSource{Address: "https://gitlab.com/group/subgroup/repo.git", Ref: "main", Depth: 1},
+		},
+		{
+			source: "gitlab.com/group/subgroup/repo//modules/db",
+			want:   &getterSource{Address: "gitlab.com/group/subgroup/repo", Subdir: "modules/db"},
+		},
+		{
+			source: "git@github.com:org/repo.git//modules/vpc?ref=v1",
+			want:   &getterSource{Address: "git@github.com:org/repo.git", Subdir: "modules/vpc", Ref: "v1"},
+		},
+		{
+			source: "git::ssh://git@example.com/org/repo.git",
+			want:   &getterSource{Getter: "git", Address: "ssh://git@example.com/org/repo.git"},
+		},
+		{
+			source: "https://example.com/vpc.tar.gz?archive=tgz&ref=v1",
+			want:   &getterSource{Address: "https://example.com/vpc.tar.gz?archive=tgz", Ref: "v1"},
+		},
+		{
+			source: "https://example.com/repo//modules/a/../b",
+			want:   &getterSource{Address: "https://example.com/repo", Subdir: "modules/b"},
+		},
+		{
+			source: "https://example.com/repo//.",
+			want:   &getterSource{Address: "https://example.com/repo"},
+		},
+		{
+			source: "./modules/vpc",
+			want:   &getterSource{Address: "./modules/vpc"},
+		},
+		{
+			source: "terraform-aws-modules/vpc/aws//modules/endpoints",
+			want:   &getterSource{Address: "terraform-aws-modules/vpc/aws", Subdir: "modules/endpoints"},
+		},
+		{source: "s3::https://s3.amazonaws.com/bucket/vpc.zip", err: true},
+		{source: "https://example.com/repo//../other", err: true},
+		{source: "https://example.com/repo?depth=-1", err: true},
+		{source: "https://example.com/repo?depth=shallow", err: true},
+		{source: "https://example.com/repo?ref=%zz", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.source, func(t *testing.T) {
+			got, err := parseGetterSource(c.source)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestSplitSubdir(t *testing.T) {
+	cases := []struct {
+		source string
+		src    string
+		subdir string
+	}{
+		{source: "https://example.com/repo", src: "https://example.com/repo"},
+		{source: "https://example.com/repo//dir", src: "https://example.com/repo", subdir: "dir"},
+		{source: "https://example.com/repo//dir?ref=v1", src: "https://example.com/repo?ref=v1", subdir: "dir"},
+		{source: "https://example.com/repo?u=http://x//y", src: "https://example.com/repo?u=http://x//y"},
+		{source: "file:///tmp/repo//dir/sub", src: "file:///tmp/repo", subdir: "dir/sub"},
+		{source: "github.com/org/repo//dir", src: "github.com/org/repo", subdir: "dir"},
+	}
+
+	for _, c := range cases {
+		src, subdir := splitSubdir(c.source)
+		if src != c.src || subdir != c.subdir {
+			t.Errorf("%s: expected (%q, %q), got (%q, %q)", c.source, c.src, c.subdir, src, subdir)
+		}
+	}
+}
+
+func TestSubdirRef(t *testing.T) {
+	cases := []struct {
+		ref  string
+		dir  string
+		want string
+	}{
+		{ref: "github.com/org/repo", dir: "modules/vpc", want: "github.com/org/repo//modules/vpc"},
+		{ref: "https://github.com/org/repo", dir: "modules/vpc", want: "https://github.com/org/repo//modules/vpc"},
+		{ref: "github.com/org/repo//modules", dir: "vpc", want: "github.com/org/repo//modules/vpc"},
+	}
+
+	for _, c := range cases {
+		if got := subdirRef(c.ref, c.dir); got != c.want {
+			t.Errorf("subdirRef(%q, %q): expected %q, got %q", c.ref, c.dir, c.want, got)
+		}
+	}
+}
+
+func TestIsSSHGitURL(t *testing.T) {
+	cases := map[string]bool{
+		"git@github.com:org/repo.git":        true,
+		"ssh://git@example.com/org/repo.git": true,
+		"git+ssh://git@example.com/org/repo": true,
+		"https://github.com/org/repo.git":    false,
+		"github.com/org/repo":                false,
+		"https://user@example.com:8443/repo": false,
+		"file:///tmp/repo":                   false,
+	}
+
+	for source, want := range cases {
+		if got := isSSHGitURL(source); got != want {
+			t.Errorf("%s: expected %v, got %v", source, want, got)
+		}
+	}
+}
+
+func TestNormalizeGitURL(t *testing.T) {
+	cases := map[string]string{
+		"https://github.com/org/repo.git":         "github.com/org/repo",
+		"https://gitlab.com/group/subgroup/repo":  "gitlab.com/group/subgroup/repo",
+		"git@github.com:org/repo.git":             "github.com/org/repo",
+		"ssh://git@example.com:2222/org/repo.git": "example.com:2222/org/repo",
+		"git@example.com:/srv/repo.git":           "example.com/srv/repo",
+		"/srv/git/repo.git":                       "",
+	}
+
+	for remote, want := range cases {
+		if got := normalizeGitURL(remote); got != want {
+			t.Errorf("%s: expected %q, got %q", remote, want, got)
+		}
+	}
+}
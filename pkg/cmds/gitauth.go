@@ -0,0 +1,329 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	GitHostGitHub      = "github"
+	GitHostGitLab      = "gitlab"
+	GitHostBitbucket   = "bitbucket"
+	GitHostGitea       = "gitea"
+	GitHostAzureDevOps = "azure-devops"
+	GitHostGeneric     = "generic"
+
+	// GitCredTokenKey holds the personal access token in the git credential secret
+	GitCredTokenKey = "token"
+	// GitCredKnownHostsKey holds the known_hosts file in the ssh git credential secret
+	GitCredKnownHostsKey = "known_hosts"
+)
+
+var gitHostTypes = []string{GitHostGitHub, GitHostGitLab, GitHostBitbucket, GitHostGitea, GitHostAzureDevOps, GitHostGeneric}
+
+// gitAuth holds the credentials used to clone private module repositories
+type gitAuth struct {
+	// Token is the personal access token, for bitbucket in the format of "username:app-password"
+	Token    string
+	Username string
+	Password string
+	// SSHKey is the path of the private key used to clone over ssh, e.g. a deploy key
+	SSHKey string
+	// KnownHosts is the path of the known_hosts file used to verify the ssh host key
+	KnownHosts string
+	// HostTypes maps the hostname of self-hosted git servers onto their type, the public
+	// ones are detected from the hostname
+	HostTypes map[string]string
+}
+
+func (a *gitAuth) validate() error {
+	for host, typ := range a.HostTypes {
+		if !contains(gitHostTypes, typ) {
+			return fmt.Errorf("unknown type %q of git host %s, supported types: %s", typ, host, strings.Join(gitHostTypes, ", "))
+		}
+	}
+
+	if a.Password != "" && a.Username == "" {
+		return fmt.Errorf("--password requires --username")
+	}
+	if a.SSHKey != "" && (a.Token != "" || a.Password != "") {
+		return fmt.Errorf("--ssh-key can't be used together with --token or --password")
+	}
+	if a.Token != "" && a.Password != "" {
+		return fmt.Errorf("--token can't be used together with --password")
+	}
+	if a.KnownHosts != "" && a.SSHKey == "" {
+		return fmt.Errorf("--known-hosts requires --ssh-key")
+	}
+
+	return nil
+}
+
+// hostType returns the type of the git host, configured or detected from the hostname
+func (a *gitAuth) hostType(host string) string {
+	host = strings.ToLower(host)
+	if typ, found := a.HostTypes[host]; found {
+		return typ
+	}
+
+	switch {
+	case host == "github.com":
+		return GitHostGitHub
+	case host == "gitlab.com":
+		return GitHostGitLab
+	case host == "bitbucket.org":
+		return GitHostBitbucket
+	case host == "dev.azure.com" || host == "ssh.dev.azure.com" || strings.HasSuffix(host, ".visualstudio.com"):
+		return GitHostAzureDevOps
+	}
+
+	return GitHostGeneric
+}
+
+// archiveToken returns the token sent along the download of an archive, if any. The token is
+// meant for the git host, so it is only sent over https to a git host known by its name or
+// configured with --git-host-type.
+func (a *gitAuth) archiveToken(u *url.URL) string {
+	if a.Token == "" || u.Scheme != "https" {
+		return ""
+	}
+	host := strings.ToLower(u.Host)
+	if _, found := a.HostTypes[host]; !found && a.hostType(host) == GitHostGeneric {
+		return ""
+	}
+
+	return a.Token
+}
+
+// credentials returns the username and password git sends to the host over https
+func (a *gitAuth) credentials(hostType string) (string, string, bool) {
+	switch {
+	case a.Password != "":
+		return a.Username, a.Password, true
+	case a.Token == "":
+		return "", "", false
+	case a.Username != "":
+		return a.Username, a.Token, true
+	}
+
+	switch hostType {
+	case GitHostGitLab:
+		return "oauth2", a.Token, true
+	case GitHostBitbucket:
+		if parts := strings.SplitN(a.Token, ":", 2); len(parts) == 2 {
+			return parts[0], parts[1], true
+		}
+		return "x-token-auth", a.Token, true
+	case GitHostAzureDevOps:
+		// azure devops ignores the username of a personal access token
+		return "pat", a.Token, true
+	case GitHostGitea:
+		return a.Token, "x-oauth-basic", true
+	case GitHostGeneric:
+		if parts := strings.SplitN(a.Token, ":", 2); len(parts) == 2 {
+			return parts[0], parts[1], true
+		}
+	}
+
+	return "x-access-token", a.Token, true
+}
+
+// cloneURL returns the url the repository, given as host/path, is cloned from. It never holds
+// the credentials, they are given by transportAuth.
+func (a *gitAuth) cloneURL(repo string) string {
+	host, repoPath := splitGitRepo(repo)
+	hostType := a.hostType(host)
+
+	if a.SSHKey != "" {
+		if hostType == GitHostAzureDevOps {
+			// dev.azure.com/org/project/_git/repo is cloned from ssh.dev.azure.com:v3/org/project/repo
+			return "git@ssh.dev.azure.com:v3/" + strings.Replace(repoPath, "/_git/", "/", 1)
+		}
+		return "git@" + host + ":" + repoPath + ".git"
+	}
+
+	u := url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   "/" + repoPath,
+	}
+	if hostType != GitHostAzureDevOps {
+		u.Path += ".git"
+	}
+
+	return u.String()
+}
+
+// transportAuth returns the credentials sent to the host of the repository, given as
+// host/path, when it is fetched from src. It returns nil if none are given, in which case
+// ssh urls are authenticated by the ssh agent.
+func (a *gitAuth) transportAuth(repo, src string) (transport.AuthMethod, error) {
+	if a.SSHKey != "" {
+		user := "git"
+		if ep, err := transport.NewEndpoint(src); err == nil && ep.User != "" {
+			user = ep.User
+		}
+		keys, err := gitssh.NewPublicKeysFromFile(user, a.SSHKey, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssh key %s: %v", a.SSHKey, err)
+		}
+		if a.KnownHosts != "" {
+			// the known_hosts of the user are used otherwise
+			keys.HostKeyCallback, err = gitssh.NewKnownHostsCallback(a.KnownHosts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read known hosts %s: %v", a.KnownHosts, err)
+			}
+		}
+		return keys, nil
+	}
+
+	host, _ := splitGitRepo(repo)
+	username, password, found := a.credentials(a.hostType(host))
+	if !found || isSSHGitURL(src) {
+		return nil, nil
+	}
+
+	return &githttp.BasicAuth{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// credSecret returns the secret the module operator uses to clone the repository of the
+// module, in the format matching the kind of the credentials. A token for a host other
+// than github is stored as the username and password git sends to the host. It returns
+// nil if no credentials are given.
+func (a *gitAuth) credSecret(name, namespace, repo string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+
+	switch {
+	case a.SSHKey != "":
+		key, err := os.ReadFile(a.SSHKey)
+		if err != nil {
+			return nil, err
+		}
+		secret.Type = corev1.SecretTypeSSHAuth
+		secret.Data = map[string][]byte{
+			corev1.SSHAuthPrivateKey: key,
+		}
+
+		if a.KnownHosts != "" {
+			knownHosts, err := os.ReadFile(a.KnownHosts)
+			if err != nil {
+				return nil, err
+			}
+			secret.Data[GitCredKnownHostsKey] = knownHosts
+		}
+	case a.Password != "":
+		secret.Type = corev1.SecretTypeBasicAuth
+		secret.Data = map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte(a.Username),
+			corev1.BasicAuthPasswordKey: []byte(a.Password),
+		}
+	case a.Token != "":
+		host, _ := splitGitRepo(repo)
+		if hostType := a.hostType(host); hostType != GitHostGitHub {
+			username, password, _ := a.credentials(hostType)
+			secret.Type = corev1.SecretTypeBasicAuth
+			secret.Data = map[string][]byte{
+				corev1.BasicAuthUsernameKey: []byte(username),
+				corev1.BasicAuthPasswordKey: []byte(password),
+			}
+			break
+		}
+		secret.Data = map[string][]byte{
+			GitCredTokenKey: []byte(a.Token),
+		}
+		if a.Username != "" {
+			secret.Data[corev1.BasicAuthUsernameKey] = []byte(a.Username)
+		}
+	default:
+		return nil, nil
+	}
+
+	return secret, nil
+}
+
+// redact replaces the secrets in the message
+func redact(msg string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			msg = strings.ReplaceAll(msg, secret, "REDACTED")
+		}
+	}
+	return msg
+}
+
+// splitGitRepo splits the repository, given as host/path, into the host and the path
+func splitGitRepo(repo string) (string, string) {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// validateCredSecret checks that the existing git cred secret holds the keys of one of the
+// formats generated by credSecret and matches the git host. A token without a username
+// is only usable with github.
+func validateCredSecret(secret *corev1.Secret, host, hostType string, ssh bool) error {
+	name := secret.Namespace + "/" + secret.Name
+	has := func(key string) bool {
+		return len(secret.Data[key]) > 0
+	}
+
+	switch {
+	case has(corev1.SSHAuthPrivateKey):
+		if !ssh {
+			klog.Warningf("git cred secret %s holds an ssh key, but the module was fetched over https", name)
+		}
+		return nil
+	case has(corev1.BasicAuthUsernameKey) && has(corev1.BasicAuthPasswordKey):
+	case has(GitCredTokenKey):
+		if hostType != GitHostGitHub && !has(corev1.BasicAuthUsernameKey) {
+			return fmt.Errorf("git cred secret %s has no %q key, the module operator can't use its token with the %s host %s", name, corev1.BasicAuthUsernameKey, hostType, host)
+		}
+	default:
+		return fmt.Errorf("git cred secret %s must hold either %q, %q or both %q and %q", name, corev1.SSHAuthPrivateKey, GitCredTokenKey, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey)
+	}
+
+	if ssh {
+		klog.Warningf("git cred secret %s holds https credentials, but the module was fetched over ssh", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,364 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGitAuthValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		auth gitAuth
+		err  bool
+	}{
+		{name: "none", auth: gitAuth{}},
+		{name: "token", auth: gitAuth{Token: "t"}},
+		{name: "token with username", auth: gitAuth{Token: "t", Username: "u"}},
+		{name: "password", auth: gitAuth{Username: "u", Password: "p"}},
+		{name: "ssh key", auth: gitAuth{SSHKey: "id", KnownHosts: "known_hosts"}},
+		{name: "host type", auth: gitAuth{HostTypes: map[string]string{"git.example.com": GitHostGitea}}},
+		{name: "unknown host type", auth: gitAuth{HostTypes: map[string]string{"git.example.com": "svn"}}, err: true},
+		{name: "password without username", auth: gitAuth{Password: "p"}, err: true},
+		{name: "ssh key and token", auth: gitAuth{SSHKey: "id", Token: "t"}, err: true},
+		{name: "ssh key and password", auth: gitAuth{SSHKey: "id", Username: "u", Password: "p"}, err: true},
+		{name: "token and password", auth: gitAuth{Token: "t", Username: "u", Password: "p"}, err: true},
+		{name: "known hosts without ssh key", auth: gitAuth{KnownHosts: "known_hosts"}, err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.auth.validate()
+			if c.err && err == nil {
+				t.Error("expected an error")
+			}
+			if !c.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGitAuthHostType(t *testing.T) {
+	auth := &gitAuth{HostTypes: map[string]string{"git.example.com": GitHostGitLab}}
+
+	cases := map[string]string{
+		"github.com":            GitHostGitHub,
+		"GitLab.com":            GitHostGitLab,
+		"bitbucket.org":         GitHostBitbucket,
+		"dev.azure.com":         GitHostAzureDevOps,
+		"ssh.dev.azure.com":     GitHostAzureDevOps,
+		"org.visualstudio.com":  GitHostAzureDevOps,
+		"Git.Example.com":       GitHostGitLab,
+		"github.example.com":    GitHostGeneric,
+		"gitlab.mycompany.test": GitHostGeneric,
+	}
+	for host, want := range cases {
+		if got := auth.hostType(host); got != want {
+			t.Errorf("%s: expected %s, got %s", host, want, got)
+		}
+	}
+}
+
+func TestGitAuthArchiveToken(t *testing.T) {
+	auth := &gitAuth{Token: "secret", HostTypes: map[string]string{"git.example.com": GitHostGitLab}}
+
+	cases := map[string]string{
+		"https://github.com/org/repo/archive/v1.tar.gz":                "secret",
+		"https://git.example.com/org/repo/-/archive/v1/repo-v1.tar.gz": "secret",
+		"http://github.com/org/repo/archive/v1.tar.gz":                 "",
+		"https://downloads.example.com/module.zip":                     "",
+		"https://github.com.example.com/module.zip":                    "",
+	}
+	for source, want := range cases {
+		u, err := url.Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := auth.archiveToken(u); got != want {
+			t.Errorf("%s: expected token %q, got %q", source, want, got)
+		}
+	}
+}
+
+func TestGitAuthCredentials(t *testing.T) {
+	cases := []struct {
+		name     string
+		auth     gitAuth
+		hostType string
+		username string
+		password string
+		found    bool
+	}{
+		{name: "none", auth: gitAuth{}, hostType: GitHostGitHub},
+		{name: "github", auth: gitAuth{Token: "t"}, hostType: GitHostGitHub, username: "x-access-token", password: "t", found: true},
+		{name: "gitlab", auth: gitAuth{Token: "t"}, hostType: GitHostGitLab, username: "oauth2", password: "t", found: true},
+		{name: "bitbucket app password", auth: gitAuth{Token: "u:p"}, hostType: GitHostBitbucket, username: "u", password: "p", found: true},
+		{name: "bitbucket access token", auth: gitAuth{Token: "t"}, hostType: GitHostBitbucket, username: "x-token-auth", password: "t", found: true},
+		{name: "azure devops", auth: gitAuth{Token: "t"}, hostType: GitHostAzureDevOps, username: "pat", password: "t", found: true},
+		{name: "gitea", auth: gitAuth{Token: "t"}, hostType: GitHostGitea, username: "t", password: "x-oauth-basic", found: true},
+		{name: "generic username:password", auth: gitAuth{Token: "u:p"}, hostType: GitHostGeneric, username: "u", password: "p", found: true},
+		{name: "generic token", auth: gitAuth{Token: "t"}, hostType: GitHostGeneric, username: "x-access-token", password: "t", found: true},
+		{name: "token with username", auth: gitAuth{Token: "t", Username: "u"}, hostType: GitHostGitLab, username: "u", password: "t", found: true},
+		{name: "password", auth: gitAuth{Username: "u", Password: "p"}, hostType: GitHostGitHub, username: "u", password: "p", found: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			username, password, found := c.auth.credentials(c.hostType)
+			if username != c.username || password != c.password || found != c.found {
+				t.Errorf("expected (%q, %q, %v), got (%q, %q, %v)", c.username, c.password, c.found, username, password, found)
+			}
+		})
+	}
+}
+
+func TestGitAuthCloneURL(t *testing.T) {
+	cases := []struct {
+		name string
+		auth gitAuth
+		repo string
+		want string
+	}{
+		{name: "https", repo: "github.com/org/repo", want: "https://github.com/org/repo.git"},
+		{name: "gitlab subgroup", repo: "gitlab.com/group/subgroup/repo", want: "https://gitlab.com/group/subgroup/repo.git"},
+		{name: "azure devops", repo: "dev.azure.com/org/project/_git/repo", want: "https://dev.azure.com/org/project/_git/repo"},
+		{name: "token", auth: gitAuth{Token: "t"}, repo: "gitlab.com/org/repo", want: "https://gitlab.com/org/repo.git"},
+		{name: "ssh", auth: gitAuth{SSHKey: "id"}, repo: "github.com/org/repo", want: "git@github.com:org/repo.git"},
+		{name: "azure devops ssh", auth: gitAuth{SSHKey: "id"}, repo: "dev.azure.com/org/project/_git/repo", want: "git@ssh.dev.azure.com:v3/org/project/repo"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.auth.cloneURL(c.repo); got != c.want {
+				t.Errorf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestGitAuthTransportAuth(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(dir, "id_rsa")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	if err := os.WriteFile(key, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte("github.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("none", func(t *testing.T) {
+		auth, err := (&gitAuth{}).transportAuth("github.com/org/repo", "https://github.com/org/repo.git")
+		if err != nil || auth != nil {
+			t.Errorf("expected no auth, got %v, %v", auth, err)
+		}
+	})
+	t.Run("token", func(t *testing.T) {
+		auth, err := (&gitAuth{Token: "t"}).transportAuth("gitlab.com/org/repo", "https://gitlab.com/org/repo.git")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (&githttp.BasicAuth{Username: "oauth2", Password: "t"}); !reflect.DeepEqual(auth, want) {
+			t.Errorf("expected %v, got %v", want, auth)
+		}
+	})
+	t.Run("token with ssh url", func(t *testing.T) {
+		auth, err := (&gitAuth{Token: "t"}).transportAuth("github.com/org/repo", "git@github.com:org/repo.git")
+		if err != nil || auth != nil {
+			t.Errorf("expected the ssh agent to be used, got %v, %v", auth, err)
+		}
+	})
+	t.Run("ssh key", func(t *testing.T) {
+		auth, err := (&gitAuth{SSHKey: key, KnownHosts: knownHosts}).transportAuth("github.com/org/repo", "ssh://deploy@github.com/org/repo.git")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, ok := auth.(*gitssh.PublicKeys)
+		if !ok {
+			t.Fatalf("expected public key auth, got %T", auth)
+		}
+		if keys.User != "deploy" || keys.HostKeyCallback == nil {
+			t.Errorf("unexpected auth %+v", keys)
+		}
+	})
+	t.Run("missing ssh key", func(t *testing.T) {
+		if _, err := (&gitAuth{SSHKey: filepath.Join(dir, "missing")}).transportAuth("github.com/org/repo", "git@github.com:org/repo.git"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+	t.Run("missing known hosts", func(t *testing.T) {
+		if _, err := (&gitAuth{SSHKey: key, KnownHosts: filepath.Join(dir, "missing")}).transportAuth("github.com/org/repo", "git@github.com:org/repo.git"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestGitAuthCredSecret(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id")
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(key, []byte("private key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(knownHosts, []byte("github.com ssh-ed25519 AAAA"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		auth     gitAuth
+		repo     string
+		wantType corev1.SecretType
+		want     map[string]string
+	}{
+		{name: "none", auth: gitAuth{}, repo: "github.com/org/repo"},
+		{
+			name:     "ssh",
+			auth:     gitAuth{SSHKey: key, KnownHosts: knownHosts},
+			repo:     "github.com/org/repo",
+			wantType: corev1.SecretTypeSSHAuth,
+			want:     map[string]string{corev1.SSHAuthPrivateKey: "private key", GitCredKnownHostsKey: "github.com ssh-ed25519 AAAA"},
+		},
+		{
+			name:     "password",
+			auth:     gitAuth{Username: "u", Password: "p"},
+			repo:     "git.example.com/org/repo",
+			wantType: corev1.SecretTypeBasicAuth,
+			want:     map[string]string{corev1.BasicAuthUsernameKey: "u", corev1.BasicAuthPasswordKey: "p"},
+		},
+		{
+			name: "github token",
+			auth: gitAuth{Token: "t"},
+			repo: "github.com/org/repo",
+			want: map[string]string{GitCredTokenKey: "t"},
+		},
+		{
+			name: "github token with username",
+			auth: gitAuth{Token: "t", Username: "u"},
+			repo: "github.com/org/repo",
+			want: map[string]string{GitCredTokenKey: "t", corev1.BasicAuthUsernameKey: "u"},
+		},
+		{
+			name:     "gitlab token",
+			auth:     gitAuth{Token: "t"},
+			repo:     "gitlab.com/group/repo",
+			wantType: corev1.SecretTypeBasicAuth,
+			want:     map[string]string{corev1.BasicAuthUsernameKey: "oauth2", corev1.BasicAuthPasswordKey: "t"},
+		},
+		{
+			name:     "self-hosted gitea token",
+			auth:     gitAuth{Token: "t", HostTypes: map[string]string{"git.example.com": GitHostGitea}},
+			repo:     "git.example.com/org/repo",
+			wantType: corev1.SecretTypeBasicAuth,
+			want:     map[string]string{corev1.BasicAuthUsernameKey: "t", corev1.BasicAuthPasswordKey: "x-oauth-basic"},
+		},
+		{
+			name:     "bitbucket app password",
+			auth:     gitAuth{Token: "u:p"},
+			repo:     "bitbucket.org/org/repo",
+			wantType: corev1.SecretTypeBasicAuth,
+			want:     map[string]string{corev1.BasicAuthUsernameKey: "u", corev1.BasicAuthPasswordKey: "p"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			secret, err := c.auth.credSecret("mod-git-cred", "default", c.repo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.want == nil {
+				if secret != nil {
+					t.Fatalf("expected no secret, got %v", secret)
+				}
+				return
+			}
+			if secret.Name != "mod-git-cred" || secret.Namespace != "default" {
+				t.Errorf("unexpected secret %s/%s", secret.Namespace, secret.Name)
+			}
+			if secret.Type != c.wantType {
+				t.Errorf("expected type %q, got %q", c.wantType, secret.Type)
+			}
+			data := map[string]string{}
+			for k, v := range secret.Data {
+				data[k] = string(v)
+			}
+			if !reflect.DeepEqual(data, c.want) {
+				t.Errorf("expected data %v, got %v", c.want, data)
+			}
+
+			// the generated secret is accepted when it is reused
+			host, _ := splitGitRepo(c.repo)
+			if err := validateCredSecret(secret, host, c.auth.hostType(host), c.auth.SSHKey != ""); err != nil {
+				t.Errorf("generated secret is not valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateCredSecret(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     map[string]string
+		host     string
+		hostType string
+		err      bool
+	}{
+		{name: "ssh key", data: map[string]string{corev1.SSHAuthPrivateKey: "key"}, host: "github.com", hostType: GitHostGitHub},
+		{name: "basic auth", data: map[string]string{corev1.BasicAuthUsernameKey: "u", corev1.BasicAuthPasswordKey: "p"}, host: "git.example.com", hostType: GitHostGeneric},
+		{name: "github token", data: map[string]string{GitCredTokenKey: "t"}, host: "github.com", hostType: GitHostGitHub},
+		{name: "gitlab token with username", data: map[string]string{GitCredTokenKey: "t", corev1.BasicAuthUsernameKey: "oauth2"}, host: "gitlab.com", hostType: GitHostGitLab},
+		{name: "gitlab token without username", data: map[string]string{GitCredTokenKey: "t"}, host: "gitlab.com", hostType: GitHostGitLab, err: true},
+		{name: "username only", data: map[string]string{corev1.BasicAuthUsernameKey: "u"}, host: "github.com", hostType: GitHostGitHub, err: true},
+		{name: "empty", data: map[string]string{}, host: "github.com", hostType: GitHostGitHub, err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			secret := &corev1.Secret{Data: map[string][]byte{}}
+			secret.Name, secret.Namespace = "cred", "default"
+			for k, v := range c.data {
+				secret.Data[k] = []byte(v)
+			}
+			err := validateCredSecret(secret, c.host, c.hostType, false)
+			if c.err && err == nil {
+				t.Error("expected an error")
+			}
+			if !c.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
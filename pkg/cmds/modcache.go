@@ -0,0 +1,562 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CacheDirEnv overrides the directory of the module cache
+	CacheDirEnv = "KUBEFORM_CACHE_DIR"
+
+	cacheRepoDir  = "repo"
+	cacheMetaFile = "meta.json"
+	cacheLockFile = "lock"
+)
+
+// moduleCache holds the clones of the module repositories, one entry per repository keyed
+// by the hash of its address. Each entry is locked while in use, so parallel runs against
+// the same repository wait for each other instead of sharing a work tree.
+type moduleCache struct {
+	Dir string
+}
+
+// cacheEntry is the metadata of a cached repository
+type cacheEntry struct {
+	Key      string    `json:"-"`
+	Source   string    `json:"source"`
+	LastUsed time.Time `json:"lastUsed"`
+	Size     int64     `json:"-"`
+}
+
+// openModuleCache returns the module cache in the user cache directory, i.e. $XDG_CACHE_HOME
+// on linux, unless overridden by KUBEFORM_CACHE_DIR
+func openModuleCache() (*moduleCache, error) {
+	dir := os.Getenv(CacheDirEnv)
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the cache directory, set %s: %v", CacheDirEnv, err)
+		}
+		dir = filepath.Join(base, "kubeform", "modules")
+	}
+
+	// the clones may hold private code, keep them away from other users
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &moduleCache{Dir: dir}, nil
+}
+
+func cacheKey(repo string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(repo)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// checkout makes the module in the subdirectory of the repository, given as host/path or as
+// the file url of a local repository, available at the ref, fetching it from src even when
+// already cached. The returned module holds the lock of the entry until closed.
+func (c *moduleCache) checkout(repo, src, ref, subdir string, depth int, auth transport.AuthMethod) (*fetchedModule, error) {
+	key := cacheKey(repo)
+	entryDir := filepath.Join(c.Dir, key)
+	if err := os.MkdirAll(entryDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockFile(filepath.Join(entryDir, cacheLockFile), true)
+	if err != nil {
+		return nil, err
+	}
+
+	repoPath := filepath.Join(entryDir, cacheRepoDir)
+	commit, tag, err := gitFetchCheckout(repoPath, src, ref, subdir, depth, auth)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	if err := writeCacheEntry(entryDir, &cacheEntry{Source: repo, LastUsed: time.Now()}); err != nil {
+		unlock()
+		return nil, err
+	}
+
+	m := &fetchedModule{
+		Dir:      repoPath,
+		GitRef:   repo,
+		Git:      true,
+		Ref:      ref,
+		CheckOut: commit,
+		Tag:      tag,
+		cleanup:  unlock,
+	}
+	if err := m.subdir(subdir); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// list returns the cached repositories, the most recently used first
+func (c *moduleCache) list() ([]*cacheEntry, error) {
+	dirs, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*cacheEntry
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		entryDir := filepath.Join(c.Dir, dir.Name())
+		entry, err := readCacheEntry(entryDir)
+		if os.IsNotExist(err) {
+			// pruned, or the first checkout hasn't finished yet
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry.Size = dirSize(entryDir)
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// prune removes the entries not used within the duration, skipping the ones in use
+func (c *moduleCache) prune(olderThan time.Duration) ([]*cacheEntry, error) {
+	entries, err := c.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []*cacheEntry
+	for _, entry := range entries {
+		if time.Since(entry.LastUsed) < olderThan {
+			continue
+		}
+
+		entryDir := filepath.Join(c.Dir, entry.Key)
+		unlock, err := lockFile(filepath.Join(entryDir, cacheLockFile), false)
+		if err == errLocked {
+			continue
+		}
+		if err != nil {
+			return pruned, err
+		}
+
+		// the entry may have been used since it was listed
+		if current, err := readCacheEntry(entryDir); err != nil || time.Since(current.LastUsed) < olderThan {
+			unlock()
+			continue
+		}
+
+		// the lock file stays, a process waiting for it would otherwise end up holding the
+		// lock of a removed file while another one creates a new lock
+		err = os.RemoveAll(filepath.Join(entryDir, cacheRepoDir))
+		if err == nil {
+			err = os.Remove(filepath.Join(entryDir, cacheMetaFile))
+		}
+		unlock()
+		if err != nil {
+			return pruned, err
+		}
+
+		pruned = append(pruned, entry)
+	}
+
+	return pruned, nil
+}
+
+func readCacheEntry(entryDir string) (*cacheEntry, error) {
+	data, err := os.ReadFile(filepath.Join(entryDir, cacheMetaFile))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %s: %v", filepath.Base(entryDir), err)
+	}
+	entry.Key = filepath.Base(entryDir)
+
+	return entry, nil
+}
+
+func writeCacheEntry(entryDir string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(entryDir, cacheMetaFile), data, 0o600)
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// gitFetchCheckout fetches the ref, the default branch if empty, from src into the repository
+// and checks it out, initializing the repository if needed. Only the history up to the depth,
+// one commit by default, is fetched. When the module is in a subdirectory, only that directory
+// is checked out. It returns the commit that was checked out and, if the ref is an annotated
+// tag, the tag object.
+func gitFetchCheckout(repoPath, src, ref, subdir string, depth int, auth transport.AuthMethod) (string, string, error) {
+	repo, err := openCacheRepo(repoPath, src)
+	if err != nil {
+		return "", "", err
+	}
+
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return "", "", err
+	}
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list the refs of %s: %v", src, err)
+	}
+
+	if depth <= 0 {
+		depth = 1
+	}
+	if isLocalGitURL(src) {
+		// the in-process server of local repositories can't cut the history
+		depth = 0
+	}
+
+	var hash plumbing.Hash
+	if name := matchRemoteRef(refs, ref); name != "" {
+		local := localRefName(name)
+		if err := fetchRefs(repo, auth, depth, git.NoTags, config.RefSpec("+"+name+":"+local)); err != nil {
+			return "", "", err
+		}
+		r, err := repo.Reference(local, true)
+		if err != nil {
+			return "", "", err
+		}
+		hash = r.Hash()
+	} else if ref == "" {
+		return "", "", fmt.Errorf("%s has no default branch", src)
+	} else if plumbing.IsHash(ref) && fetchRefs(repo, auth, depth, git.NoTags, config.RefSpec("+"+ref+":"+checkoutRef)) == nil {
+		hash = plumbing.NewHash(ref)
+	}
+
+	if hash.IsZero() {
+		// not every server lets a commit be fetched by its id, let alone by an abbreviated one,
+		// so fetch the whole history and resolve the ref locally
+		klog.Infof("ref %s can't be fetched directly, fetching the whole repository", ref)
+		if shallow, err := repo.Storer.Shallow(); err != nil {
+			return "", "", err
+		} else if len(shallow) > 0 {
+			// go-git can't deepen a shallow repository
+			if err := os.RemoveAll(repoPath); err != nil {
+				return "", "", err
+			}
+			if repo, err = openCacheRepo(repoPath, src); err != nil {
+				return "", "", err
+			}
+		}
+		if err := fetchRefs(repo, auth, 0, git.AllTags, "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+			return "", "", err
+		}
+		if hash, err = resolveFetchedRef(repo, ref); err != nil {
+			return "", "", err
+		}
+	}
+
+	// the signature of an annotated tag is in the tag object, not in the commit
+	var tag string
+	if t, err := repo.TagObject(hash); err == nil {
+		tag = t.Hash.String()
+		c, err := t.Commit()
+		if err != nil {
+			return "", "", fmt.Errorf("tag %s does not point to a commit: %v", ref, err)
+		}
+		hash = c.Hash
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find commit %s of ref %s: %v", hash, ref, err)
+	}
+	if err := checkoutTree(repoPath, commit, subdir); err != nil {
+		return "", "", err
+	}
+
+	return commit.Hash.String(), tag, nil
+}
+
+// checkoutRef holds the commit fetched by its id
+const checkoutRef = "refs/kf/checkout"
+
+// openCacheRepo opens the repository, initializing it if needed, and points its origin remote to src
+func openCacheRepo(repoPath, src string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err == git.ErrRepositoryNotExists {
+		if err := os.MkdirAll(repoPath, 0o700); err != nil {
+			return nil, err
+		}
+		repo, err = git.PlainInit(repoPath, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Remotes[git.DefaultRemoteName] = &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{src},
+	}
+	if err := repo.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func fetchRefs(repo *git.Repository, auth transport.AuthMethod, depth int, tags git.TagMode, specs ...config.RefSpec) error {
+	err := repo.Fetch(&git.FetchOptions{
+		RefSpecs: specs,
+		Depth:    depth,
+		Auth:     auth,
+		Tags:     tags,
+		Force:    true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("git fetch failed: %v", err)
+	}
+	return nil
+}
+
+// matchRemoteRef returns the name of the remote ref matching the ref the way git does, tags
+// taking precedence over branches. It returns an empty name if none matches, e.g. for a commit.
+func matchRemoteRef(refs []*plumbing.Reference, ref string) plumbing.ReferenceName {
+	var candidates []plumbing.ReferenceName
+	switch {
+	case ref == "":
+		candidates = []plumbing.ReferenceName{plumbing.HEAD}
+	case strings.HasPrefix(ref, "refs/"):
+		candidates = []plumbing.ReferenceName{plumbing.ReferenceName(ref)}
+	default:
+		candidates = []plumbing.ReferenceName{plumbing.NewTagReferenceName(ref), plumbing.NewBranchReferenceName(ref)}
+	}
+
+	for _, name := range candidates {
+		for _, r := range refs {
+			if r.Name() == name {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+// localRefName returns the ref the remote ref is fetched into. Like git, the branches are
+// fetched as remote-tracking branches, origin/<branch>.
+func localRefName(name plumbing.ReferenceName) plumbing.ReferenceName {
+	switch {
+	case name == plumbing.HEAD:
+		return plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+	case name.IsBranch():
+		return plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name.Short())
+	}
+	return name
+}
+
+// resolveFetchedRef resolves the ref once the whole repository has been fetched, as a branch,
+// a tag, a ref or a, possibly abbreviated, commit id
+func resolveFetchedRef(repo *git.Repository, ref string) (plumbing.Hash, error) {
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ref),
+		plumbing.NewTagReferenceName(ref),
+		plumbing.ReferenceName(ref),
+	} {
+		if r, err := repo.Reference(name, true); err == nil {
+			return r.Hash(), nil
+		}
+	}
+
+	var matches []plumbing.Hash
+	if isHexPrefix(ref) {
+		commits, err := repo.CommitObjects()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		err = commits.ForEach(func(c *object.Commit) error {
+			if strings.HasPrefix(c.Hash.String(), strings.ToLower(ref)) {
+				matches = append(matches, c.Hash)
+			}
+			return nil
+		})
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return plumbing.ZeroHash, fmt.Errorf("ref %s is neither a branch, a tag nor a commit of the repository", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return plumbing.ZeroHash, fmt.Errorf("abbreviated commit %s is ambiguous", ref)
+	}
+}
+
+func isHexPrefix(s string) bool {
+	if len(s) < 4 || len(s) > 40 {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkoutTree replaces the work tree of the repository with the files of the commit, only
+// those in the subdirectory if given. go-git can't check out sparsely and the module needs
+// no index, so the files are written directly.
+func checkoutTree(repoPath string, commit *object.Commit, subdir string) error {
+	entries, err := os.ReadDir(repoPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == git.GitDirName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(repoPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	if subdir != "" {
+		tree, err = tree.Tree(subdir)
+		if err == object.ErrDirectoryNotFound {
+			// reported by the caller
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	dest := filepath.Join(repoPath, filepath.FromSlash(subdir))
+	return tree.Files().ForEach(func(f *object.File) error {
+		// like in archives, only regular files are written, symlinks may point anywhere
+		if f.Mode != filemode.Regular && f.Mode != filemode.Executable && f.Mode != filemode.Deprecated {
+			return nil
+		}
+
+		target, err := archivePath(dest, f.Name)
+		if err != nil {
+			return err
+		}
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		_, err = writeArchiveFile(target, r)
+		return err
+	})
+}
+
+// localRepoLoader loads the repositories of file urls for the in-process server, either
+// bare ones or work trees
+type localRepoLoader struct{}
+
+func (localRepoLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	for _, dir := range []string{filepath.Join(ep.Path, git.GitDirName), ep.Path} {
+		if isGitDir(dir) {
+			return filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault()), nil
+		}
+	}
+	return nil, transport.ErrRepositoryNotFound
+}
+
+// isGitDir tells whether the directory is a git directory, i.e. the .git directory of a work
+// tree or a bare repository
+func isGitDir(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "objects"))
+	return err == nil && info.IsDir() && fileExists(filepath.Join(dir, "HEAD"))
+}
+
+// isLocalGitURL tells whether the git url is a local repository
+func isLocalGitURL(src string) bool {
+	ep, err := transport.NewEndpoint(src)
+	return err == nil && ep.Protocol == "file"
+}
+
+func init() {
+	// go-git would run git-upload-pack to fetch local repositories otherwise
+	client.InstallProtocol("file", server.NewClient(localRepoLoader{}))
+}
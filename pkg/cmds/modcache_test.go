@@ -0,0 +1,253 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// testGitRepo creates a repository with two commits on main, the second one tagged v2.0.0,
+// and a feature branch
+func testGitRepo(t *testing.T) (string, map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main"))); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commit := func(msg string) string {
+		t.Helper()
+		if _, err := wt.Add("."); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := wt.Commit(msg, &git.CommitOptions{Author: signature})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash.String()
+	}
+
+	commits := map[string]string{}
+	write("main.tf", `variable "v1" {}`)
+	write("modules/vpc/main.tf", `variable "vpc" {}`)
+	write("modules/db/main.tf", `variable "db" {}`)
+	commits["v1"] = commit("v1")
+
+	write("main.tf", `variable "v2" {}`)
+	commits["v2"] = commit("v2")
+	tag, err := repo.CreateTag("v2.0.0", plumbing.NewHash(commits["v2"]), &git.CreateTagOptions{Tagger: signature, Message: "v2.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits["v2.0.0"] = tag.Hash().String()
+
+	err = wt.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commits["v1"]), Branch: plumbing.NewBranchReferenceName("feature"), Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("main.tf", `variable "feature" {}`)
+	commits["feature"] = commit("feature")
+	if err := wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("main")}); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, commits
+}
+
+func TestModuleCacheCheckout(t *testing.T) {
+	repo, commits := testGitRepo(t)
+	src := "file://" + repo
+
+	t.Setenv(CacheDirEnv, t.TempDir())
+	cache, err := openModuleCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		ref     string
+		subdir  string
+		depth   int
+		commit  string
+		tag     string
+		content string
+	}{
+		{name: "default branch", commit: commits["v2"], content: `variable "v2" {}`},
+		{name: "shallow", ref: "main", depth: 1, commit: commits["v2"], content: `variable "v2" {}`},
+		{name: "branch", ref: "feature", commit: commits["feature"], content: `variable "feature" {}`},
+		{name: "annotated tag", ref: "v2.0.0", commit: commits["v2"], tag: commits["v2.0.0"], content: `variable "v2" {}`},
+		{name: "commit", ref: commits["v1"], commit: commits["v1"], content: `variable "v1" {}`},
+		{name: "abbreviated commit", ref: commits["v1"][:10], commit: commits["v1"], content: `variable "v1" {}`},
+		{name: "full ref", ref: "refs/heads/feature", commit: commits["feature"], content: `variable "feature" {}`},
+		{name: "subdirectory", ref: "v2.0.0", subdir: "modules/vpc", commit: commits["v2"], tag: commits["v2.0.0"], content: `variable "vpc" {}`},
+		{name: "back to the default branch", commit: commits["v2"], content: `variable "v2" {}`},
+	}
+
+	// the cases share the cache entry, like repeated runs against the same repository
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := cache.checkout("example.com/org/repo", src, c.ref, c.subdir, c.depth, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			data, err := os.ReadFile(filepath.Join(m.Dir, "main.tf"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != c.content {
+				t.Errorf("expected main.tf of commit %s, got %q", c.commit, data)
+			}
+			gitRef := "example.com/org/repo"
+			if c.subdir != "" {
+				gitRef += "//" + c.subdir
+				for _, f := range []string{"../db", "../../main.tf"} {
+					if _, err := os.Stat(filepath.Join(m.Dir, f)); err == nil {
+						t.Errorf("%s outside of the subdirectory is checked out", f)
+					}
+				}
+			}
+			if m.GitRef != gitRef || m.Ref != c.ref || m.CheckOut != c.commit {
+				t.Errorf("unexpected git ref %s, ref %s and checkout %s", m.GitRef, m.Ref, m.CheckOut)
+			}
+			if m.Tag != c.tag {
+				t.Errorf("expected tag object %q, got %q", c.tag, m.Tag)
+			}
+		})
+	}
+
+	if _, err := cache.checkout("example.com/org/repo", src, "missing", "", 0, nil); err == nil {
+		t.Error("expected an error for a missing ref")
+	}
+
+	entries, err := cache.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Source != "example.com/org/repo" {
+		t.Errorf("expected a single cache entry of the repository, got %+v", entries)
+	}
+}
+
+func TestMatchRemoteRef(t *testing.T) {
+	hash := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	refs := []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/main"),
+		plumbing.NewHashReference("refs/heads/main", hash),
+		plumbing.NewHashReference("refs/heads/v1", hash),
+		plumbing.NewHashReference("refs/tags/v1", hash),
+		plumbing.NewHashReference("refs/pull/1/head", hash),
+	}
+
+	cases := map[string]plumbing.ReferenceName{
+		"":                 plumbing.HEAD,
+		"main":             "refs/heads/main",
+		"v1":               "refs/tags/v1",
+		"refs/heads/v1":    "refs/heads/v1",
+		"refs/pull/1/head": "refs/pull/1/head",
+		"missing":          "",
+		hash.String():      "",
+	}
+	for ref, want := range cases {
+		if got := matchRemoteRef(refs, ref); got != want {
+			t.Errorf("%q: expected %q, got %q", ref, want, got)
+		}
+	}
+
+	local := map[plumbing.ReferenceName]plumbing.ReferenceName{
+		plumbing.HEAD:      "refs/remotes/origin/HEAD",
+		"refs/heads/main":  "refs/remotes/origin/main",
+		"refs/tags/v1":     "refs/tags/v1",
+		"refs/pull/1/head": "refs/pull/1/head",
+	}
+	for name, want := range local {
+		if got := localRefName(name); got != want {
+			t.Errorf("%s: expected local ref %s, got %s", name, want, got)
+		}
+	}
+}
+
+// TestResolveFetchedRef resolves the refs once the whole repository has been fetched, which
+// only creates remote-tracking branches
+func TestResolveFetchedRef(t *testing.T) {
+	src, commits := testGitRepo(t)
+	repoPath := filepath.Join(t.TempDir(), cacheRepoDir)
+
+	// the abbreviated commit can't be fetched directly, so all the branches and tags are
+	if _, _, err := gitFetchCheckout(repoPath, "file://"+src, commits["v1"][:10], "", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"feature":          commits["feature"],
+		"main":             commits["v2"],
+		"v2.0.0":           commits["v2.0.0"],
+		"refs/tags/v2.0.0": commits["v2.0.0"],
+		commits["v1"][:7]:  commits["v1"],
+		"missing":          "",
+		"abcd":             "",
+	}
+	for ref, want := range cases {
+		got, err := resolveFetchedRef(repo, ref)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", ref, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", ref, err)
+			continue
+		}
+		if got.String() != want {
+			t.Errorf("%s: expected %s, got %s", ref, want, got)
+		}
+	}
+}
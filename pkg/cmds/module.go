@@ -0,0 +1,456 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	v "gomodules.xyz/x/version"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+const (
+	VerifyStatusVerified = "Verified"
+	VerifyStatusDrifted  = "Drifted"
+	VerifyStatusTampered = "Tampered"
+	VerifyStatusOutdated = "Outdated"
+	VerifyStatusFailed   = "Failed"
+)
+
+var (
+	moduleDefinitionResource = v1alpha1.GroupVersion.WithResource("moduledefinitions")
+	commitIDPattern          = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+type ModuleVerifyOptions struct {
+	Names []string
+	All   bool
+
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+
+	genericclioptions.IOStreams
+}
+
+// moduleVerification is the outcome of the verification of a Module Definition
+type moduleVerification struct {
+	Name    string
+	Status  string
+	Details string
+}
+
+func NewCmdModule(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "module",
+		Short:             "Manage the Module Definitions of the cluster",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(NewCmdModuleVerify(parent, f, streams))
+	cmd.AddCommand(NewCmdModuleDiff(parent, f, streams))
+	cmd.AddCommand(NewCmdModuleUpgrade(parent, f, streams))
+	cmd.AddCommand(NewCmdModuleNew(parent, f, streams))
+	cmd.AddCommand(NewCmdModuleCreate(parent, f, streams))
+
+	return cmd
+}
+
+func NewCmdModuleVerify(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ModuleVerifyOptions{IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:               "verify [name...]",
+		Short:             "Check that the Module Definitions of the cluster match the source of their modules",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.All, "all", false, "verify every Module Definition of the cluster")
+
+	return cmd
+}
+
+func (o *ModuleVerifyOptions) Complete(f cmdutil.Factory, args []string) error {
+	o.Names = args
+
+	var err error
+	o.DynamicClient, err = f.DynamicClient()
+	if err != nil {
+		return err
+	}
+	o.KubeClient, err = f.KubernetesClientSet()
+	return err
+}
+
+func (o *ModuleVerifyOptions) Validate() error {
+	if o.All && len(o.Names) > 0 {
+		return fmt.Errorf("you must not specify the names of the Module Definitions with --all")
+	}
+	if !o.All && len(o.Names) == 0 {
+		return fmt.Errorf("you must specify the names of the Module Definitions to verify or --all")
+	}
+	return nil
+}
+
+func (o *ModuleVerifyOptions) Run() error {
+	client := o.DynamicClient.Resource(moduleDefinitionResource)
+
+	var objs []unstructured.Unstructured
+	if o.All {
+		list, err := client.List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		objs = list.Items
+		if len(objs) == 0 {
+			fmt.Fprintln(o.Out, "no Module Definition is found")
+			return nil
+		}
+	} else {
+		for _, name := range o.Names {
+			obj, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			objs = append(objs, *obj)
+		}
+	}
+
+	results := make([]moduleVerification, 0, len(objs))
+	for i := range objs {
+		results = append(results, o.verify(&objs[i]))
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tDETAILS")
+	for _, r := range results {
+		if r.Status != VerifyStatusVerified {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Status, strings.ReplaceAll(r.Details, "\n", " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d Module Definitions failed verification", failed, len(results))
+	}
+
+	return nil
+}
+
+// verify regenerates the Module Definition from the source at its moduleRef and compares it with
+// the live object
+func (o *ModuleVerifyOptions) verify(live *unstructured.Unstructured) moduleVerification {
+	result := moduleVerification{
+		Name:   live.GetName(),
+		Status: VerifyStatusFailed,
+	}
+
+	var md v1alpha1.ModuleDefinition
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, &md); err != nil {
+		result.Details = err.Error()
+		return result
+	}
+
+	var checkOut string
+	if md.Spec.ModuleRef.Git.CheckOut != nil {
+		checkOut = *md.Spec.ModuleRef.Git.CheckOut
+	}
+	regenerated, err := regenerateModule(o.KubeClient, &md, checkOut, true)
+	if err != nil {
+		result.Details = err.Error()
+		return result
+	}
+
+	liveSchema, _, err := unstructured.NestedFieldNoCopy(live.Object, "spec", "schema")
+	if err != nil {
+		result.Details = err.Error()
+		return result
+	}
+
+	return compareModule(&md, liveSchema, regenerated)
+}
+
+// compareModule compares the live Module Definition with the one regenerated from its source.
+// A Module Definition generated by another version of kf can differ just because the generator
+// changed, it is outdated rather than drifted or tampered. Otherwise a changed content hash means
+// the source moved on since the Module Definition was generated, a changed schema of an unchanged
+// source, or a changed hash of a pinned commit, means the live object was edited.
+func compareModule(md *v1alpha1.ModuleDefinition, liveSchema interface{}, regenerated *regeneratedModule) moduleVerification {
+	result := moduleVerification{
+		Name:   md.Name,
+		Status: VerifyStatusFailed,
+	}
+
+	schemaDiff, err := diffSchema(liveSchema, regenerated.Schema)
+	if err != nil {
+		result.Details = err.Error()
+		return result
+	}
+
+	var details []string
+	generator := md.Annotations[GeneratorVersionAnnotation]
+	generatorChanged := generator != v.Version.Version
+	recorded := md.Annotations[ContentHashAnnotation]
+	hashChanged := recorded != "" && recorded != regenerated.Hash
+	if hashChanged {
+		details = append(details, fmt.Sprintf("content hash changed from %s to %s", recorded, regenerated.Hash))
+	}
+	if recorded == "" {
+		details = append(details, "no content hash recorded")
+	}
+	details = append(details, schemaDiff...)
+
+	// the content of a commit never changes, only the recorded hash can
+	pinned := md.Spec.ModuleRef.Git.CheckOut != nil && commitIDPattern.MatchString(*md.Spec.ModuleRef.Git.CheckOut)
+
+	switch {
+	case !hashChanged && len(schemaDiff) == 0:
+		result.Status = VerifyStatusVerified
+	case generatorChanged:
+		result.Status = VerifyStatusOutdated
+		details = append([]string{fmt.Sprintf("generated by kf %s, regenerated by kf %s", versionOrUnknown(generator), versionOrUnknown(v.Version.Version))}, details...)
+	case hashChanged && pinned:
+		result.Status = VerifyStatusTampered
+	case hashChanged:
+		result.Status = VerifyStatusDrifted
+	case recorded != "":
+		result.Status = VerifyStatusTampered
+	default:
+		result.Status = VerifyStatusDrifted
+	}
+	result.Details = strings.Join(details, "; ")
+
+	return result
+}
+
+func versionOrUnknown(version string) string {
+	if version == "" {
+		return "of an unknown version"
+	}
+	return version
+}
+
+// regeneratedModule is a Module Definition regenerated from the source of its module
+type regeneratedModule struct {
+	// Hash is the content hash of the terraform files of the module
+	Hash string
+	// Commit is the commit the module was checked out at
+	Commit string
+	Schema map[string]interface{}
+}
+
+// regenerateModule fetches the module at the moduleRef of the Module Definition, checked out at
+// the ref, and generates the schema of the Module Definition from it
+func regenerateModule(client kubernetes.Interface, md *v1alpha1.ModuleDefinition, ref string, skipUntranslatable bool) (*regeneratedModule, error) {
+	if md.Spec.ModuleRef.Git.Ref == "" {
+		return nil, fmt.Errorf("spec.moduleRef.git.ref is empty")
+	}
+
+	auth, cleanup, err := moduleCredAuth(client, md)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	m, err := regenerateSchema(md, "git::https://"+md.Spec.ModuleRef.Git.Ref, auth, ref, skipUntranslatable)
+	if err != nil {
+		return nil, errors.New(redact(err.Error(), auth.Token, auth.Password))
+	}
+
+	return m, nil
+}
+
+// regenerateSchema generates the schema of the Module Definition from the module at the source.
+// The live definition may have been generated with --skip-untranslatable-validations, a schema
+// regenerated only for comparing with it can skip the untranslatable validations as well.
+func regenerateSchema(md *v1alpha1.ModuleDefinition, source string, auth *gitAuth, ref string, skipUntranslatable bool) (*regeneratedModule, error) {
+	fetched, err := fetchModule(source, auth, ref, "")
+	if err != nil {
+		return nil, err
+	}
+	defer fetched.Close()
+
+	hash, err := moduleContentHash(fetched.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	modObj, extensions, err := buildModuleDefinition(md.Name, fetched.Dir, md.Spec.Provider.Name, md.Spec.Provider.Source, skipUntranslatable)
+	if err != nil {
+		return nil, err
+	}
+	data, err := marshalModuleDefinition(modObj, extensions)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	schema, _, err := unstructured.NestedFieldNoCopy(obj, "spec", "schema")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &regeneratedModule{
+		Hash:   hash,
+		Commit: fetched.CheckOut,
+	}
+	if err := normalizeJSON(schema, &m.Schema); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// moduleCredAuth turns the git cred secret of the Module Definition, if any, into the credentials
+// used to fetch its module. The ssh key is written to a temporary file removed by the cleanup.
+func moduleCredAuth(client kubernetes.Interface, md *v1alpha1.ModuleDefinition) (*gitAuth, func(), error) {
+	auth := &gitAuth{}
+	cleanup := func() {}
+
+	ref := md.Spec.ModuleRef.Git.Cred
+	if ref == nil {
+		return auth, cleanup, nil
+	}
+	secret, err := client.CoreV1().Secrets(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get git cred secret %s/%s: %v", ref.Namespace, ref.Name, err)
+	}
+
+	data := secret.Data
+	switch {
+	case len(data[corev1.SSHAuthPrivateKey]) > 0:
+		dir, err := os.MkdirTemp("", "kf-ssh-")
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanup = func() { _ = os.RemoveAll(dir) }
+
+		auth.SSHKey = filepath.Join(dir, "id")
+		if err := os.WriteFile(auth.SSHKey, data[corev1.SSHAuthPrivateKey], 0o600); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		if knownHosts := data[GitCredKnownHostsKey]; len(knownHosts) > 0 {
+			auth.KnownHosts = filepath.Join(dir, "known_hosts")
+			if err := os.WriteFile(auth.KnownHosts, knownHosts, 0o600); err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+		}
+	case len(data[GitCredTokenKey]) > 0:
+		auth.Token = string(data[GitCredTokenKey])
+		auth.Username = string(data[corev1.BasicAuthUsernameKey])
+	default:
+		auth.Username = string(data[corev1.BasicAuthUsernameKey])
+		auth.Password = string(data[corev1.BasicAuthPasswordKey])
+	}
+
+	return auth, cleanup, nil
+}
+
+// diffSchema describes the differences between the live and the regenerated schema, the input and
+// output properties are compared one by one
+func diffSchema(live, generated interface{}) ([]string, error) {
+	var a, b map[string]interface{}
+	if err := normalizeJSON(live, &a); err != nil {
+		return nil, err
+	}
+	if err := normalizeJSON(generated, &b); err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil, nil
+	}
+
+	var diff []string
+	for _, section := range []string{"input", "output"} {
+		liveSection, _, _ := unstructured.NestedMap(a, "properties", section)
+		genSection, _, _ := unstructured.NestedMap(b, "properties", section)
+
+		liveProps, _, _ := unstructured.NestedMap(liveSection, "properties")
+		genProps, _, _ := unstructured.NestedMap(genSection, "properties")
+		if changed := diffKeys(liveProps, genProps); len(changed) > 0 {
+			diff = append(diff, fmt.Sprintf("%s properties differ: %s", section, strings.Join(changed, ", ")))
+		}
+		if !reflect.DeepEqual(liveSection["required"], genSection["required"]) {
+			diff = append(diff, fmt.Sprintf("required %s properties differ", section))
+		}
+	}
+	if len(diff) == 0 {
+		diff = append(diff, "schema differs")
+	}
+
+	return diff, nil
+}
+
+func diffKeys(a, b map[string]interface{}) []string {
+	var keys []string
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !reflect.DeepEqual(v, w) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeJSON round trips the value through json, so that the numbers of typed and decoded
+// objects compare equal
+func normalizeJSON(in interface{}, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
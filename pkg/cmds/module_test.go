@@ -0,0 +1,322 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	v "gomodules.xyz/x/version"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	apiv1 "kmodules.xyz/client-go/api/v1"
+)
+
+// testModuleSchema is the schema of a Module Definition with the given input properties
+func testModuleSchema(input ...string) map[string]interface{} {
+	props := map[string]interface{}{}
+	for _, name := range input {
+		props[name] = map[string]interface{}{"type": "string"}
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"input": map[string]interface{}{
+				"type":       "object",
+				"properties": props,
+			},
+		},
+	}
+}
+
+func setTestVersion(t *testing.T, version string) {
+	t.Helper()
+
+	old := v.Version.Version
+	v.Version.Version = version
+	t.Cleanup(func() { v.Version.Version = old })
+}
+
+func TestCompareModule(t *testing.T) {
+	setTestVersion(t, "v0.2.0")
+
+	const (
+		hash    = "sha256:1111"
+		newHash = "sha256:2222"
+		commit  = "0123456789abcdef0123456789abcdef01234567"
+	)
+	newMD := func(generator, hash, checkOut string) *v1alpha1.ModuleDefinition {
+		md := &v1alpha1.ModuleDefinition{}
+		md.Name = "vpc"
+		md.Annotations = map[string]string{}
+		if generator != "" {
+			md.Annotations[GeneratorVersionAnnotation] = generator
+		}
+		if hash != "" {
+			md.Annotations[ContentHashAnnotation] = hash
+		}
+		if checkOut != "" {
+			md.Spec.ModuleRef.Git.CheckOut = &checkOut
+		}
+		return md
+	}
+
+	cases := []struct {
+		name       string
+		md         *v1alpha1.ModuleDefinition
+		live       map[string]interface{}
+		hash       string
+		status     string
+		detailsHas string
+	}{
+		{name: "unchanged", md: newMD("v0.2.0", hash, "main"), live: testModuleSchema("name"), hash: hash, status: VerifyStatusVerified},
+		{name: "unchanged by another generator", md: newMD("v0.1.0", hash, commit), live: testModuleSchema("name"), hash: hash, status: VerifyStatusVerified},
+		{name: "schema edited", md: newMD("v0.2.0", hash, "main"), live: testModuleSchema("name", "extra"), hash: hash, status: VerifyStatusTampered, detailsHas: "input properties differ: extra"},
+		{name: "schema of another generator", md: newMD("v0.1.0", hash, "main"), live: testModuleSchema("name", "extra"), hash: hash, status: VerifyStatusOutdated, detailsHas: "generated by kf v0.1.0, regenerated by kf v0.2.0"},
+		{name: "schema of an unknown generator", md: newMD("", hash, "main"), live: testModuleSchema("name", "extra"), hash: hash, status: VerifyStatusOutdated, detailsHas: "generated by kf of an unknown version"},
+		{name: "no content hash", md: newMD("v0.2.0", "", "main"), live: testModuleSchema("name", "extra"), hash: hash, status: VerifyStatusDrifted, detailsHas: "no content hash recorded"},
+		{name: "source moved on", md: newMD("v0.2.0", hash, "main"), live: testModuleSchema("name"), hash: newHash, status: VerifyStatusDrifted, detailsHas: "content hash changed from sha256:1111 to sha256:2222"},
+		{name: "hash of pinned commit edited", md: newMD("v0.2.0", hash, commit), live: testModuleSchema("name"), hash: newHash, status: VerifyStatusTampered},
+		{name: "hash of pinned commit by another generator", md: newMD("v0.1.0", hash, commit), live: testModuleSchema("name"), hash: newHash, status: VerifyStatusOutdated},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := compareModule(c.md, c.live, &regeneratedModule{Hash: c.hash, Schema: testModuleSchema("name")})
+			if got.Status != c.status {
+				t.Errorf("expected status %s, got %s: %s", c.status, got.Status, got.Details)
+			}
+			if !strings.Contains(got.Details, c.detailsHas) {
+				t.Errorf("expected details with %q, got %q", c.detailsHas, got.Details)
+			}
+		})
+	}
+}
+
+func TestDiffSchema(t *testing.T) {
+	required := testModuleSchema("name")
+	required["properties"].(map[string]interface{})["input"].(map[string]interface{})["required"] = []interface{}{"name"}
+
+	cases := []struct {
+		name      string
+		live      map[string]interface{}
+		generated map[string]interface{}
+		want      []string
+	}{
+		{name: "same", live: testModuleSchema("a", "b"), generated: testModuleSchema("b", "a")},
+		{name: "properties", live: testModuleSchema("a", "b"), generated: testModuleSchema("a", "c"), want: []string{"input properties differ: b, c"}},
+		{name: "required", live: testModuleSchema("name"), generated: required, want: []string{"required input properties differ"}},
+		{name: "other fields", live: testModuleSchema("name"), generated: map[string]interface{}{"type": "object"}, want: []string{"input properties differ: name"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := diffSchema(c.live, c.generated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestModuleCredAuth(t *testing.T) {
+	newSecret := func(name string, data map[string]string) *corev1.Secret {
+		secret := &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Data:       map[string][]byte{},
+		}
+		for k, v := range data {
+			secret.Data[k] = []byte(v)
+		}
+		return secret
+	}
+	client := secretTestServer(t,
+		newSecret("token", map[string]string{GitCredTokenKey: "t", corev1.BasicAuthUsernameKey: "oauth2"}),
+		newSecret("basic", map[string]string{corev1.BasicAuthUsernameKey: "u", corev1.BasicAuthPasswordKey: "p"}),
+		newSecret("ssh", map[string]string{corev1.SSHAuthPrivateKey: "key", GitCredKnownHostsKey: "hosts"}),
+	)
+
+	cases := []struct {
+		name   string
+		secret string
+		want   gitAuth
+		files  map[string]string
+		err    bool
+	}{
+		{name: "no secret"},
+		{name: "token", secret: "token", want: gitAuth{Token: "t", Username: "oauth2"}},
+		{name: "basic auth", secret: "basic", want: gitAuth{Username: "u", Password: "p"}},
+		{name: "ssh key", secret: "ssh", files: map[string]string{"key": "key", "hosts": "hosts"}},
+		{name: "missing secret", secret: "missing", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			md := &v1alpha1.ModuleDefinition{}
+			if c.secret != "" {
+				md.Spec.ModuleRef.Git.Cred = &apiv1.ObjectReference{Namespace: "default", Name: c.secret}
+			}
+
+			auth, cleanup, err := moduleCredAuth(client, md)
+			if c.err {
+				if err == nil {
+					cleanup()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.files != nil {
+				for filename, want := range map[string]string{auth.SSHKey: c.files["key"], auth.KnownHosts: c.files["hosts"]} {
+					if data, err := os.ReadFile(filename); err != nil || string(data) != want {
+						t.Errorf("expected %s to hold %q, got %q: %v", filename, want, data, err)
+					}
+				}
+				cleanup()
+				if _, err := os.Stat(auth.SSHKey); !os.IsNotExist(err) {
+					t.Errorf("ssh key %s is not removed", auth.SSHKey)
+				}
+				return
+			}
+			defer cleanup()
+			if !reflect.DeepEqual(*auth, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, *auth)
+			}
+		})
+	}
+}
+
+func TestRegenerateSchema(t *testing.T) {
+	dir := writeModule(t, map[string]string{"main.tf": sourceTestModule})
+	hash, err := moduleContentHash(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := &v1alpha1.ModuleDefinition{}
+	md.Name = "vpc"
+	md.Spec.Provider.Name, md.Spec.Provider.Source = "aws", "hashicorp/aws"
+	m, err := regenerateSchema(md, dir, &gitAuth{}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Hash != hash {
+		t.Errorf("expected hash %s, got %s", hash, m.Hash)
+	}
+	props, _, _ := unstructured.NestedMap(m.Schema, "properties", "input", "properties")
+	if _, ok := props["name"]; !ok || len(props) != 1 {
+		t.Errorf("unexpected input properties %v", props)
+	}
+}
+
+// moduleDefinitionTestServer is a stand-in api server listing the Module Definitions
+func moduleDefinitionTestServer(t *testing.T, mds ...*v1alpha1.ModuleDefinition) dynamic.Interface {
+	t.Helper()
+
+	list := &v1alpha1.ModuleDefinitionList{
+		TypeMeta: metav1.TypeMeta{Kind: "ModuleDefinitionList", APIVersion: v1alpha1.GroupVersion.String()},
+	}
+	for _, md := range mds {
+		md.TypeMeta = metav1.TypeMeta{Kind: "ModuleDefinition", APIVersion: v1alpha1.GroupVersion.String()}
+		list.Items = append(list.Items, *md)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/apis/tf.kubeform.com/v1alpha1/moduledefinitions" {
+			_ = json.NewEncoder(w).Encode(list)
+			return
+		}
+		for _, md := range list.Items {
+			if r.URL.Path == "/apis/tf.kubeform.com/v1alpha1/moduledefinitions/"+md.Name {
+				_ = json.NewEncoder(w).Encode(md)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(&metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonNotFound,
+			Code:     http.StatusNotFound,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestModuleVerifyRun(t *testing.T) {
+	md := &v1alpha1.ModuleDefinition{}
+	md.Name = "vpc"
+
+	cases := []struct {
+		name string
+		o    ModuleVerifyOptions
+		want string
+		err  string
+	}{
+		{
+			name: "no Module Definition",
+			o:    ModuleVerifyOptions{All: true, DynamicClient: moduleDefinitionTestServer(t)},
+			want: "no Module Definition is found\n",
+		},
+		{
+			name: "Module Definition without moduleRef",
+			o:    ModuleVerifyOptions{Names: []string{"vpc"}, DynamicClient: moduleDefinitionTestServer(t, md)},
+			want: "NAME  STATUS  DETAILS\nvpc   Failed  spec.moduleRef.git.ref is empty\n",
+			err:  "1 of 1 Module Definitions failed verification",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			c.o.IOStreams = genericclioptions.IOStreams{Out: &out, ErrOut: &out}
+
+			err := c.o.Run()
+			if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+				t.Errorf("expected error %q, got %v", c.err, err)
+			}
+			if out.String() != c.want {
+				t.Errorf("expected output\n%s\ngot\n%s", c.want, out.String())
+			}
+		})
+	}
+}
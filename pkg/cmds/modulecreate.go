@@ -0,0 +1,481 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+type ModuleCreateOptions struct {
+	genericclioptions.IOStreams
+
+	ModuleDefName string
+	Name          string
+	Namespace     string
+	ProviderRef   string
+	ModuleDef     string
+	Interactive   bool
+
+	NewBuilder    func() *resource.Builder
+	DynamicClient func() (dynamic.Interface, error)
+	Mapper        func() (meta.RESTMapper, error)
+}
+
+func NewCmdModuleCreate(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ModuleCreateOptions{
+		IOStreams: streams,
+	}
+
+	cmd := &cobra.Command{
+		Use:               "create [moduledef] [name] -i",
+		Short:             "Create a Module of the Module Definition by answering prompts for its inputs",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmd.Flags().BoolVarP(&o.Interactive, "interactive", "i", false, "prompt for the inputs of the Module")
+	cmd.Flags().StringVar(&o.ProviderRef, "provider-ref", "", "name of the secret holding the provider credentials, offered as the default answer")
+	cmd.Flags().StringVar(&o.ModuleDef, "module-def", "", "file containing the Module Definition, read from the cluster if not given")
+
+	return cmd
+}
+
+func (o *ModuleCreateOptions) Complete(f cmdutil.Factory, args []string) error {
+	switch len(args) {
+	case 2:
+		o.ModuleDefName, o.Name = args[0], args[1]
+	case 1:
+		o.ModuleDefName = args[0]
+	default:
+		return fmt.Errorf("you must specify the name of the Module Definition")
+	}
+
+	var err error
+	o.Namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		o.Namespace = metav1.NamespaceDefault
+	}
+
+	o.NewBuilder = f.NewBuilder
+	o.DynamicClient = f.DynamicClient
+	o.Mapper = f.ToRESTMapper
+	return nil
+}
+
+func (o *ModuleCreateOptions) Validate() error {
+	if !o.Interactive {
+		return fmt.Errorf("only the interactive creation is supported, use -i, or kf module new to print a Module to fill in")
+	}
+	return nil
+}
+
+func (o *ModuleCreateOptions) Run() error {
+	defOptions := &ModuleNewOptions{
+		ModuleDefName: o.ModuleDefName,
+		ModuleDef:     o.ModuleDef,
+		NewBuilder:    o.NewBuilder,
+		DynamicClient: o.DynamicClient,
+	}
+	def, err := defOptions.moduleDefinition()
+	if err != nil {
+		return err
+	}
+	inputSchema, found, err := unstructured.NestedFieldNoCopy(def.Object, "spec", "schema", "properties", "input")
+	if err != nil || !found {
+		return fmt.Errorf("the Module Definition %s has no spec.schema.properties.input", o.ModuleDefName)
+	}
+	var schema map[string]interface{}
+	if err := normalizeJSON(inputSchema, &schema); err != nil {
+		return err
+	}
+
+	p := &prompter{
+		in:  bufio.NewReader(o.In),
+		out: o.Out,
+	}
+
+	if o.Name == "" {
+		if o.Name, err = p.askString("name of the Module", ""); err != nil {
+			return err
+		}
+	}
+	if o.Namespace, err = p.askString("namespace of the Module", o.Namespace); err != nil {
+		return err
+	}
+	if o.ProviderRef, err = p.askString("name of the secret holding the provider credentials", o.ProviderRef); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(p.out, "\nInputs of Module Definition %s\n", o.ModuleDefName)
+	input, err := p.askObject(field.NewPath("input"), schema)
+	if err != nil {
+		return err
+	}
+
+	module := map[string]interface{}{
+		"apiVersion": v1alpha1.GroupVersion.String(),
+		"kind":       "Module",
+		"metadata": map[string]interface{}{
+			"name":      o.Name,
+			"namespace": o.Namespace,
+		},
+		"spec": map[string]interface{}{
+			"moduleDef": o.ModuleDefName,
+			"providerRef": map[string]interface{}{
+				"name": o.ProviderRef,
+			},
+			"resource": map[string]interface{}{
+				"input": input,
+			},
+		},
+	}
+	data, err := yaml.Marshal(module)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "\n%s\n", data)
+
+	for {
+		answer, err := p.ask("[s]ave to a file, [a]pply to the cluster or [q]uit", "s")
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(answer) {
+		case "s", "save":
+			filename, err := p.askString("file", o.Name+".yaml")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filename, data, 0o644); err != nil {
+				return err
+			}
+			fmt.Fprintf(p.out, "Module %s saved to %s\n", o.Name, filename)
+			return nil
+		case "a", "apply":
+			return o.apply(data)
+		case "q", "quit":
+			return nil
+		}
+	}
+}
+
+func (o *ModuleCreateOptions) apply(data []byte) error {
+	client, err := o.DynamicClient()
+	if err != nil {
+		return err
+	}
+	mapper, err := o.Mapper()
+	if err != nil {
+		return err
+	}
+
+	a := &applier{
+		out:    o.Out,
+		client: client,
+		mapper: mapper,
+		dryRun: DryRunNone,
+	}
+	return a.apply(data)
+}
+
+// prompter asks for the values of the fields of a schema, line by line
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints the question and returns the trimmed answer, or the default value if the answer is empty
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errors.New("no answer, the input ended")
+		}
+		return "", err
+	}
+
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		answer = def
+	}
+	return answer, nil
+}
+
+// askString asks until a non empty answer is given
+func (p *prompter) askString(question, def string) (string, error) {
+	for {
+		answer, err := p.ask(question, def)
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Fprintln(p.out, "  a value is required")
+	}
+}
+
+func (p *prompter) confirm(question string) (bool, error) {
+	for {
+		answer, err := p.ask(question+" (y/n)", "n")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(p.out, "  answer y or n")
+	}
+}
+
+// askObject asks for the properties of the object, the required ones first
+func (p *prompter) askObject(path *field.Path, schema map[string]interface{}) (map[string]interface{}, error) {
+	props, _ := schema["properties"].(map[string]interface{})
+	required := stringList(schema["required"])
+	var optional []string
+	for name := range props {
+		if !contains(required, name) {
+			optional = append(optional, name)
+		}
+	}
+	sort.Strings(required)
+	sort.Strings(optional)
+
+	obj := map[string]interface{}{}
+	for _, name := range append(required, optional...) {
+		prop, _ := props[name].(map[string]interface{})
+		value, set, err := p.askField(path.Child(name), prop, contains(required, name))
+		if err != nil {
+			return nil, err
+		}
+		if set {
+			obj[name] = value
+		}
+	}
+
+	if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		for {
+			key, err := p.ask(fmt.Sprintf("key of %s, empty to finish", path), "")
+			if err != nil {
+				return nil, err
+			}
+			if key == "" {
+				break
+			}
+			value, _, err := p.askField(path.Key(key), additional, true)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = value
+		}
+	}
+
+	return obj, nil
+}
+
+// askField describes the field and asks for its value. An optional field left empty is not set.
+func (p *prompter) askField(path *field.Path, prop map[string]interface{}, required bool) (interface{}, bool, error) {
+	typ := schemaType(prop)
+	fmt.Fprintf(p.out, "\n%s (%s", path, typ)
+	if required {
+		fmt.Fprint(p.out, ", required")
+	}
+	fmt.Fprintln(p.out, ")")
+	if desc, _ := prop["description"].(string); desc != "" {
+		for _, line := range strings.Split(strings.TrimSpace(desc), "\n") {
+			fmt.Fprintf(p.out, "  %s\n", line)
+		}
+	}
+	if def, ok := prop["default"]; ok {
+		data, _ := yaml.Marshal(def)
+		fmt.Fprintf(p.out, "  default: %s\n", strings.TrimSpace(string(data)))
+	}
+	if enum, ok := prop["enum"].([]interface{}); ok && len(enum) > 0 {
+		fmt.Fprintf(p.out, "  one of: %v\n", enum)
+	}
+
+	switch typ {
+	case "object":
+		if !required {
+			ok, err := p.confirm("set " + path.String() + "?")
+			if err != nil || !ok {
+				return nil, false, err
+			}
+		}
+		obj, err := p.askObject(path, prop)
+		return obj, err == nil, err
+	case "array":
+		if !required {
+			ok, err := p.confirm("set " + path.String() + "?")
+			if err != nil || !ok {
+				return nil, false, err
+			}
+		}
+		list, err := p.askArray(path, prop)
+		return list, err == nil, err
+	}
+
+	for {
+		answer, err := p.ask(path.String(), "")
+		if err != nil {
+			return nil, false, err
+		}
+		if answer == "" {
+			if !required {
+				return nil, false, nil
+			}
+			if def, ok := prop["default"]; ok {
+				return def, true, nil
+			}
+			fmt.Fprintln(p.out, "  a value is required")
+			continue
+		}
+
+		value, err := parseAnswer(answer, typ)
+		if err != nil {
+			fmt.Fprintf(p.out, "  %v\n", err)
+			continue
+		}
+		errs, err := validateInput(path, value, prop)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(p.out, "  %s\n", e.ErrorBody())
+			}
+			continue
+		}
+		return value, true, nil
+	}
+}
+
+// askArray asks for the elements of the array until the list satisfies its schema
+func (p *prompter) askArray(path *field.Path, prop map[string]interface{}) ([]interface{}, error) {
+	for {
+		list, err := p.askElements(path, prop)
+		if err != nil {
+			return nil, err
+		}
+
+		errs, err := validateInput(path, list, prop)
+		if err != nil {
+			return nil, err
+		}
+		if len(errs) == 0 {
+			return list, nil
+		}
+		for _, e := range errs {
+			fmt.Fprintf(p.out, "  %s\n", e.Error())
+		}
+		fmt.Fprintf(p.out, "  enter the elements of %s again\n", path)
+	}
+}
+
+// askElements asks for the elements of the list one by one. The elements are asked for without
+// confirmation up to minItems and no more are offered after maxItems.
+func (p *prompter) askElements(path *field.Path, prop map[string]interface{}) ([]interface{}, error) {
+	list := []interface{}{}
+	sub, _ := prop["items"].(map[string]interface{})
+	min, _ := prop["minItems"].(float64)
+	max, hasMax := prop["maxItems"].(float64)
+	for i := 0; !hasMax || float64(i) < max; i++ {
+		if float64(i) >= min {
+			ok, err := p.confirm(fmt.Sprintf("add an element to %s?", path))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+		}
+		value, _, err := p.askField(path.Index(i), sub, true)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// parseAnswer converts the answer to a value of the type, an answer for any type is parsed as yaml
+func parseAnswer(answer, typ string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return answer, nil
+	case "number":
+		f, err := strconv.ParseFloat(answer, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", answer)
+		}
+		return f, nil
+	case "integer":
+		i, err := strconv.ParseInt(answer, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", answer)
+		}
+		return float64(i), nil
+	case "boolean":
+		switch strings.ToLower(answer) {
+		case "y", "yes", "true":
+			return true, nil
+		case "n", "no", "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q is not a boolean, answer true or false", answer)
+	}
+
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(answer), &value); err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+	var normalized interface{}
+	if err := normalizeJSON(value, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
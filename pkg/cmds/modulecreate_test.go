@@ -0,0 +1,283 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func TestParseAnswer(t *testing.T) {
+	cases := []struct {
+		answer, typ string
+		want        interface{}
+		err         string
+	}{
+		{answer: "a b", typ: "string", want: "a b"},
+		{answer: "1.5", typ: "number", want: 1.5},
+		{answer: "x", typ: "number", err: `"x" is not a number`},
+		{answer: "2", typ: "integer", want: float64(2)},
+		{answer: "1.5", typ: "integer", err: `"1.5" is not an integer`},
+		{answer: "yes", typ: "boolean", want: true},
+		{answer: "false", typ: "boolean", want: false},
+		{answer: "maybe", typ: "boolean", err: `"maybe" is not a boolean, answer true or false`},
+		{answer: "{a: [1, b]}", typ: "any", want: map[string]interface{}{"a": []interface{}{float64(1), "b"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.typ+" "+c.answer, func(t *testing.T) {
+			got, err := parseAnswer(c.answer, c.typ)
+			if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+				t.Fatalf("expected error %q, got %v", c.err, err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %#v, got %#v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestPrompterAskField(t *testing.T) {
+	cases := []struct {
+		name     string
+		prop     string
+		required bool
+		script   string
+		want     interface{}
+		set      bool
+		output   []string
+	}{
+		{
+			name:     "re-prompted until valid",
+			prop:     `{type: string, pattern: "^[a-z]+$"}`,
+			required: true,
+			script:   "\nVPC\nvpc\n",
+			want:     "vpc",
+			set:      true,
+			output:   []string{"a value is required", "should match '^[a-z]+$'"},
+		},
+		{
+			name:     "default",
+			prop:     `{type: number, default: 2}`,
+			required: true,
+			script:   "\n",
+			want:     float64(2),
+			set:      true,
+			output:   []string{"default: 2"},
+		},
+		{
+			name:   "optional left empty",
+			prop:   `{type: boolean}`,
+			script: "\n",
+		},
+		{
+			name:     "enum",
+			prop:     `{type: string, enum: [a, b]}`,
+			required: true,
+			script:   "c\nb\n",
+			want:     "b",
+			set:      true,
+			output:   []string{"one of: [a b]", `Unsupported value: "c"`},
+		},
+		{
+			name:   "optional object",
+			prop:   `{type: object, required: [a], properties: {a: {type: integer}}}`,
+			script: "y\nx\n3\n",
+			want:   map[string]interface{}{"a": float64(3)},
+			set:    true,
+			output: []string{`"x" is not an integer`},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var prop map[string]interface{}
+			if err := yaml.Unmarshal([]byte(c.prop), &prop); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			p := &prompter{in: bufio.NewReader(strings.NewReader(c.script)), out: &out}
+
+			got, set, err := p.askField(field.NewPath("x"), prop, c.required)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) || set != c.set {
+				t.Errorf("expected %#v (set %v), got %#v (set %v)", c.want, c.set, got, set)
+			}
+			for _, s := range c.output {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("expected %q in the output\n%s", s, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestPrompterAskArray(t *testing.T) {
+	cases := []struct {
+		name   string
+		prop   string
+		script string
+		want   []interface{}
+		output []string
+		err    string
+	}{
+		{
+			name:   "list",
+			prop:   `{type: array, items: {type: string}}`,
+			script: "y\na\ny\nb\nn\n",
+			want:   []interface{}{"a", "b"},
+		},
+		{
+			name:   "empty list",
+			prop:   `{type: array, items: {type: string}}`,
+			script: "n\n",
+			want:   []interface{}{},
+		},
+		{
+			name:   "elements up to minItems asked without confirmation",
+			prop:   `{type: array, minItems: 2, items: {type: string}}`,
+			script: "a\nb\nn\n",
+			want:   []interface{}{"a", "b"},
+		},
+		{
+			name:   "no more elements offered after maxItems",
+			prop:   `{type: array, maxItems: 2, items: {type: string}}`,
+			script: "y\na\ny\nb\n",
+			want:   []interface{}{"a", "b"},
+		},
+		{
+			name:   "elements re-prompted until they match the pattern",
+			prop:   `{type: array, items: {type: string, pattern: "^[0-9.]+/[0-9]+$"}}`,
+			script: "y\nsubnet\n10.0.0.0/24\nn\n",
+			want:   []interface{}{"10.0.0.0/24"},
+			output: []string{"should match '^[0-9.]+/[0-9]+$'"},
+		},
+		{
+			name:   "list re-prompted until valid",
+			prop:   `{type: array, uniqueItems: true, items: {type: string}}`,
+			script: "y\na\ny\na\nn\ny\na\ny\nb\nn\n",
+			want:   []interface{}{"a", "b"},
+			output: []string{"shouldn't contain duplicates", "enter the elements of x again"},
+		},
+		{
+			name:   "input ended",
+			prop:   `{type: array, minItems: 1, items: {type: string}}`,
+			script: "",
+			err:    "no answer, the input ended",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var prop map[string]interface{}
+			if err := yaml.Unmarshal([]byte(c.prop), &prop); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			p := &prompter{in: bufio.NewReader(strings.NewReader(c.script)), out: &out}
+
+			got, err := p.askArray(field.NewPath("x"), prop)
+			if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+				t.Fatalf("expected error %q, got %v", c.err, err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %#v, got %#v", c.want, got)
+			}
+			for _, s := range c.output {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("expected %q in the output\n%s", s, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestModuleCreateRun(t *testing.T) {
+	dir := t.TempDir()
+	defFile := filepath.Join(dir, "moduledef.yaml")
+	if err := os.WriteFile(defFile, []byte(testNewModuleDef), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	moduleFile := filepath.Join(dir, "prod.yaml")
+
+	script := strings.Join([]string{
+		"prod",     // name of the Module
+		"",         // namespace, the default
+		"aws",      // provider secret
+		"vpc",      // input.name
+		"10.0.0.0", // input.subnet.cidr
+		"",         // input.subnet.public
+		"0",        // input.size, below the minimum
+		"2",        // input.size
+		"n",        // set input.tags?
+		"x",        // unknown action
+		"s",        // save
+		moduleFile, // file
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	o := &ModuleCreateOptions{
+		IOStreams:     genericclioptions.IOStreams{In: strings.NewReader(script), Out: &out, ErrOut: &out},
+		ModuleDefName: "vpc",
+		Namespace:     "infra",
+		ModuleDef:     defFile,
+		Interactive:   true,
+		NewBuilder:    resource.NewLocalBuilder,
+	}
+	if err := o.Run(); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	data, err := os.ReadFile(moduleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: tf.kubeform.com/v1alpha1
+kind: Module
+metadata:
+  name: prod
+  namespace: infra
+spec:
+  moduleDef: vpc
+  providerRef:
+    name: aws
+  resource:
+    input:
+      name: vpc
+      size: 2
+      subnet:
+        cidr: 10.0.0.0
+`
+	if string(data) != want {
+		t.Errorf("expected Module\n%s\ngot\n%s", want, data)
+	}
+	if s := "Module prod saved to " + moduleFile; !strings.Contains(out.String(), s) {
+		t.Errorf("expected %q in the output\n%s", s, out.String())
+	}
+}
@@ -0,0 +1,518 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"text/tabwriter"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+type ModuleDiffOptions struct {
+	Name string
+	Ref  string
+
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+
+	genericclioptions.IOStreams
+}
+
+// schemaChange is a change of the schema of a Module Definition. A breaking change may make the
+// existing Module objects invalid or break the consumers of their outputs.
+type schemaChange struct {
+	Path     string
+	Breaking bool
+	Change   string
+}
+
+func NewCmdModuleDiff(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ModuleDiffOptions{IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:               "diff [name]",
+		Short:             "Show the schema changes of a Module Definition at another ref of its module, failing on breaking changes",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Ref, "ref", "", "ref of the module repository to compare the live Module Definition with")
+
+	return cmd
+}
+
+func (o *ModuleDiffOptions) Complete(f cmdutil.Factory, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("you must specify the name of the Module Definition")
+	}
+	o.Name = args[0]
+
+	var err error
+	o.DynamicClient, err = f.DynamicClient()
+	if err != nil {
+		return err
+	}
+	o.KubeClient, err = f.KubernetesClientSet()
+	return err
+}
+
+func (o *ModuleDiffOptions) Validate() error {
+	if o.Ref == "" {
+		return fmt.Errorf("you must specify the ref to compare with using --ref")
+	}
+	return nil
+}
+
+func (o *ModuleDiffOptions) Run() error {
+	live, err := o.DynamicClient.Resource(moduleDefinitionResource).Get(context.TODO(), o.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	var md v1alpha1.ModuleDefinition
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, &md); err != nil {
+		return err
+	}
+
+	regenerated, err := regenerateModule(o.KubeClient, &md, o.Ref, true)
+	if err != nil {
+		return err
+	}
+	liveSchema, _, err := unstructured.NestedFieldNoCopy(live.Object, "spec", "schema")
+	if err != nil {
+		return err
+	}
+
+	var oldSchema map[string]interface{}
+	if err := normalizeJSON(liveSchema, &oldSchema); err != nil {
+		return err
+	}
+
+	changes := diffModuleSchemas(oldSchema, regenerated.Schema)
+	if len(changes) == 0 {
+		fmt.Fprintf(o.Out, "schema of Module Definition %s is unchanged at ref %s\n", o.Name, o.Ref)
+		return nil
+	}
+
+	breaking, err := printSchemaChanges(o.Out, changes)
+	if err != nil {
+		return err
+	}
+	if breaking > 0 {
+		return fmt.Errorf("%d breaking changes in the schema of Module Definition %s at ref %s", breaking, o.Name, o.Ref)
+	}
+
+	return nil
+}
+
+// printSchemaChanges prints the schema changes and returns the number of breaking ones
+func printSchemaChanges(out io.Writer, changes []schemaChange) (int, error) {
+	breaking := 0
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "IMPACT\tPATH\tCHANGE")
+	for _, c := range changes {
+		impact := "non-breaking"
+		if c.Breaking {
+			impact = "BREAKING"
+			breaking++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", impact, c.Path, c.Change)
+	}
+
+	return breaking, w.Flush()
+}
+
+// diffModuleSchemas classifies the changes from the old to the new schema of a Module Definition.
+// An input breaks the existing Module objects when it is removed or renamed, becomes required or
+// accepts less than before. An output breaks its consumers when it is removed or changes type.
+func diffModuleSchemas(oldSchema, newSchema map[string]interface{}) []schemaChange {
+	d := &schemaDiffer{}
+	for _, section := range []string{"input", "output"} {
+		oldSection, _, _ := unstructured.NestedMap(oldSchema, "properties", section)
+		newSection, _, _ := unstructured.NestedMap(newSchema, "properties", section)
+		d.properties(section, oldSection, newSection, section == "input")
+	}
+
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		return d.changes[i].Path < d.changes[j].Path
+	})
+	return d.changes
+}
+
+type schemaDiffer struct {
+	changes []schemaChange
+}
+
+func (d *schemaDiffer) add(path string, breaking bool, format string, args ...interface{}) {
+	d.changes = append(d.changes, schemaChange{
+		Path:     path,
+		Breaking: breaking,
+		Change:   fmt.Sprintf(format, args...),
+	})
+}
+
+// properties compares the properties of two object schemas
+func (d *schemaDiffer) properties(path string, oldObj, newObj map[string]interface{}, input bool) {
+	oldProps, _, _ := unstructured.NestedMap(oldObj, "properties")
+	newProps, _, _ := unstructured.NestedMap(newObj, "properties")
+	oldRequired := stringSet(oldObj["required"])
+	newRequired := stringSet(newObj["required"])
+
+	var removed, added []string
+	for name := range oldProps {
+		if _, ok := newProps[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	for name := range newProps {
+		if _, ok := oldProps[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+
+	for _, name := range removed {
+		change := "removed"
+		// a renamed property shows up as a removed and an added one of the same schema
+		for _, other := range added {
+			if reflect.DeepEqual(oldProps[name], newProps[other]) {
+				change = fmt.Sprintf("removed, possibly renamed to %s", other)
+				break
+			}
+		}
+		d.add(path+"."+name, true, "%s", change)
+	}
+	for _, name := range added {
+		if input && newRequired[name] {
+			d.add(path+"."+name, true, "added as required")
+		} else {
+			d.add(path+"."+name, false, "added")
+		}
+	}
+
+	var names []string
+	for name := range oldProps {
+		if _, ok := newProps[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := path + "." + name
+		if input {
+			switch {
+			case newRequired[name] && !oldRequired[name]:
+				d.add(p, true, "became required")
+			case oldRequired[name] && !newRequired[name]:
+				d.add(p, false, "became optional")
+			}
+		}
+
+		oldProp, _ := oldProps[name].(map[string]interface{})
+		newProp, _ := newProps[name].(map[string]interface{})
+		d.property(p, oldProp, newProp, input)
+	}
+}
+
+// property compares two property schemas
+func (d *schemaDiffer) property(path string, oldProp, newProp map[string]interface{}, input bool) {
+	if reflect.DeepEqual(oldProp, newProp) {
+		return
+	}
+	before := len(d.changes)
+
+	oldType, newType := schemaType(oldProp), schemaType(newProp)
+	if oldType != newType {
+		if input && acceptsTypesOf(newProp, oldProp) {
+			d.add(path, false, "type widened from %s to %s", oldType, newType)
+		} else {
+			d.add(path, true, "type changed from %s to %s", oldType, newType)
+		}
+		return
+	}
+
+	switch oldType {
+	case "object":
+		d.properties(path, oldProp, newProp, input)
+
+		oldAdditional, _, _ := unstructured.NestedMap(oldProp, "additionalProperties")
+		newAdditional, _, _ := unstructured.NestedMap(newProp, "additionalProperties")
+		if oldAdditional != nil || newAdditional != nil {
+			d.property(path+"[*]", oldAdditional, newAdditional, input)
+		}
+	case "array":
+		oldItems, newItems := oldProp["items"], newProp["items"]
+		oldItem, oldIsSchema := oldItems.(map[string]interface{})
+		newItem, newIsSchema := newItems.(map[string]interface{})
+		switch {
+		case oldIsSchema && newIsSchema:
+			d.property(path+"[]", oldItem, newItem, input)
+		case !reflect.DeepEqual(oldItems, newItems):
+			d.add(path, true, "element types changed")
+		}
+	case "any":
+		switch {
+		case reflect.DeepEqual(acceptedTypes(oldProp), acceptedTypes(newProp)):
+		case input && acceptsTypesOf(newProp, oldProp):
+			d.add(path, false, "accepted types widened")
+		default:
+			d.add(path, true, "accepted types changed")
+		}
+	}
+
+	if !input {
+		return
+	}
+
+	oldNullable, _ := oldProp["nullable"].(bool)
+	newNullable, _ := newProp["nullable"].(bool)
+	switch {
+	case oldNullable && !newNullable:
+		d.add(path, true, "no longer nullable")
+	case !oldNullable && newNullable:
+		d.add(path, false, "became nullable")
+	}
+
+	if !reflect.DeepEqual(oldProp["default"], newProp["default"]) {
+		d.add(path, false, "default changed")
+	}
+
+	d.constraints(path, oldProp, newProp)
+
+	oldRules, newRules := validationRules(oldProp), validationRules(newProp)
+	for _, rule := range newRules {
+		if !contains(oldRules, rule) {
+			d.add(path, true, "validation rule added: %s", rule)
+		}
+	}
+	for _, rule := range oldRules {
+		if !contains(newRules, rule) {
+			d.add(path, false, "validation rule removed: %s", rule)
+		}
+	}
+
+	// a change of a keyword not compared above may reject the values of the existing Module objects
+	if len(d.changes) == before && !reflect.DeepEqual(valueKeywords(oldProp), valueKeywords(newProp)) {
+		d.add(path, true, "schema changed")
+	}
+}
+
+// valueKeywords returns the keywords of the property schema that may restrict its values, leaving out
+// the nested schemas compared on their own and the descriptive keywords
+func valueKeywords(prop map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range prop {
+		switch k {
+		case "properties", "additionalProperties", "items", "description", "title", "example":
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// lowerBounds and upperBounds are the keywords the validation rules of the variables are turned into
+var (
+	lowerBounds = []string{"minimum", "minLength", "minItems", "minProperties"}
+	upperBounds = []string{"maximum", "maxLength", "maxItems", "maxProperties"}
+)
+
+// constraints compares the constraints of two input property schemas, a tighter constraint may
+// reject the values of the existing Module objects
+func (d *schemaDiffer) constraints(path string, oldProp, newProp map[string]interface{}) {
+	for _, keyword := range lowerBounds {
+		oldBound, oldOK := oldProp[keyword].(float64)
+		newBound, newOK := newProp[keyword].(float64)
+		switch {
+		case newOK && (!oldOK || newBound > oldBound):
+			d.add(path, true, "%s raised to %v", keyword, newBound)
+		case oldOK && (!newOK || newBound < oldBound):
+			d.add(path, false, "%s lowered", keyword)
+		}
+	}
+	for _, keyword := range upperBounds {
+		oldBound, oldOK := oldProp[keyword].(float64)
+		newBound, newOK := newProp[keyword].(float64)
+		switch {
+		case newOK && (!oldOK || newBound < oldBound):
+			d.add(path, true, "%s lowered to %v", keyword, newBound)
+		case oldOK && (!newOK || newBound > oldBound):
+			d.add(path, false, "%s raised", keyword)
+		}
+	}
+
+	for _, keywords := range [][2]string{{"minimum", "exclusiveMinimum"}, {"maximum", "exclusiveMaximum"}} {
+		keyword, exclusive := keywords[0], keywords[1]
+		oldBound, oldOK := oldProp[keyword].(float64)
+		newBound, newOK := newProp[keyword].(float64)
+		if !oldOK || !newOK || oldBound != newBound {
+			// a new or changed bound is reported above
+			continue
+		}
+		oldExclusive, _ := oldProp[exclusive].(bool)
+		newExclusive, _ := newProp[exclusive].(bool)
+		switch {
+		case newExclusive && !oldExclusive:
+			d.add(path, true, "%s %v became exclusive", keyword, newBound)
+		case oldExclusive && !newExclusive:
+			d.add(path, false, "%s %v became inclusive", keyword, newBound)
+		}
+	}
+
+	if oldPattern, newPattern := oldProp["pattern"], newProp["pattern"]; !reflect.DeepEqual(oldPattern, newPattern) {
+		if newPattern != nil {
+			d.add(path, true, "pattern changed to %v", newPattern)
+		} else {
+			d.add(path, false, "pattern removed")
+		}
+	}
+
+	oldEnum, _ := oldProp["enum"].([]interface{})
+	newEnum, _ := newProp["enum"].([]interface{})
+	if len(newEnum) > 0 {
+		for _, v := range oldEnum {
+			if !containsValue(newEnum, v) {
+				d.add(path, true, "allowed value %v removed", v)
+			}
+		}
+		if len(oldEnum) == 0 {
+			d.add(path, true, "restricted to the values %v", newEnum)
+		}
+	}
+	for _, v := range newEnum {
+		if len(oldEnum) > 0 && !containsValue(oldEnum, v) {
+			d.add(path, false, "allowed value %v added", v)
+		}
+	}
+	if len(oldEnum) > 0 && len(newEnum) == 0 {
+		d.add(path, false, "no longer restricted to the values %v", oldEnum)
+	}
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedTypes returns the types of the values the property accepts whatever their content, nil
+// if it accepts values of any type. An integer is a number as well.
+func acceptedTypes(prop map[string]interface{}) map[string]bool {
+	if typ, ok := prop["type"].(string); ok && typ != "" {
+		types := map[string]bool{typ: true}
+		if typ == "number" {
+			types["integer"] = true
+		}
+		return types
+	}
+	if intOrString, _ := prop["x-kubernetes-int-or-string"].(bool); intOrString {
+		return map[string]bool{"integer": true, "string": true}
+	}
+
+	anyOf, _ := prop["anyOf"].([]interface{})
+	if len(anyOf) == 0 {
+		return nil
+	}
+	types := map[string]bool{}
+	for _, item := range anyOf {
+		schema, _ := item.(map[string]interface{})
+		// a constrained alternative accepts only some of the values of its type
+		if len(schema) != 1 {
+			continue
+		}
+		itemTypes := acceptedTypes(schema)
+		if itemTypes == nil {
+			return nil
+		}
+		for typ := range itemTypes {
+			types[typ] = true
+		}
+	}
+	return types
+}
+
+// acceptsTypesOf tells whether the new property accepts every value of the types accepted by the
+// old property, e.g. a number accepts the values of an integer and a property without a type
+// accepts the values of any type
+func acceptsTypesOf(newProp, oldProp map[string]interface{}) bool {
+	newTypes := acceptedTypes(newProp)
+	if newTypes == nil {
+		return true
+	}
+	oldTypes := acceptedTypes(oldProp)
+	if oldTypes == nil {
+		return false
+	}
+	for typ := range oldTypes {
+		if !newTypes[typ] {
+			return false
+		}
+	}
+	return true
+}
+
+// schemaType returns the type of the property, any for the properties accepting values of
+// different types
+func schemaType(prop map[string]interface{}) string {
+	if typ, ok := prop["type"].(string); ok && typ != "" {
+		return typ
+	}
+	return "any"
+}
+
+func validationRules(prop map[string]interface{}) []string {
+	var rules []string
+	items, _ := prop[ValidationsExtension].([]interface{})
+	for _, item := range items {
+		if rule, ok := item.(map[string]interface{}); ok {
+			if r, ok := rule["rule"].(string); ok {
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules
+}
+
+func stringSet(v interface{}) map[string]bool {
+	set := map[string]bool{}
+	for _, s := range stringList(v) {
+		set[s] = true
+	}
+	return set
+}
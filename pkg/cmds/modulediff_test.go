@@ -0,0 +1,236 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestDiffModuleSchemas(t *testing.T) {
+	typed := func(typ string) map[string]interface{} {
+		return map[string]interface{}{"type": typ}
+	}
+	anyOf := func(types ...string) map[string]interface{} {
+		var items []interface{}
+		for _, typ := range types {
+			items = append(items, typed(typ))
+		}
+		return map[string]interface{}{"anyOf": items}
+	}
+	anyValue := map[string]interface{}{"x-kubernetes-preserve-unknown-fields": true}
+	schema := func(section string, props map[string]interface{}, required ...string) map[string]interface{} {
+		obj := map[string]interface{}{"type": "object", "properties": props}
+		if len(required) > 0 {
+			var names []interface{}
+			for _, name := range required {
+				names = append(names, name)
+			}
+			obj["required"] = names
+		}
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{section: obj},
+		}
+	}
+	input := func(prop map[string]interface{}) map[string]interface{} {
+		return schema("input", map[string]interface{}{"x": prop})
+	}
+
+	cases := []struct {
+		name     string
+		old, new map[string]interface{}
+		want     []schemaChange
+	}{
+		{
+			name: "unchanged",
+			old:  input(typed("string")),
+			new:  input(typed("string")),
+		},
+		{
+			name: "input widened to any value",
+			old:  input(typed("string")),
+			new:  input(anyValue),
+			want: []schemaChange{{Path: "input.x", Change: "type widened from string to any"}},
+		},
+		{
+			name: "input widened from integer to number",
+			old:  input(typed("integer")),
+			new:  input(typed("number")),
+			want: []schemaChange{{Path: "input.x", Change: "type widened from integer to number"}},
+		},
+		{
+			name: "input changed to any of other types",
+			old:  input(typed("string")),
+			new:  input(anyOf("number", "boolean")),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "type changed from string to any"}},
+		},
+		{
+			name: "input changed to any of a superset of types",
+			old:  input(typed("string")),
+			new:  input(anyOf("string", "number")),
+			want: []schemaChange{{Path: "input.x", Change: "type widened from string to any"}},
+		},
+		{
+			name: "input narrowed from any value",
+			old:  input(anyValue),
+			new:  input(typed("string")),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "type changed from any to string"}},
+		},
+		{
+			name: "input accepts more types",
+			old:  input(anyOf("string", "number")),
+			new:  input(anyOf("string", "number", "boolean")),
+			want: []schemaChange{{Path: "input.x", Change: "accepted types widened"}},
+		},
+		{
+			name: "input accepts fewer types",
+			old:  input(anyOf("string", "number")),
+			new:  input(anyOf("string", "boolean")),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "accepted types changed"}},
+		},
+		{
+			name: "input accepts any value instead of some types",
+			old:  input(anyOf("string", "number")),
+			new:  input(anyValue),
+			want: []schemaChange{{Path: "input.x", Change: "accepted types widened"}},
+		},
+		{
+			name: "input changed to a constrained alternative",
+			old:  input(typed("string")),
+			new: input(map[string]interface{}{"anyOf": []interface{}{
+				map[string]interface{}{"type": "string", "maxLength": int64(3)},
+				typed("number"),
+			}}),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "type changed from string to any"}},
+		},
+		{
+			name: "output widened to any value",
+			old:  schema("output", map[string]interface{}{"x": typed("string")}),
+			new:  schema("output", map[string]interface{}{"x": anyValue}),
+			want: []schemaChange{{Path: "output.x", Breaking: true, Change: "type changed from string to any"}},
+		},
+		{
+			name: "input added as required",
+			old:  schema("input", map[string]interface{}{}),
+			new:  schema("input", map[string]interface{}{"x": typed("string")}, "x"),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "added as required"}},
+		},
+		{
+			name: "input renamed",
+			old:  schema("input", map[string]interface{}{"x": typed("string")}),
+			new:  schema("input", map[string]interface{}{"y": typed("string")}),
+			want: []schemaChange{
+				{Path: "input.x", Breaking: true, Change: "removed, possibly renamed to y"},
+				{Path: "input.y", Change: "added"},
+			},
+		},
+		{
+			name: "input became optional",
+			old:  schema("input", map[string]interface{}{"x": typed("string")}, "x"),
+			new:  schema("input", map[string]interface{}{"x": typed("string")}),
+			want: []schemaChange{{Path: "input.x", Change: "became optional"}},
+		},
+		{
+			name: "input maximum lowered",
+			old:  input(map[string]interface{}{"type": "integer", "maximum": float64(10)}),
+			new:  input(map[string]interface{}{"type": "integer", "maximum": float64(5)}),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "maximum lowered to 5"}},
+		},
+		{
+			name: "input minimum became exclusive",
+			old:  input(map[string]interface{}{"type": "number", "minimum": float64(0)}),
+			new:  input(map[string]interface{}{"type": "number", "minimum": float64(0), "exclusiveMinimum": true}),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "minimum 0 became exclusive"}},
+		},
+		{
+			name: "input maximum became inclusive",
+			old:  input(map[string]interface{}{"type": "number", "maximum": float64(10), "exclusiveMaximum": true}),
+			new:  input(map[string]interface{}{"type": "number", "maximum": float64(10)}),
+			want: []schemaChange{{Path: "input.x", Change: "maximum 10 became inclusive"}},
+		},
+		{
+			name: "input format added",
+			old:  input(typed("string")),
+			new:  input(map[string]interface{}{"type": "string", "format": "uuid"}),
+			want: []schemaChange{{Path: "input.x", Breaking: true, Change: "schema changed"}},
+		},
+		{
+			name: "input description changed",
+			old:  input(map[string]interface{}{"type": "string", "description": "old"}),
+			new:  input(map[string]interface{}{"type": "string", "description": "new"}),
+		},
+		{
+			name: "input allowed value added",
+			old:  input(map[string]interface{}{"type": "string", "enum": []interface{}{"a"}}),
+			new:  input(map[string]interface{}{"type": "string", "enum": []interface{}{"a", "b"}}),
+			want: []schemaChange{{Path: "input.x", Change: "allowed value b added"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := diffModuleSchemas(c.old, c.new)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestPrintSchemaChanges(t *testing.T) {
+	var out bytes.Buffer
+	breaking, err := printSchemaChanges(&out, []schemaChange{
+		{Path: "input.x", Breaking: true, Change: "removed"},
+		{Path: "input.y", Change: "added"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breaking != 1 {
+		t.Errorf("expected 1 breaking change, got %d", breaking)
+	}
+
+	want := "IMPACT        PATH     CHANGE\nBREAKING      input.x  removed\nnon-breaking  input.y  added\n"
+	if out.String() != want {
+		t.Errorf("expected output\n%s\ngot\n%s", want, out.String())
+	}
+}
+
+func TestModuleDiffRun(t *testing.T) {
+	md := &v1alpha1.ModuleDefinition{}
+	md.Name = "vpc"
+
+	var out bytes.Buffer
+	o := ModuleDiffOptions{
+		Name:          "vpc",
+		Ref:           "v2",
+		DynamicClient: moduleDefinitionTestServer(t, md),
+		IOStreams:     genericclioptions.IOStreams{Out: &out, ErrOut: &out},
+	}
+	if err := o.Run(); err == nil {
+		t.Error("expected an error for a Module Definition without moduleRef")
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got %q", out.String())
+	}
+}
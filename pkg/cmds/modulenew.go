@@ -0,0 +1,404 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+type ModuleNewOptions struct {
+	ModuleDefName string
+	Name          string
+	Namespace     string
+	ProviderRef   string
+	ModuleDef     string
+	ValuesFiles   []string
+	Values        []string
+	FileValues    []string
+
+	NewBuilder    func() *resource.Builder
+	DynamicClient func() (dynamic.Interface, error)
+
+	genericclioptions.IOStreams
+}
+
+func NewCmdModuleNew(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ModuleNewOptions{IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:               "new [moduledef] [name]",
+		Short:             "Print a Module of the Module Definition, with its inputs to fill in",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, args))
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.ProviderRef, "provider-ref", "", "name of the secret holding the provider credentials, referred by spec.providerRef")
+	cmd.Flags().StringVar(&o.ModuleDef, "module-def", "", "file containing the Module Definition, read from the cluster if not given")
+	cmd.Flags().StringArrayVarP(&o.ValuesFiles, "values", "f", nil, "yaml files of input values")
+	cmd.Flags().StringArrayVar(&o.Values, "set", nil, "input value as key=value, the key may be a dotted path into an object and the value is parsed as yaml")
+	cmd.Flags().StringArrayVar(&o.FileValues, "set-file", nil, "input value as key=path, the value is the content of the file")
+
+	return cmd
+}
+
+func (o *ModuleNewOptions) Complete(f cmdutil.Factory, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("you must specify the name of the Module Definition and the name of the Module")
+	}
+	o.ModuleDefName, o.Name = args[0], args[1]
+
+	var err error
+	o.Namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		o.Namespace = metav1.NamespaceDefault
+	}
+
+	o.NewBuilder = f.NewBuilder
+	o.DynamicClient = f.DynamicClient
+	return nil
+}
+
+func (o *ModuleNewOptions) Run() error {
+	def, err := o.moduleDefinition()
+	if err != nil {
+		return err
+	}
+	inputSchema, found, err := unstructured.NestedFieldNoCopy(def.Object, "spec", "schema", "properties", "input")
+	if err != nil || !found {
+		return fmt.Errorf("the Module Definition %s has no spec.schema.properties.input", o.ModuleDefName)
+	}
+	var schema map[string]interface{}
+	if err := normalizeJSON(inputSchema, &schema); err != nil {
+		return err
+	}
+
+	values, err := o.values()
+	if err != nil {
+		return err
+	}
+	if err := validateModuleValues(schema, values); err != nil {
+		return err
+	}
+
+	data, err := scaffoldModule(o.Name, o.Namespace, o.ModuleDefName, o.ProviderRef, schema, values)
+	if err != nil {
+		return err
+	}
+	_, err = o.Out.Write(data)
+	return err
+}
+
+func (o *ModuleNewOptions) moduleDefinition() (*unstructured.Unstructured, error) {
+	if o.ModuleDef != "" {
+		objs, err := loadLocalObjects(o.NewBuilder, resource.FilenameOptions{Filenames: []string{o.ModuleDef}})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			if obj.GetKind() == "ModuleDefinition" && obj.GetName() == o.ModuleDefName {
+				return obj, nil
+			}
+		}
+		return nil, fmt.Errorf("the Module Definition %s is not found in %s", o.ModuleDefName, o.ModuleDef)
+	}
+
+	client, err := o.DynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Resource(moduleDefinitionResource).Get(context.TODO(), o.ModuleDefName, metav1.GetOptions{})
+}
+
+// values merges the input values of the values files, --set and --set-file, in that order
+func (o *ModuleNewOptions) values() (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	for _, filename := range o.ValuesFiles {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		current := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("invalid values file %s: %v", filename, err)
+		}
+		mergeValues(values, current)
+	}
+
+	for _, kv := range o.Values {
+		key, value, err := splitKeyValue("--set", kv)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("invalid value of --set %s: %v", key, err)
+		}
+		if err := setValue(values, key, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, kv := range o.FileValues {
+		key, filename, err := splitKeyValue("--set-file", kv)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := setValue(values, key, string(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	// the numbers of the values are compared with the ones of the schema
+	var normalized map[string]interface{}
+	if err := normalizeJSON(values, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func splitKeyValue(flag, kv string) (string, string, error) {
+	parts := strings.SplitN(kv, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid %s %q, must be key=value", flag, kv)
+	}
+	return parts[0], parts[1], nil
+}
+
+// setValue sets the value at the dotted path, creating the objects on the way
+func setValue(values map[string]interface{}, key string, value interface{}) error {
+	fields := strings.Split(key, ".")
+	cur := values
+	for i, f := range fields[:len(fields)-1] {
+		next, ok := cur[f].(map[string]interface{})
+		if !ok {
+			if _, exists := cur[f]; exists {
+				return fmt.Errorf("can't set %s, %s is not an object", key, strings.Join(fields[:i+1], "."))
+			}
+			next = map[string]interface{}{}
+			cur[f] = next
+		}
+		cur = next
+	}
+	cur[fields[len(fields)-1]] = value
+	return nil
+}
+
+// mergeValues merges src into dst, the objects are merged key by key
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if dstSub, ok := dst[k].(map[string]interface{}); ok {
+				mergeValues(dstSub, sub)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// validateModuleValues checks the given input values against the schema. The inputs not given are
+// filled in later, so the missing required inputs are not reported.
+func validateModuleValues(schema, values map[string]interface{}) error {
+	full := map[string]interface{}{}
+	for k, v := range inputPlaceholders(schema) {
+		full[k] = v
+	}
+	for k, v := range values {
+		if placeholder, ok := full[k].(map[string]interface{}); ok {
+			if sub, ok := v.(map[string]interface{}); ok {
+				mergeValues(placeholder, sub)
+				continue
+			}
+		}
+		full[k] = v
+	}
+
+	root := field.NewPath("spec", "resource", "input")
+	all, err := validateInput(root, full, schema)
+	if err != nil {
+		return err
+	}
+
+	var errs field.ErrorList
+	for _, e := range all {
+		for k := range values {
+			if p := root.Child(k).String(); e.Field == p || strings.HasPrefix(e.Field, p+".") || strings.HasPrefix(e.Field, p+"[") {
+				errs = append(errs, e)
+				break
+			}
+		}
+	}
+
+	return errs.ToAggregate()
+}
+
+// inputPlaceholders returns the placeholders of the required inputs of the schema
+func inputPlaceholders(schema map[string]interface{}) map[string]interface{} {
+	props, _ := schema["properties"].(map[string]interface{})
+	placeholders := map[string]interface{}{}
+	for _, name := range stringList(schema["required"]) {
+		prop, _ := props[name].(map[string]interface{})
+		placeholders[name] = placeholder(prop)
+	}
+	return placeholders
+}
+
+// placeholder returns an empty value of the type of the property
+func placeholder(prop map[string]interface{}) interface{} {
+	switch schemaType(prop) {
+	case "number", "integer":
+		return float64(0)
+	case "boolean":
+		return false
+	case "array":
+		return []interface{}{}
+	case "object":
+		return inputPlaceholders(prop)
+	default:
+		return ""
+	}
+}
+
+// scaffoldModule writes the yaml of the Module. The required inputs not given are filled in with
+// placeholders, the optional ones are commented out with their defaults.
+func scaffoldModule(name, namespace, moduleDef, providerRef string, schema, values map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "apiVersion: %s\n", v1alpha1.GroupVersion.String())
+	fmt.Fprintf(&buf, "kind: Module\n")
+	fmt.Fprintf(&buf, "metadata:\n")
+	if err := writeYAMLField(&buf, "  ", "name", name, false, ""); err != nil {
+		return nil, err
+	}
+	if err := writeYAMLField(&buf, "  ", "namespace", namespace, false, ""); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "spec:\n")
+	if err := writeYAMLField(&buf, "  ", "moduleDef", moduleDef, false, ""); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "  providerRef:\n")
+	comment := ""
+	if providerRef == "" {
+		comment = "required, the secret holding the provider credentials"
+	}
+	if err := writeYAMLField(&buf, "    ", "name", providerRef, false, comment); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "  resource:\n")
+	fmt.Fprintf(&buf, "    input:\n")
+
+	props, _ := schema["properties"].(map[string]interface{})
+	required := stringList(schema["required"])
+	var optional []string
+	for k := range props {
+		if !contains(required, k) {
+			optional = append(optional, k)
+		}
+	}
+	sort.Strings(required)
+	sort.Strings(optional)
+
+	const indent = "      "
+	for _, k := range append(required, optional...) {
+		prop, _ := props[k].(map[string]interface{})
+		if desc, _ := prop["description"].(string); desc != "" {
+			for _, line := range strings.Split(strings.TrimSpace(desc), "\n") {
+				fmt.Fprintf(&buf, "%s# %s\n", indent, strings.TrimRight(line, " "))
+			}
+		}
+
+		value, given := values[k]
+		var err error
+		switch {
+		case given && contains(required, k):
+			if sub, ok := value.(map[string]interface{}); ok {
+				full := inputPlaceholders(prop)
+				mergeValues(full, sub)
+				value = full
+			}
+			err = writeYAMLField(&buf, indent, k, value, false, "")
+		case given:
+			err = writeYAMLField(&buf, indent, k, value, false, "")
+		case contains(required, k):
+			err = writeYAMLField(&buf, indent, k, placeholder(prop), false, "required, "+schemaType(prop))
+		default:
+			err = writeYAMLField(&buf, indent, k, prop["default"], true, "")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeYAMLField writes the key and its value at the indentation, commented out if asked. The
+// comment, if any, is added to the line of the key.
+func writeYAMLField(buf *bytes.Buffer, indent, key string, value interface{}, commented bool, comment string) error {
+	data, err := yaml.Marshal(map[string]interface{}{key: value})
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i, line := range lines {
+		if commented {
+			line = "# " + line
+		}
+		if i == 0 && comment != "" {
+			line += " # " + comment
+		}
+		fmt.Fprintf(buf, "%s%s\n", indent, line)
+	}
+	return nil
+}
+
+func stringList(v interface{}) []string {
+	var list []string
+	items, _ := v.([]interface{})
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,276 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+const testNewModuleDef = `apiVersion: tf.kubeform.com/v1alpha1
+kind: ModuleDefinition
+metadata:
+  name: vpc
+spec:
+  schema:
+    type: object
+    properties:
+      input:
+        type: object
+        required: [name, subnet]
+        properties:
+          name:
+            type: string
+            description: name of the VPC
+          subnet:
+            type: object
+            required: [cidr]
+            properties:
+              cidr: {type: string}
+              public: {type: boolean}
+          size: {type: number, minimum: 1}
+          tags:
+            type: object
+            additionalProperties: {type: string}
+            default: {env: dev}
+`
+
+func testNewInputSchema(t *testing.T) map[string]interface{} {
+	t.Helper()
+
+	var def map[string]interface{}
+	if err := yaml.Unmarshal([]byte(testNewModuleDef), &def); err != nil {
+		t.Fatal(err)
+	}
+	input := def["spec"].(map[string]interface{})["schema"].(map[string]interface{})["properties"].(map[string]interface{})["input"]
+	return input.(map[string]interface{})
+}
+
+func TestSplitKeyValue(t *testing.T) {
+	cases := []struct {
+		kv, key, value string
+		err            bool
+	}{
+		{kv: "a=b", key: "a", value: "b"},
+		{kv: "a.b=c=d", key: "a.b", value: "c=d"},
+		{kv: "a=", key: "a"},
+		{kv: "a", err: true},
+		{kv: "=b", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.kv, func(t *testing.T) {
+			key, value, err := splitKeyValue("--set", c.kv)
+			if (err != nil) != c.err {
+				t.Fatalf("expected error %v, got %v", c.err, err)
+			}
+			if key != c.key || value != c.value {
+				t.Errorf("expected %q=%q, got %q=%q", c.key, c.value, key, value)
+			}
+		})
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	cases := []struct {
+		name   string
+		values map[string]interface{}
+		key    string
+		want   map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "top level",
+			values: map[string]interface{}{},
+			key:    "a",
+			want:   map[string]interface{}{"a": "x"},
+		},
+		{
+			name:   "nested",
+			values: map[string]interface{}{"a": map[string]interface{}{"b": "y"}},
+			key:    "a.c",
+			want:   map[string]interface{}{"a": map[string]interface{}{"b": "y", "c": "x"}},
+		},
+		{
+			name:   "created objects",
+			values: map[string]interface{}{},
+			key:    "a.b.c",
+			want:   map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": "x"}}},
+		},
+		{
+			name:   "not an object",
+			values: map[string]interface{}{"a": "y"},
+			key:    "a.b",
+			err:    "can't set a.b, a is not an object",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := setValue(c.values, c.key, "x")
+			if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+				t.Fatalf("expected error %q, got %v", c.err, err)
+			}
+			if c.err == "" && !reflect.DeepEqual(c.values, c.want) {
+				t.Errorf("expected %v, got %v", c.want, c.values)
+			}
+		})
+	}
+}
+
+func TestValidateModuleValues(t *testing.T) {
+	cases := []struct {
+		name   string
+		values map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "no values",
+			values: map[string]interface{}{},
+		},
+		{
+			name:   "partial object",
+			values: map[string]interface{}{"subnet": map[string]interface{}{"public": true}},
+		},
+		{
+			name:   "invalid value",
+			values: map[string]interface{}{"size": float64(0)},
+			err:    "spec.resource.input.size: Invalid value: 0: size in body should be greater than or equal to 1",
+		},
+		{
+			name:   "unknown input",
+			values: map[string]interface{}{"region": "x"},
+			err:    "spec.resource.input.region: Forbidden: unknown field, it is not in the schema",
+		},
+		{
+			name:   "unknown nested input",
+			values: map[string]interface{}{"subnet": map[string]interface{}{"zone": "a"}},
+			err:    "spec.resource.input.subnet.zone: Forbidden: unknown field, it is not in the schema",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateModuleValues(testNewInputSchema(t), c.values)
+			if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+				t.Errorf("expected error %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestModuleNewRun(t *testing.T) {
+	dir := t.TempDir()
+	defFile := filepath.Join(dir, "moduledef.yaml")
+	valuesFile := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(defFile, []byte(testNewModuleDef), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(valuesFile, []byte("subnet:\n  public: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		o    ModuleNewOptions
+		want string
+		err  string
+	}{
+		{
+			name: "placeholders",
+			o:    ModuleNewOptions{},
+			want: `apiVersion: tf.kubeform.com/v1alpha1
+kind: Module
+metadata:
+  name: prod
+  namespace: infra
+spec:
+  moduleDef: vpc
+  providerRef:
+    name: "" # required, the secret holding the provider credentials
+  resource:
+    input:
+      # name of the VPC
+      name: "" # required, string
+      subnet: # required, object
+        cidr: ""
+      # size: null
+      # tags:
+      #   env: dev
+`,
+		},
+		{
+			name: "values",
+			o: ModuleNewOptions{
+				ProviderRef: "aws",
+				ValuesFiles: []string{valuesFile},
+				Values:      []string{"name=prod", "size=2"},
+			},
+			want: `apiVersion: tf.kubeform.com/v1alpha1
+kind: Module
+metadata:
+  name: prod
+  namespace: infra
+spec:
+  moduleDef: vpc
+  providerRef:
+    name: aws
+  resource:
+    input:
+      # name of the VPC
+      name: prod
+      subnet:
+        cidr: ""
+        public: true
+      size: 2
+      # tags:
+      #   env: dev
+`,
+		},
+		{
+			name: "invalid values",
+			o:    ModuleNewOptions{Values: []string{"size=0"}},
+			err:  "spec.resource.input.size: Invalid value: 0: size in body should be greater than or equal to 1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			o := c.o
+			o.ModuleDefName, o.Name, o.Namespace = "vpc", "prod", "infra"
+			o.ModuleDef = defFile
+			o.NewBuilder = resource.NewLocalBuilder
+			o.IOStreams = genericclioptions.IOStreams{Out: &out, ErrOut: &out}
+
+			err := o.Run()
+			if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+				t.Fatalf("expected error %q, got %v", c.err, err)
+			}
+			if out.String() != c.want {
+				t.Errorf("expected output\n%s\ngot\n%s", c.want, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/spf13/cobra"
+	v "gomodules.xyz/x/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var moduleResource = v1alpha1.GroupVersion.WithResource("modules")
+
+type ModuleUpgradeOptions struct {
+	Name  string
+	Ref   string
+	Force bool
+
+	SkipUntranslatableValidations bool
+
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+
+	genericclioptions.IOStreams
+}
+
+// moduleCheck is the outcome of the validation of a Module against the upgraded schema
+type moduleCheck struct {
+	Namespace string
+	Name      string
+	Errors    field.ErrorList
+}
+
+func NewCmdModuleUpgrade(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ModuleUpgradeOptions{IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:               "upgrade [name]",
+		Short:             "Upgrade a Module Definition to another ref of its module once every Module using it is valid against the new schema",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Ref, "ref", "", "ref of the module repository to upgrade the Module Definition to")
+	cmd.Flags().BoolVar(&o.Force, "force", false, "upgrade the Module Definition even if some of the Modules using it would break")
+	cmd.Flags().BoolVar(&o.SkipUntranslatableValidations, "skip-untranslatable-validations", false, "leave out the parts of the variable validations that can't be translated into schema constraints or CEL rules instead of failing")
+
+	return cmd
+}
+
+func (o *ModuleUpgradeOptions) Complete(f cmdutil.Factory, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("you must specify the name of the Module Definition")
+	}
+	o.Name = args[0]
+
+	var err error
+	o.DynamicClient, err = f.DynamicClient()
+	if err != nil {
+		return err
+	}
+	o.KubeClient, err = f.KubernetesClientSet()
+	return err
+}
+
+func (o *ModuleUpgradeOptions) Validate() error {
+	if o.Ref == "" {
+		return fmt.Errorf("you must specify the ref to upgrade to using --ref")
+	}
+	return nil
+}
+
+func (o *ModuleUpgradeOptions) Run() error {
+	client := o.DynamicClient.Resource(moduleDefinitionResource)
+	live, err := client.Get(context.TODO(), o.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	var md v1alpha1.ModuleDefinition
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(live.Object, &md); err != nil {
+		return err
+	}
+
+	regenerated, err := regenerateModule(o.KubeClient, &md, o.Ref, o.SkipUntranslatableValidations)
+	if err != nil {
+		return err
+	}
+
+	checks, err := o.checkModules(regenerated.Schema)
+	if err != nil {
+		return err
+	}
+
+	broken, err := printModuleChecks(o.Out, o.Name, checks)
+	if err != nil {
+		return err
+	}
+
+	if err := o.checkUpgrade(broken, len(checks)); err != nil {
+		return err
+	}
+
+	if err := unstructured.SetNestedField(live.Object, regenerated.Schema, "spec", "schema"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(live.Object, regenerated.Commit, "spec", "moduleRef", "git", "checkOut"); err != nil {
+		return err
+	}
+	annotations := live.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SourceRefAnnotation] = o.Ref
+	annotations[SourceCommitAnnotation] = regenerated.Commit
+	annotations[ContentHashAnnotation] = regenerated.Hash
+	if v.Version.Version != "" {
+		annotations[GeneratorVersionAnnotation] = v.Version.Version
+	}
+	live.SetAnnotations(annotations)
+
+	if _, err := client.Update(context.TODO(), live, metav1.UpdateOptions{FieldManager: FieldManager}); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "moduledefinition/%s upgraded to %s (%s)\n", o.Name, o.Ref, regenerated.Commit)
+
+	return nil
+}
+
+// checkUpgrade refuses the upgrade unless forced when a Module would break
+func (o *ModuleUpgradeOptions) checkUpgrade(broken, total int) error {
+	if broken > 0 {
+		if !o.Force {
+			return fmt.Errorf("%d of %d Modules would break with ref %s, use --force to upgrade Module Definition %s anyway", broken, total, o.Ref, o.Name)
+		}
+		klog.Warningf("upgrading Module Definition %s although %d of %d Modules would break", o.Name, broken, total)
+	}
+	return nil
+}
+
+// printModuleChecks prints the outcome of the checks and returns the number of broken Modules
+func printModuleChecks(out io.Writer, name string, checks []moduleCheck) (int, error) {
+	if len(checks) == 0 {
+		fmt.Fprintf(out, "no Module uses Module Definition %s\n", name)
+		return 0, nil
+	}
+
+	broken := 0
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tSTATUS\tERRORS")
+	for _, c := range checks {
+		if len(c.Errors) > 0 {
+			broken++
+			fmt.Fprintf(w, "%s\t%s\tBreaks\t%s\n", c.Namespace, c.Name, c.Errors.ToAggregate().Error())
+		} else {
+			fmt.Fprintf(w, "%s\t%s\tValid\t\n", c.Namespace, c.Name)
+		}
+	}
+
+	return broken, w.Flush()
+}
+
+// checkModules validates the input of every Module using the Module Definition against the new
+// schema, see validateInput
+func (o *ModuleUpgradeOptions) checkModules(schema map[string]interface{}) ([]moduleCheck, error) {
+	inputSchema, _, err := unstructured.NestedMap(schema, "properties", "input")
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := o.DynamicClient.Resource(moduleResource).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	path := field.NewPath("spec", "resource", "input")
+	var checks []moduleCheck
+	for _, item := range list.Items {
+		if def, _, _ := unstructured.NestedString(item.Object, "spec", "moduleDef"); def != o.Name {
+			continue
+		}
+
+		var input interface{} = map[string]interface{}{}
+		if in, found, _ := unstructured.NestedFieldNoCopy(item.Object, "spec", "resource", "input"); found {
+			if err := normalizeJSON(in, &input); err != nil {
+				return nil, err
+			}
+		}
+
+		errs, err := validateInput(path, input, inputSchema)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, moduleCheck{
+			Namespace: item.GetNamespace(),
+			Name:      item.GetName(),
+			Errors:    errs,
+		})
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].Namespace != checks[j].Namespace {
+			return checks[i].Namespace < checks[j].Namespace
+		}
+		return checks[i].Name < checks[j].Name
+	})
+
+	if len(checks) > 0 {
+		for _, p := range validationRulePaths(path, inputSchema) {
+			klog.Warningf("the Modules are not verified against the validation rules of %s, they are only checked by the API server", p)
+		}
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// moduleTestServer serves the Modules of every namespace
+func moduleTestServer(t *testing.T, modules ...*unstructured.Unstructured) dynamic.Interface {
+	t.Helper()
+
+	list := &unstructured.UnstructuredList{Object: map[string]interface{}{
+		"kind":       "ModuleList",
+		"apiVersion": v1alpha1.GroupVersion.String(),
+		"metadata":   map[string]interface{}{},
+	}}
+	for _, m := range modules {
+		m.SetKind("Module")
+		m.SetAPIVersion(v1alpha1.GroupVersion.String())
+		list.Items = append(list.Items, *m)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/apis/tf.kubeform.com/v1alpha1/modules" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(&metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonNotFound,
+				Code:     http.StatusNotFound,
+			})
+			return
+		}
+		data, err := list.MarshalJSON()
+		if err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func testModule(namespace, name, def string, input map[string]interface{}) *unstructured.Unstructured {
+	m := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"moduleDef": def,
+			"resource":  map[string]interface{}{"input": input},
+		},
+	}}
+	m.SetNamespace(namespace)
+	m.SetName(name)
+	return m
+}
+
+func TestModuleUpgradeCheckModules(t *testing.T) {
+	schema := testModuleSchema("name")
+	input, _, _ := unstructured.NestedMap(schema, "properties", "input")
+	input["required"] = []interface{}{"name"}
+	input["properties"].(map[string]interface{})["cidr"] = map[string]interface{}{
+		"type":               "string",
+		ValidationsExtension: []interface{}{map[string]interface{}{"rule": "self != ''"}},
+	}
+	input["properties"].(map[string]interface{})["size"] = map[string]interface{}{
+		"type":    "integer",
+		"maximum": float64(3),
+	}
+	if err := unstructured.SetNestedMap(schema, input, "properties", "input"); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &ModuleUpgradeOptions{
+		Name: "vpc",
+		DynamicClient: moduleTestServer(t,
+			testModule("prod", "vpc", "vpc", map[string]interface{}{"name": "prod", "cidr": "10.0.0.0/16"}),
+			testModule("dev", "vpc", "vpc", map[string]interface{}{"cidr": "10.1.0.0/16", "size": int64(5)}),
+			testModule("test", "vpc", "vpc", map[string]interface{}{"name": "test", "zone": "a"}),
+			testModule("dev", "db", "db", map[string]interface{}{}),
+		),
+	}
+	checks, err := o.checkModules(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := field.NewPath("spec", "resource", "input")
+	want := []moduleCheck{
+		{Namespace: "dev", Name: "vpc", Errors: field.ErrorList{
+			field.Required(path.Child("name"), ""),
+			field.Invalid(path.Child("size"), float64(5), "size in body should be less than or equal to 3"),
+		}},
+		{Namespace: "prod", Name: "vpc"},
+		{Namespace: "test", Name: "vpc", Errors: field.ErrorList{field.Forbidden(path.Child("zone"), "unknown field, it is not in the schema")}},
+	}
+	if !reflect.DeepEqual(checks, want) {
+		t.Errorf("expected checks %+v, got %+v", want, checks)
+	}
+
+	var out bytes.Buffer
+	broken, err := printModuleChecks(&out, o.Name, checks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broken != 2 {
+		t.Errorf("expected 2 broken Modules, got %d", broken)
+	}
+	wantOut := "NAMESPACE  NAME  STATUS  ERRORS\n" +
+		"dev        vpc   Breaks  [spec.resource.input.name: Required value, spec.resource.input.size: Invalid value: 5: size in body should be less than or equal to 3]\n" +
+		"prod       vpc   Valid   \n" +
+		"test       vpc   Breaks  spec.resource.input.zone: Forbidden: unknown field, it is not in the schema\n"
+	if out.String() != wantOut {
+		t.Errorf("expected output\n%s\ngot\n%s", wantOut, out.String())
+	}
+}
+
+func TestPrintModuleChecksNoModule(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := printModuleChecks(&out, "vpc", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "no Module uses Module Definition vpc\n"; out.String() != want {
+		t.Errorf("expected output %q, got %q", want, out.String())
+	}
+}
+
+func TestModuleUpgradeCheckUpgrade(t *testing.T) {
+	cases := []struct {
+		name   string
+		force  bool
+		broken int
+		err    string
+	}{
+		{
+			name: "all Modules valid",
+		},
+		{
+			name:   "broken Modules",
+			broken: 1,
+			err:    "1 of 2 Modules would break with ref v2, use --force to upgrade Module Definition vpc anyway",
+		},
+		{
+			name:   "broken Modules forced",
+			force:  true,
+			broken: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := &ModuleUpgradeOptions{Name: "vpc", Ref: "v2", Force: c.force}
+			err := o.checkUpgrade(c.broken, 2)
+			if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+				t.Errorf("expected error %q, got %v", c.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"regexp"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+var (
+	outputBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type:       "output",
+				LabelNames: []string{"name"},
+			},
+		},
+	}
+	outputSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name: "value",
+			},
+		},
+	}
+
+	// typeHintRegex matches the `type: <type expression>` hint in the description of an output
+	typeHintRegex = regexp.MustCompile(`(?i)\btype\s*:\s*`)
+)
+
+// stringFunctions are the terraform functions that always return a string
+var stringFunctions = map[string]bool{
+	"tostring": true, "format": true, "join": true, "jsonencode": true, "yamlencode": true,
+	"lower": true, "upper": true, "title": true, "trimspace": true, "trim": true, "trimprefix": true,
+	"trimsuffix": true, "replace": true, "substr": true, "base64encode": true, "base64decode": true,
+	"md5": true, "sha1": true, "sha256": true, "uuid": true, "cidrhost": true, "cidrsubnet": true,
+	"cidrnetmask": true, "timestamp": true, "formatdate": true, "templatefile": true, "file": true,
+	"abspath": true, "basename": true, "dirname": true, "pathexpand": true,
+}
+
+// numberFunctions are the terraform functions that always return a number
+var numberFunctions = map[string]bool{
+	"tonumber": true, "length": true, "abs": true, "ceil": true, "floor": true, "log": true,
+	"max": true, "min": true, "pow": true, "signum": true, "parseint": true, "index": true,
+}
+
+// loadOutputValues returns the value expressions of the outputs keyed by the output name
+func loadOutputValues(files []*hcl.File) (map[string]hclsyntax.Expression, error) {
+	values := map[string]hclsyntax.Expression{}
+
+	for _, file := range files {
+		content, _, diags := file.Body.PartialContent(outputBlockSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, block := range content.Blocks {
+			attrs, _, diags := block.Body.PartialContent(outputSchema)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			if attr, found := attrs.Attributes["value"]; found {
+				if expr, ok := syntaxExpr(file, attr.Expr); ok {
+					values[block.Labels[0]] = expr
+				}
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// outputTypeHint returns the schema of the type given in the description of the output,
+// e.g. "IDs of the subnets (type: list(string))"
+func outputTypeHint(description string) *v1.JSONSchemaProps {
+	loc := typeHintRegex.FindStringIndex(description)
+	if loc == nil {
+		return nil
+	}
+
+	// the type expression ends at the first delimiter outside of the brackets
+	rest := description[loc[1]:]
+	depth, end := 0, len(rest)
+scan:
+	for i, r := range rest {
+		switch r {
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			if depth == 0 {
+				end = i
+				break scan
+			}
+			depth--
+		case ' ', '\t', '\n', ',', ';':
+			if depth == 0 {
+				end = i
+				break scan
+			}
+		}
+	}
+
+	prop, err := parseTypeExpr(rest[:end])
+	if err != nil || rest[:end] == "" {
+		return nil
+	}
+
+	return prop
+}
+
+// inferOutputSchema statically infers the schema of the value of an output. It returns nil
+// when the type depends on something not known before the apply, e.g. a resource attribute.
+func inferOutputSchema(expr hclsyntax.Expression, inputs map[string]v1.JSONSchemaProps) *v1.JSONSchemaProps {
+	if val, ok := constValue(expr); ok {
+		return ctyTypeSchema(val.Type())
+	}
+
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr, *hclsyntax.TemplateJoinExpr:
+		return &v1.JSONSchemaProps{Type: String}
+	case *hclsyntax.TemplateWrapExpr:
+		return inferOutputSchema(e.Wrapped, inputs)
+	case *hclsyntax.ScopeTraversalExpr:
+		if e.Traversal.RootName() != "var" || len(e.Traversal) < 2 {
+			return nil
+		}
+		attr, ok := e.Traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			return nil
+		}
+		input, found := inputs[attr.Name]
+		if !found {
+			return nil
+		}
+		return outputFromInput(traverseSchema(&input, e.Traversal[2:]))
+	case *hclsyntax.RelativeTraversalExpr:
+		return traverseSchema(inferOutputSchema(e.Source, inputs), e.Traversal)
+	case *hclsyntax.ConditionalExpr:
+		t := inferOutputSchema(e.TrueResult, inputs)
+		f := inferOutputSchema(e.FalseResult, inputs)
+		if t != nil && f != nil && t.Type == f.Type && t.Type != "" && t.Type != "array" && t.Type != "object" {
+			return t
+		}
+	case *hclsyntax.UnaryOpExpr:
+		if e.Op == hclsyntax.OpLogicalNot {
+			return &v1.JSONSchemaProps{Type: "boolean"}
+		}
+		return &v1.JSONSchemaProps{Type: Number}
+	case *hclsyntax.BinaryOpExpr:
+		switch e.Op {
+		case hclsyntax.OpAdd, hclsyntax.OpSubtract, hclsyntax.OpMultiply, hclsyntax.OpDivide, hclsyntax.OpModulo:
+			return &v1.JSONSchemaProps{Type: Number}
+		}
+		return &v1.JSONSchemaProps{Type: "boolean"}
+	case *hclsyntax.FunctionCallExpr:
+		switch {
+		case stringFunctions[e.Name]:
+			return &v1.JSONSchemaProps{Type: String}
+		case numberFunctions[e.Name]:
+			return &v1.JSONSchemaProps{Type: Number}
+		case e.Name == "tobool" || e.Name == "can" || e.Name == "contains" || e.Name == "alltrue" || e.Name == "anytrue":
+			return &v1.JSONSchemaProps{Type: "boolean"}
+		case e.Name == "keys":
+			return &v1.JSONSchemaProps{
+				Type: "array",
+				Items: &v1.JSONSchemaPropsOrArray{
+					Schema: &v1.JSONSchemaProps{Type: String},
+				},
+			}
+		case (e.Name == "tolist" || e.Name == "toset") && len(e.Args) == 1:
+			arg := inferOutputSchema(e.Args[0], inputs)
+			if arg == nil || arg.Type != "array" {
+				return &v1.JSONSchemaProps{
+					Type: "array",
+					Items: &v1.JSONSchemaPropsOrArray{
+						Schema: anySchema(),
+					},
+				}
+			}
+			return arg
+		case e.Name == "tomap" && len(e.Args) == 1:
+			arg := inferOutputSchema(e.Args[0], inputs)
+			if arg == nil || arg.Type != "object" || arg.AdditionalProperties == nil {
+				return &v1.JSONSchemaProps{
+					Type: "object",
+					AdditionalProperties: &v1.JSONSchemaPropsOrBool{
+						Allows: true,
+						Schema: anySchema(),
+					},
+				}
+			}
+			return arg
+		}
+	}
+
+	return nil
+}
+
+// outputFromInput keeps only the type structure of an input schema, the defaults and
+// constraints of the variables have no meaning for an output
+func outputFromInput(input *v1.JSONSchemaProps) *v1.JSONSchemaProps {
+	if input == nil {
+		return nil
+	}
+
+	out := &v1.JSONSchemaProps{
+		Type:                   input.Type,
+		AnyOf:                  input.AnyOf,
+		XPreserveUnknownFields: input.XPreserveUnknownFields,
+	}
+
+	if input.Items != nil {
+		out.Items = &v1.JSONSchemaPropsOrArray{
+			Schema: outputFromInput(input.Items.Schema),
+		}
+	}
+
+	if input.Properties != nil {
+		out.Properties = make(map[string]v1.JSONSchemaProps, len(input.Properties))
+		for name, prop := range input.Properties {
+			prop := prop
+			out.Properties[name] = *outputFromInput(&prop)
+		}
+	}
+
+	if input.AdditionalProperties != nil {
+		out.AdditionalProperties = &v1.JSONSchemaPropsOrBool{
+			Allows: input.AdditionalProperties.Allows,
+			Schema: outputFromInput(input.AdditionalProperties.Schema),
+		}
+	}
+
+	return out
+}
+
+func traverseSchema(schema *v1.JSONSchemaProps, traversal hcl.Traversal) *v1.JSONSchemaProps {
+	for _, step := range traversal {
+		if schema == nil {
+			return nil
+		}
+
+		switch s := step.(type) {
+		case hcl.TraverseAttr:
+			schema = propertySchema(schema, s.Name)
+		case hcl.TraverseIndex:
+			switch {
+			case schema.Type == "array" && schema.Items != nil && schema.Items.Schema != nil:
+				schema = schema.Items.Schema
+			case schema.Type == "object" && s.Key.Type() == cty.String:
+				schema = propertySchema(schema, s.Key.AsString())
+			default:
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+
+	return schema
+}
+
+func propertySchema(schema *v1.JSONSchemaProps, name string) *v1.JSONSchemaProps {
+	if prop, found := schema.Properties[name]; found {
+		return &prop
+	}
+	if schema.AdditionalProperties != nil {
+		return schema.AdditionalProperties.Schema
+	}
+	return nil
+}
+
+// ctyTypeSchema converts the type of a constant value into the equivalent json schema
+func ctyTypeSchema(typ cty.Type) *v1.JSONSchemaProps {
+	switch {
+	case typ == cty.String:
+		return &v1.JSONSchemaProps{Type: String}
+	case typ == cty.Number:
+		return &v1.JSONSchemaProps{Type: Number}
+	case typ == cty.Bool:
+		return &v1.JSONSchemaProps{Type: "boolean"}
+	case typ.IsListType() || typ.IsSetType():
+		return &v1.JSONSchemaProps{
+			Type: "array",
+			Items: &v1.JSONSchemaPropsOrArray{
+				Schema: ctyTypeSchema(typ.ElementType()),
+			},
+		}
+	case typ.IsMapType():
+		return &v1.JSONSchemaProps{
+			Type: "object",
+			AdditionalProperties: &v1.JSONSchemaPropsOrBool{
+				Allows: true,
+				Schema: ctyTypeSchema(typ.ElementType()),
+			},
+		}
+	case typ.IsTupleType():
+		// a tuple of a single type is what a list literal evaluates to
+		var elems []*v1.JSONSchemaProps
+		for _, elem := range typ.TupleElementTypes() {
+			elems = append(elems, ctyTypeSchema(elem))
+		}
+		item := tupleItemSchema(elems)
+		return &v1.JSONSchemaProps{
+			Type: "array",
+			Items: &v1.JSONSchemaPropsOrArray{
+				Schema: item,
+			},
+		}
+	case typ.IsObjectType():
+		props := map[string]v1.JSONSchemaProps{}
+		for name, attr := range typ.AttributeTypes() {
+			props[name] = *ctyTypeSchema(attr)
+		}
+		return &v1.JSONSchemaProps{
+			Type:       "object",
+			Properties: props,
+		}
+	}
+
+	return anySchema()
+}
@@ -0,0 +1,274 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestOutputTypeHint(t *testing.T) {
+	cases := []struct {
+		description string
+		schema      string
+	}{
+		{description: "IDs of the subnets (type: list(string))", schema: "type: array\nitems:\n  type: string"},
+		{description: "type: map(number), keyed by the zone", schema: "type: object\nadditionalProperties:\n  type: number"},
+		{description: "Endpoint (type: object({ host = string, port = number }))", schema: `
+type: object
+required: [host, port]
+properties:
+  host:
+    type: string
+  port:
+    type: number`},
+		{description: "ARN of the bucket"},
+		{description: "(type: foo)"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			prop := outputTypeHint(c.description)
+			if c.schema == "" {
+				if prop != nil {
+					t.Fatalf("expected no type hint, got %+v", prop)
+				}
+				return
+			}
+
+			var want, got interface{}
+			if err := yaml.Unmarshal([]byte(c.schema), &want); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(prop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s, want %s", data, c.schema)
+			}
+		})
+	}
+}
+
+func TestProcessOutput(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"main.tf": `
+variable "ports" {
+  type = list(object({ port = number, name = optional(string) }))
+}
+
+output "literal" {
+  value = "x"
+}
+
+output "number" {
+  value = length(var.ports)
+}
+
+output "list" {
+  value = tolist(["a", "b"])
+}
+
+output "empty" {
+  value = []
+}
+
+output "first_port" {
+  value = var.ports[0].port
+}
+
+output "ports" {
+  value = var.ports
+}
+
+output "hinted" {
+  description = "IDs of the subnets (type: list(string))"
+  value       = aws_subnet.this[*].id
+}
+
+output "unknown" {
+  value = aws_instance.this.arn
+}
+`,
+	})
+
+	_, outputs := moduleSchemas(t, dir)
+
+	expected := map[string]string{
+		"literal":    `type: string`,
+		"number":     `type: number`,
+		"list":       "type: array\nitems:\n  type: string",
+		"empty":      "type: array\nitems:\n  x-kubernetes-preserve-unknown-fields: true",
+		"first_port": `type: number`,
+		"ports": `
+type: array
+items:
+  type: object
+  properties:
+    name:
+      type: string
+    port:
+      type: number`,
+		"hinted": `
+type: array
+description: "IDs of the subnets (type: list(string))"
+items:
+  type: string`,
+		"unknown": `x-kubernetes-preserve-unknown-fields: true`,
+	}
+	assertSchemas(t, outputs, expected)
+}
+
+func TestModuleFilesInJSONAndOverrides(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"main.tf": `
+variable "size" {
+  type = number
+
+  validation {
+    condition     = var.size > 0
+    error_message = "Size must be positive."
+  }
+}
+
+output "size" {
+  value = var.size
+}
+`,
+		"vars.tf.json": `{
+  "variable": {
+    "tier": {
+      "type": "string",
+      "validation": {
+        "condition": "${contains([\"gold\", \"silver\"], var.tier)}",
+        "error_message": "Unknown tier."
+      }
+    }
+  },
+  "output": {
+    "tier": {
+      "value": "${var.tier}"
+    },
+    "count": {
+      "value": 3
+    }
+  }
+}`,
+		"override.tf": `
+variable "size" {
+  validation {
+    condition     = var.size <= 10
+    error_message = "Size must be at most 10."
+  }
+}
+
+output "size" {
+  value = tostring(var.size)
+}
+`,
+		"#main.tf#": `not a terraform file`,
+	})
+
+	inputs, outputs := moduleSchemas(t, dir)
+	assertSchemas(t, inputs, map[string]string{
+		"size": `
+type: number
+maximum: 10`,
+		"tier": `
+type: string
+enum: [gold, silver]`,
+	})
+	assertSchemas(t, outputs, map[string]string{
+		"size":  `type: string`,
+		"tier":  `type: string`,
+		"count": `type: number`,
+	})
+}
+
+// moduleSchemas returns the input and output schemas generated for the module in dir
+func moduleSchemas(t *testing.T, dir string) (map[string]v1.JSONSchemaProps, map[string]v1.JSONSchemaProps) {
+	t.Helper()
+
+	module, err := loadModule(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := parseModuleFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validations, err := loadVariableValidations(files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := loadOutputValues(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var varKeys, outKeys []string
+	for k := range module.Variables {
+		varKeys = append(varKeys, k)
+	}
+	for k := range module.Outputs {
+		outKeys = append(outKeys, k)
+	}
+
+	inputs, _, _, err := processInput(varKeys, module.Variables, validations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := processOutput(outKeys, module.Outputs, values, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inputs, outputs
+}
+
+// assertSchemas compares the schemas with the expected ones given in yaml
+func assertSchemas(t *testing.T, props map[string]v1.JSONSchemaProps, expected map[string]string) {
+	t.Helper()
+
+	if len(props) != len(expected) {
+		t.Errorf("got %d properties, want %d", len(props), len(expected))
+	}
+	for name, schema := range expected {
+		var want, got interface{}
+		if err := yaml.Unmarshal([]byte(schema), &want); err != nil {
+			t.Fatal(err)
+		}
+		prop := props[name]
+		data, err := json.Marshal(&prop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected schema of %s, got %s", name, data)
+		}
+	}
+}
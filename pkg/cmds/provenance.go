@@ -0,0 +1,132 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	v "gomodules.xyz/x/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	SourceRefAnnotation        = "tf.kubeform.com/source-ref"
+	SourceCommitAnnotation     = "tf.kubeform.com/source-commit"
+	ContentHashAnnotation      = "tf.kubeform.com/content-hash"
+	GeneratorVersionAnnotation = "tf.kubeform.com/generator-version"
+)
+
+// setProvenanceAnnotations records where the Module Definition was generated from, so that it
+// can be traced back to the exact terraform files
+func setProvenanceAnnotations(modObj *v1alpha1.ModuleDefinition, fetched *fetchedModule) error {
+	hash, err := moduleContentHash(fetched.Dir)
+	if err != nil {
+		return err
+	}
+	metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, ContentHashAnnotation, hash)
+
+	if fetched.Ref != "" {
+		metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, SourceRefAnnotation, fetched.Ref)
+	}
+	if fetched.CheckOut != "" {
+		metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, SourceCommitAnnotation, fetched.CheckOut)
+	}
+	if v.Version.Version != "" {
+		metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, GeneratorVersionAnnotation, v.Version.Version)
+	}
+
+	return nil
+}
+
+// moduleContentHash returns the sha256 of the terraform files of the module directory and of the
+// local modules it calls, in the form sha256:<hex>. Only the names relative to the module
+// directory and the contents of the files are hashed.
+func moduleContentHash(dir string) (string, error) {
+	filenames, err := localModuleFiles(dir, map[string]bool{})
+	if err != nil {
+		return "", err
+	}
+
+	names := make(map[string]string, len(filenames))
+	for _, filename := range filenames {
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return "", err
+		}
+		names[filename] = filepath.ToSlash(rel)
+	}
+	sort.Slice(filenames, func(i, j int) bool {
+		return names[filenames[i]] < names[filenames[j]]
+	})
+
+	h := sha256.New()
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(names[filename]))
+		h.Write([]byte{0})
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localModuleFiles returns the terraform files of the module directory and, following the
+// ./ and ../ sources of its module calls, of the local modules it calls
+func localModuleFiles(dir string, seen map[string]bool) ([]string, error) {
+	dir = filepath.Clean(dir)
+	if seen[dir] {
+		return nil, nil
+	}
+	seen[dir] = true
+
+	var filenames []string
+	for _, pattern := range []string{"*.tf", "*.tf.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, matches...)
+	}
+
+	module, err := loadModule(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, call := range module.ModuleCalls {
+		if !strings.HasPrefix(call.Source, "./") && !strings.HasPrefix(call.Source, "../") {
+			continue
+		}
+		files, err := localModuleFiles(filepath.Join(dir, filepath.FromSlash(call.Source)), seen)
+		if err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, files...)
+	}
+
+	return filenames, nil
+}
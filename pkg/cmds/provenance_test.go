@@ -0,0 +1,214 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	v "gomodules.xyz/x/version"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestModuleContentHash(t *testing.T) {
+	files := map[string]string{
+		"main.tf":            `variable "name" {}`,
+		"outputs.tf.json":    `{"output": {"id": {"value": "x"}}}`,
+		"README.md":          "readme",
+		"modules/vpc/vpc.tf": `variable "cidr" {}`,
+	}
+	hash := func(t *testing.T, files map[string]string) string {
+		t.Helper()
+		h, err := moduleContentHash(writeModule(t, files))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	with := func(name, content string) map[string]string {
+		changed := map[string]string{}
+		for k, v := range files {
+			changed[k] = v
+		}
+		changed[name] = content
+		return changed
+	}
+
+	want := hash(t, files)
+	if want != hash(t, files) {
+		t.Error("hash of the same files differs")
+	}
+
+	cases := []struct {
+		name    string
+		files   map[string]string
+		changed bool
+	}{
+		{name: "other files", files: with("README.md", "changed"), changed: false},
+		{name: "nested module", files: with("modules/vpc/vpc.tf", `variable "id" {}`), changed: false},
+		{name: "content", files: with("main.tf", `variable "id" {}`), changed: true},
+		{name: "new file", files: with("versions.tf", `terraform {}`), changed: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := hash(t, c.files); (got != want) != c.changed {
+				t.Errorf("expected changed %v, got %s for %s", c.changed, got, want)
+			}
+		})
+	}
+
+	// the files of the local modules called by the module are hashed along
+	called := with("vpc.tf", `module "vpc" { source = "./modules/vpc" }`)
+	calledHash := hash(t, called)
+	called["modules/vpc/vpc.tf"] = `variable "id" {}`
+	if hash(t, called) == calledHash {
+		t.Error("changing a called local module doesn't change the hash")
+	}
+
+	// the names are hashed as well as the contents
+	renamed := with("variables.tf", files["main.tf"])
+	delete(renamed, "main.tf")
+	if hash(t, renamed) == want {
+		t.Error("renaming a file doesn't change the hash")
+	}
+}
+
+func TestSetProvenanceAnnotations(t *testing.T) {
+	dir := writeModule(t, map[string]string{"main.tf": `variable "name" {}`})
+	hash, err := moduleContentHash(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := v.Version.Version
+	v.Version.Version = "v0.1.0"
+	t.Cleanup(func() { v.Version.Version = version })
+
+	cases := []struct {
+		name    string
+		fetched fetchedModule
+		want    map[string]string
+	}{
+		{
+			name:    "git checkout",
+			fetched: fetchedModule{Dir: dir, Ref: "main", CheckOut: "0123456789abcdef0123456789abcdef01234567"},
+			want: map[string]string{
+				ContentHashAnnotation:      hash,
+				SourceRefAnnotation:        "main",
+				SourceCommitAnnotation:     "0123456789abcdef0123456789abcdef01234567",
+				GeneratorVersionAnnotation: "v0.1.0",
+			},
+		},
+		{
+			name:    "local directory",
+			fetched: fetchedModule{Dir: dir},
+			want: map[string]string{
+				ContentHashAnnotation:      hash,
+				GeneratorVersionAnnotation: "v0.1.0",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			modObj := &v1alpha1.ModuleDefinition{}
+			if err := setProvenanceAnnotations(modObj, &c.fetched); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(modObj.Annotations, c.want) {
+				t.Errorf("expected %v, got %v", c.want, modObj.Annotations)
+			}
+		})
+	}
+}
+
+func TestGenModuleReproducible(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"main.tf": `
+variable "zone" {
+  type = string
+}
+
+variable "tags" {
+  type = object({
+    team  = string
+    owner = string
+    cost  = optional(string)
+    env   = string
+  })
+}
+
+variable "count_of" {
+  type    = number
+  default = 1
+}
+
+variable "az" {
+  type = list(string)
+}
+
+output "id" {
+  value = "x"
+}
+
+output "arn" {
+  value = "y"
+}
+`,
+	})
+	fetched := &fetchedModule{
+		Dir:      dir,
+		GitRef:   "github.com/org/vpc",
+		Git:      true,
+		Ref:      "main",
+		CheckOut: "0123456789abcdef0123456789abcdef01234567",
+	}
+
+	generate := func() []byte {
+		outDir := t.TempDir()
+		var out bytes.Buffer
+		o := &GenModuleOptions{
+			Directory:      outDir,
+			ProviderName:   "aws",
+			ProviderSource: "hashicorp/aws",
+			IOStreams:      genericclioptions.IOStreams{Out: &out, ErrOut: &out},
+		}
+		if err := o.generateModule("vpc", fetched); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(outDir, "vpc.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	want := generate()
+	for i := 0; i < 10; i++ {
+		if got := generate(); !bytes.Equal(got, want) {
+			t.Fatalf("generated Module Definition differs:\n%s\n---\n%s", want, got)
+		}
+	}
+	if !bytes.Contains(want, []byte("checkOut: 0123456789abcdef0123456789abcdef01234567\n")) {
+		t.Errorf("Module Definition is not pinned to the commit:\n%s", want)
+	}
+}
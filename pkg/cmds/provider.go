@@ -0,0 +1,236 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	ProviderVersionConstraintsAnnotation = "tf.kubeform.com/provider-version-constraints"
+	ProviderLockedVersionAnnotation      = "tf.kubeform.com/provider-locked-version"
+
+	defaultProviderRegistry  = "registry.terraform.io"
+	defaultProviderNamespace = "hashicorp"
+	lockFileName             = ".terraform.lock.hcl"
+)
+
+var lockFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type:       "provider",
+			LabelNames: []string{"source"},
+		},
+	},
+}
+
+type moduleProvider struct {
+	Name               string
+	Source             string
+	VersionConstraints []string
+	LockedVersion      string
+}
+
+// utilityProviders are the providers commonly used next to the provider a module is written for,
+// they don't manage any infrastructure of their own
+var utilityProviders = map[string]bool{
+	"random":    true,
+	"null":      true,
+	"time":      true,
+	"local":     true,
+	"tls":       true,
+	"external":  true,
+	"http":      true,
+	"template":  true,
+	"archive":   true,
+	"cloudinit": true,
+}
+
+// detectProvider finds the provider of the module from its required_providers and the providers
+// used by its resources. The given name and source, if any, are checked against the module.
+func detectProvider(module *tfconfig.Module, name, source string) (*moduleProvider, error) {
+	used := map[string]bool{}
+	for n := range module.RequiredProviders {
+		used[n] = true
+	}
+	for _, r := range module.ManagedResources {
+		used[r.Provider.Name] = true
+	}
+	// the built-in provider of terraform_remote_state
+	delete(used, "terraform")
+
+	var names []string
+	for n := range used {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	if name == "" {
+		var err error
+		if name, err = primaryProvider(module, names); err != nil {
+			return nil, err
+		}
+	}
+
+	req, found := module.RequiredProviders[name]
+	switch {
+	case found:
+	case used[name]:
+		// a provider used by the resources without being required is implied from the hashicorp namespace
+		req = &tfconfig.ProviderRequirement{}
+	case len(names) > 0:
+		return nil, fmt.Errorf("provider %q is not used in the module, available providers: %s", name, strings.Join(names, ", "))
+	default:
+		// the module doesn't tell anything, trust the flags
+		if source == "" {
+			source = defaultProviderNamespace + "/" + name
+		}
+		return &moduleProvider{
+			Name:   name,
+			Source: source,
+		}, nil
+	}
+
+	moduleSource := req.Source
+	if moduleSource == "" {
+		moduleSource = defaultProviderNamespace + "/" + name
+	}
+
+	if source != "" && normalizeProviderSource(source) != normalizeProviderSource(moduleSource) {
+		return nil, fmt.Errorf("provider source %q contradicts the source %q required by the module for provider %q", source, moduleSource, name)
+	}
+
+	locked, err := lockedProviderVersion(module.Path, moduleSource)
+	if err != nil {
+		return nil, err
+	}
+
+	return &moduleProvider{
+		Name:               name,
+		Source:             moduleSource,
+		VersionConstraints: req.VersionConstraints,
+		LockedVersion:      locked,
+	}, nil
+}
+
+// primaryProvider selects the provider a module is written for among the providers it uses. That is
+// the single provider of its managed resources apart from the utility providers, or else the single
+// provider apart from the utility providers.
+func primaryProvider(module *tfconfig.Module, names []string) (string, error) {
+	owners := map[string]bool{}
+	for _, r := range module.ManagedResources {
+		if !utilityProviders[r.Provider.Name] && r.Provider.Name != "terraform" {
+			owners[r.Provider.Name] = true
+		}
+	}
+
+	var candidates []string
+	if len(owners) > 0 {
+		for n := range owners {
+			candidates = append(candidates, n)
+		}
+		sort.Strings(candidates)
+	} else {
+		for _, n := range names {
+			if !utilityProviders[n] {
+				candidates = append(candidates, n)
+			}
+		}
+		if len(candidates) == 0 {
+			candidates = names
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no provider is used in the module, use --provider-name and --provider-source to specify it")
+	case 1:
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("module uses multiple providers: %s, use --provider-name to select one", strings.Join(candidates, ", "))
+}
+
+// normalizeProviderSource returns the fully qualified form of a provider source address,
+// i.e. hostname/namespace/type
+func normalizeProviderSource(source string) string {
+	parts := strings.Split(strings.ToLower(source), "/")
+	switch len(parts) {
+	case 1:
+		return strings.Join([]string{defaultProviderRegistry, defaultProviderNamespace, parts[0]}, "/")
+	case 2:
+		return strings.Join([]string{defaultProviderRegistry, parts[0], parts[1]}, "/")
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// lockedProviderVersion reads the version of the provider selected in the dependency lock file
+// of the module. It returns an empty string if the module has no lock file or the provider isn't
+// locked in it.
+func lockedProviderVersion(dir, source string) (string, error) {
+	filename := filepath.Join(dir, lockFileName)
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	file, diags := hclparse.NewParser().ParseHCLFile(filename)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	content, _, diags := file.Body.PartialContent(lockFileSchema)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	for _, block := range content.Blocks {
+		if normalizeProviderSource(block.Labels[0]) != normalizeProviderSource(source) {
+			continue
+		}
+
+		attrs, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			return "", diags
+		}
+
+		attr, found := attrs["version"]
+		if !found {
+			return "", nil
+		}
+
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return "", diags
+		}
+		if val.Type() != cty.String || val.IsNull() {
+			return "", fmt.Errorf("invalid version of provider %s in %s", block.Labels[0], filename)
+		}
+
+		return val.AsString(), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,268 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeProviderSource(t *testing.T) {
+	cases := map[string]string{
+		"aws":                                 "registry.terraform.io/hashicorp/aws",
+		"linode/linode":                       "registry.terraform.io/linode/linode",
+		"Hashicorp/AWS":                       "registry.terraform.io/hashicorp/aws",
+		"registry.terraform.io/hashicorp/aws": "registry.terraform.io/hashicorp/aws",
+		"example.com/corp/cloud":              "example.com/corp/cloud",
+	}
+	for source, want := range cases {
+		if got := normalizeProviderSource(source); got != want {
+			t.Errorf("normalizeProviderSource(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	const awsProvider = `
+terraform {
+  required_providers {
+    aws = { source = "hashicorp/aws", version = ">= 4.0" }
+  }
+}
+`
+	cases := []struct {
+		name     string
+		files    map[string]string
+		flagName string
+		source   string
+		want     moduleProvider
+		err      bool
+	}{
+		{
+			name: "required provider with lock file",
+			files: map[string]string{
+				"main.tf": awsProvider,
+				".terraform.lock.hcl": `
+provider "registry.terraform.io/hashicorp/aws" {
+  version     = "4.2.0"
+  constraints = ">= 4.0"
+}
+`,
+			},
+			want: moduleProvider{
+				Name:               "aws",
+				Source:             "hashicorp/aws",
+				VersionConstraints: []string{">= 4.0"},
+				LockedVersion:      "4.2.0",
+			},
+		},
+		{
+			name: "required provider without source",
+			files: map[string]string{
+				"main.tf": `
+terraform {
+  required_providers {
+    google = { version = "~> 4.0" }
+  }
+}
+`,
+			},
+			want: moduleProvider{
+				Name:               "google",
+				Source:             "hashicorp/google",
+				VersionConstraints: []string{"~> 4.0"},
+			},
+		},
+		{
+			name: "multiple providers",
+			files: map[string]string{
+				"main.tf": `
+terraform {
+  required_providers {
+    aws    = { source = "hashicorp/aws" }
+    google = { source = "hashicorp/google" }
+  }
+}
+`,
+			},
+			err: true,
+		},
+		{
+			name: "multiple providers selected by flag",
+			files: map[string]string{
+				"main.tf": `
+terraform {
+  required_providers {
+    aws    = { source = "hashicorp/aws" }
+    google = { source = "hashicorp/google" }
+  }
+}
+`,
+			},
+			flagName: "google",
+			want: moduleProvider{
+				Name:   "google",
+				Source: "hashicorp/google",
+			},
+		},
+		{
+			name: "provider of the managed resources",
+			files: map[string]string{
+				"main.tf": `
+terraform {
+  required_providers {
+    aws    = { source = "hashicorp/aws" }
+    random = { source = "hashicorp/random" }
+    null   = { source = "hashicorp/null" }
+  }
+}
+
+resource "random_id" "suffix" {
+  byte_length = 4
+}
+
+resource "null_resource" "wait" {}
+
+resource "aws_s3_bucket" "this" {
+  bucket = random_id.suffix.hex
+}
+`,
+			},
+			want: moduleProvider{
+				Name:   "aws",
+				Source: "hashicorp/aws",
+			},
+		},
+		{
+			name: "single non utility provider",
+			files: map[string]string{
+				"main.tf": `
+terraform {
+  required_providers {
+    aws    = { source = "hashicorp/aws" }
+    random = { source = "hashicorp/random" }
+  }
+}
+`,
+			},
+			want: moduleProvider{
+				Name:   "aws",
+				Source: "hashicorp/aws",
+			},
+		},
+		{
+			name: "utility provider only",
+			files: map[string]string{
+				"main.tf": `
+resource "random_password" "this" {
+  length = 16
+}
+`,
+			},
+			want: moduleProvider{
+				Name:   "random",
+				Source: "hashicorp/random",
+			},
+		},
+		{
+			name: "implied provider",
+			files: map[string]string{
+				"main.tf": `
+resource "google_storage_bucket" "this" {
+  name = "x"
+}
+`,
+			},
+			want: moduleProvider{
+				Name:   "google",
+				Source: "hashicorp/google",
+			},
+		},
+		{
+			name: "resources of multiple providers",
+			files: map[string]string{
+				"main.tf": `
+resource "aws_s3_bucket" "this" {}
+
+resource "google_storage_bucket" "this" {}
+`,
+			},
+			err: true,
+		},
+		{
+			name:     "flag source contradicting the module",
+			files:    map[string]string{"main.tf": awsProvider},
+			flagName: "aws",
+			source:   "example/aws",
+			err:      true,
+		},
+		{
+			name:   "flag source matching the module",
+			files:  map[string]string{"main.tf": awsProvider},
+			source: "registry.terraform.io/hashicorp/aws",
+			want: moduleProvider{
+				Name:               "aws",
+				Source:             "hashicorp/aws",
+				VersionConstraints: []string{">= 4.0"},
+			},
+		},
+		{
+			name:     "flag name not used by the module",
+			files:    map[string]string{"main.tf": awsProvider},
+			flagName: "azurerm",
+			err:      true,
+		},
+		{
+			name:  "no provider",
+			files: map[string]string{"main.tf": `variable "x" {}`},
+			err:   true,
+		},
+		{
+			name:     "no provider with flags",
+			files:    map[string]string{"main.tf": `variable "x" {}`},
+			flagName: "linode",
+			source:   "linode/linode",
+			want: moduleProvider{
+				Name:   "linode",
+				Source: "linode/linode",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			module, err := loadModule(writeModule(t, c.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := detectProvider(module, c.flagName, c.source)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, c.want) {
+				t.Errorf("got %+v, want %+v", *got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const (
+	defaultModuleRegistry = "registry.terraform.io"
+	modulesServiceID      = "modules.v1"
+	discoveryPath         = "/.well-known/terraform.json"
+	terraformGetHeader    = "X-Terraform-Get"
+)
+
+var (
+	registryNamePattern = regexp.MustCompile(`^[0-9A-Za-z](?:[0-9A-Za-z-_]{0,62}[0-9A-Za-z])?$`)
+	registryProvPattern = regexp.MustCompile(`^[0-9a-z]{1,64}$`)
+)
+
+// registryModule is the address of a module in a terraform module registry,
+// i.e. [hostname/]namespace/name/provider
+type registryModule struct {
+	Host      string
+	Namespace string
+	Name      string
+	Provider  string
+}
+
+func (m registryModule) String() string {
+	return strings.Join([]string{m.Host, m.Namespace, m.Name, m.Provider}, "/")
+}
+
+func (m registryModule) path() string {
+	return strings.Join([]string{m.Namespace, m.Name, m.Provider}, "/")
+}
+
+// parseRegistryModule parses the source as a module registry address. It returns false if the
+// source isn't one, e.g. a git url like github.com/org/repo, which has three parts as well.
+func parseRegistryModule(source string) (*registryModule, bool) {
+	parts := strings.Split(source, "/")
+
+	m := &registryModule{
+		Host: defaultModuleRegistry,
+	}
+	switch len(parts) {
+	case 3:
+		// github.com/org/repo, bitbucket.org/org/repo etc.
+		if strings.Contains(parts[0], ".") {
+			return nil, false
+		}
+	case 4:
+		if !strings.Contains(parts[0], ".") && !strings.Contains(parts[0], ":") && parts[0] != "localhost" {
+			return nil, false
+		}
+		m.Host = strings.ToLower(parts[0])
+		parts = parts[1:]
+	default:
+		return nil, false
+	}
+
+	if !registryNamePattern.MatchString(parts[0]) || !registryNamePattern.MatchString(parts[1]) || !registryProvPattern.MatchString(parts[2]) {
+		return nil, false
+	}
+	m.Namespace, m.Name, m.Provider = parts[0], parts[1], parts[2]
+
+	return m, true
+}
+
+// registryClient speaks the terraform module registry protocol,
+// ref: https://www.terraform.io/internals/module-registry-protocol
+type registryClient struct {
+	client *http.Client
+	// scheme is the url scheme used to reach the registry hosts, https outside of tests
+	scheme string
+}
+
+// newRegistryClient returns a registry client. Like terraform, it authenticates to a
+// registry host with the token in the TF_TOKEN_<host> environment variable, if any.
+func newRegistryClient(client *http.Client, scheme string) *registryClient {
+	return &registryClient{
+		client: client,
+		scheme: scheme,
+	}
+}
+
+// resolve returns the download location of the newest version of the module matching the
+// version constraint, along with the selected version
+func (c *registryClient) resolve(m *registryModule, constraint string) (string, string, error) {
+	base, err := c.discover(m.Host)
+	if err != nil {
+		return "", "", err
+	}
+
+	versions, err := c.versions(base, m)
+	if err != nil {
+		return "", "", err
+	}
+
+	version, err := selectVersion(versions, constraint)
+	if err != nil {
+		return "", "", fmt.Errorf("module %s: %v", m, err)
+	}
+
+	location, err := c.download(base, m, version)
+	if err != nil {
+		return "", "", err
+	}
+
+	return location, version, nil
+}
+
+// discover returns the base url of the modules service of the registry host
+func (c *registryClient) discover(host string) (*url.URL, error) {
+	discoveryURL := &url.URL{
+		Scheme: c.scheme,
+		Host:   host,
+		Path:   discoveryPath,
+	}
+
+	services := map[string]interface{}{}
+	if _, err := c.get(discoveryURL, &services); err != nil {
+		return nil, fmt.Errorf("failed to discover services of registry %s: %v", host, err)
+	}
+
+	svc, ok := services[modulesServiceID].(string)
+	if !ok {
+		return nil, fmt.Errorf("registry %s does not provide the %s service", host, modulesServiceID)
+	}
+
+	base, err := discoveryURL.Parse(svc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s service url of registry %s: %v", modulesServiceID, host, err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	return base, nil
+}
+
+func (c *registryClient) versions(base *url.URL, m *registryModule) ([]string, error) {
+	u, err := base.Parse(m.path() + "/versions")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Modules []struct {
+			Versions []struct {
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"modules"`
+	}
+	if _, err := c.get(u, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list versions of module %s: %v", m, err)
+	}
+
+	var versions []string
+	for _, mod := range resp.Modules {
+		for _, v := range mod.Versions {
+			versions = append(versions, v.Version)
+		}
+	}
+
+	return versions, nil
+}
+
+func (c *registryClient) download(base *url.URL, m *registryModule, version string) (string, error) {
+	u, err := base.Parse(m.path() + "/" + version + "/download")
+	if err != nil {
+		return "", err
+	}
+
+	var body struct {
+		Location string `json:"location"`
+	}
+	header, err := c.get(u, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to get download location of module %s version %s: %v", m, version, err)
+	}
+
+	location := header.Get(terraformGetHeader)
+	if location == "" {
+		location = body.Location
+	}
+	if location == "" {
+		return "", fmt.Errorf("registry did not return a download location for module %s version %s", m, version)
+	}
+
+	return resolveGetterLocation(u, location)
+}
+
+// resolveGetterLocation resolves a download location relative to the url it was returned for,
+// leaving the go-getter forced getter prefix, e.g. git::, in place
+func resolveGetterLocation(base *url.URL, location string) (string, error) {
+	if strings.Contains(location, "::") || !(strings.HasPrefix(location, "/") || strings.HasPrefix(location, "./") || strings.HasPrefix(location, "../")) {
+		return location, nil
+	}
+
+	u, err := base.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+// get sends a GET request and decodes the json body, if any, into out
+func (c *registryClient) get(u *url.URL, out interface{}) (http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := os.Getenv(registryTokenEnv(u.Host)); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(body, out); err != nil {
+			return nil, fmt.Errorf("invalid response from %s: %v", u, err)
+		}
+	case http.StatusNoContent:
+	default:
+		return nil, fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+
+	return resp.Header, nil
+}
+
+// registryTokenEnv returns the name of the environment variable terraform reads the
+// credentials of a registry host from
+func registryTokenEnv(host string) string {
+	host = strings.ReplaceAll(host, ".", "_")
+	host = strings.ReplaceAll(host, "-", "__")
+	return "TF_TOKEN_" + host
+}
+
+// selectVersion returns the newest version matching the terraform version constraint.
+// Prereleases are only selected when the constraint names them exactly.
+func selectVersion(versions []string, constraint string) (string, error) {
+	var c *semver.Constraints
+	if constraint != "" {
+		var err error
+		c, err = semver.NewConstraint(terraformConstraint(constraint))
+		if err != nil {
+			return "", fmt.Errorf("invalid version constraint %q: %v", constraint, err)
+		}
+	}
+
+	var candidates []*semver.Version
+	for _, v := range versions {
+		sv, err := semver.NewVersion(v)
+		if err != nil {
+			continue
+		}
+		if c == nil && sv.Prerelease() != "" {
+			continue
+		}
+		if c != nil && !c.Check(sv) {
+			continue
+		}
+		candidates = append(candidates, sv)
+	}
+
+	if len(candidates) == 0 {
+		if constraint == "" {
+			return "", fmt.Errorf("no version available")
+		}
+		return "", fmt.Errorf("no version matches the constraint %q", constraint)
+	}
+
+	sort.Sort(sort.Reverse(semver.Collection(candidates)))
+	return candidates[0].Original(), nil
+}
+
+// terraformConstraint rewrites the pessimistic constraint operator of terraform, which
+// allows only the rightmost version component to increment, e.g. ~> 1.2 means >= 1.2, < 2.0,
+// into the equivalent range understood by semver.
+func terraformConstraint(constraint string) string {
+	parts := strings.Split(constraint, ",")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if !strings.HasPrefix(part, "~>") {
+			parts[i] = part
+			continue
+		}
+
+		version := strings.TrimSpace(strings.TrimPrefix(part, "~>"))
+		segments := strings.Split(strings.SplitN(version, "-", 2)[0], ".")
+		nums := make([]uint64, len(segments))
+		valid := true
+		for j, seg := range segments {
+			n, err := strconv.ParseUint(seg, 10, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			nums[j] = n
+		}
+
+		switch {
+		case !valid:
+			parts[i] = part
+		case len(segments) == 1:
+			parts[i] = ">= " + version
+		case len(segments) == 2:
+			parts[i] = fmt.Sprintf(">= %s, < %d.0.0", version, nums[0]+1)
+		default:
+			parts[i] = fmt.Sprintf(">= %s, < %d.%d.0", version, nums[0], nums[1]+1)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,250 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRegistryModule(t *testing.T) {
+	cases := []struct {
+		source string
+		want   *registryModule
+	}{
+		{source: "terraform-aws-modules/vpc/aws", want: &registryModule{Host: defaultModuleRegistry, Namespace: "terraform-aws-modules", Name: "vpc", Provider: "aws"}},
+		{source: "app.terraform.io/example-corp/k8s-cluster/azurerm", want: &registryModule{Host: "app.terraform.io", Namespace: "example-corp", Name: "k8s-cluster", Provider: "azurerm"}},
+		{source: "Registry.Example.com/org/net/google", want: &registryModule{Host: "registry.example.com", Namespace: "org", Name: "net", Provider: "google"}},
+		{source: "localhost:8080/org/net/google", want: &registryModule{Host: "localhost:8080", Namespace: "org", Name: "net", Provider: "google"}},
+		{source: "github.com/org/repo"},
+		{source: "org/repo"},
+		{source: "org/vpc/AWS"},
+		{source: "org/-vpc/aws"},
+		{source: "modules/org/vpc/aws"},
+		{source: "a.example.com/org/vpc/aws/extra"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.source, func(t *testing.T) {
+			got, ok := parseRegistryModule(c.source)
+			if ok != (c.want != nil) {
+				t.Fatalf("expected registry address %v, got %v", c.want != nil, ok)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	versions := []string{"0.9.0", "1.0.0", "1.2.0", "1.2.5", "1.3.0", "2.0.0", "2.1.0-beta.1", "invalid"}
+
+	cases := []struct {
+		constraint string
+		want       string
+		err        bool
+	}{
+		{constraint: "", want: "2.0.0"},
+		{constraint: "1.2.0", want: "1.2.0"},
+		{constraint: "~> 1.2", want: "1.3.0"},
+		{constraint: "~> 1.2.0", want: "1.2.5"},
+		{constraint: "~> 1", want: "2.0.0"},
+		{constraint: ">= 1.0, < 1.3", want: "1.2.5"},
+		{constraint: "!= 2.0.0, >= 1.3", want: "1.3.0"},
+		{constraint: "2.1.0-beta.1", want: "2.1.0-beta.1"},
+		{constraint: "> 3.0", err: true},
+		{constraint: "not a constraint", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.constraint, func(t *testing.T) {
+			got, err := selectVersion(versions, c.constraint)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveGetterLocation(t *testing.T) {
+	base, err := url.Parse("https://registry.example.com/v1/modules/org/vpc/aws/1.0.0/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"git::https://github.com/org/vpc?ref=v1.0.0": "git::https://github.com/org/vpc?ref=v1.0.0",
+		"https://example.com/vpc.tar.gz":             "https://example.com/vpc.tar.gz",
+		"/archives/vpc.tar.gz":                       "https://registry.example.com/archives/vpc.tar.gz",
+		"./vpc.tar.gz":                               "https://registry.example.com/v1/modules/org/vpc/aws/1.0.0/vpc.tar.gz",
+		"../vpc.tar.gz":                              "https://registry.example.com/v1/modules/org/vpc/aws/vpc.tar.gz",
+	}
+	for location, want := range cases {
+		got, err := resolveGetterLocation(base, location)
+		if err != nil {
+			t.Errorf("%s: %v", location, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", location, want, got)
+		}
+	}
+}
+
+// registryTestServer serves the modules of a stand-in registry. The download location of
+// a module version is returned in the X-Terraform-Get header and points at the archive
+// served by the registry itself.
+func registryTestServer(t *testing.T, token string, archives map[string][]byte) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"%s": "/api/modules/"}`, modulesServiceID)
+	})
+	mux.HandleFunc("/api/modules/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch rest := strings.TrimPrefix(r.URL.Path, "/api/modules/"); rest {
+		case "org/vpc/aws/versions":
+			_, _ = w.Write([]byte(`{"modules": [{"versions": [{"version": "1.0.0"}, {"version": "1.1.0"}, {"version": "2.0.0"}]}]}`))
+		case "org/vpc/aws/1.0.0/download", "org/vpc/aws/1.1.0/download", "org/vpc/aws/2.0.0/download":
+			version := strings.Split(rest, "/")[3]
+			w.Header().Set(terraformGetHeader, "/archives/vpc-"+version+".tar.gz")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/archives/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := archives[strings.TrimPrefix(r.URL.Path, "/archives/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write(data)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRegistryClientResolve(t *testing.T) {
+	server := registryTestServer(t, "registry-secret", nil)
+	host := strings.TrimPrefix(server.URL, "http://")
+	t.Setenv(registryTokenEnv(host), "registry-secret")
+
+	m := &registryModule{Host: host, Namespace: "org", Name: "vpc", Provider: "aws"}
+	c := newRegistryClient(server.Client(), "http")
+
+	cases := []struct {
+		constraint string
+		version    string
+		err        bool
+	}{
+		{constraint: "", version: "2.0.0"},
+		{constraint: "~> 1.0", version: "1.1.0"},
+		{constraint: "1.0.0", version: "1.0.0"},
+		{constraint: ">= 3.0", err: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.constraint, func(t *testing.T) {
+			location, version, err := c.resolve(m, tc.constraint)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got version %s", version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != tc.version {
+				t.Errorf("expected version %s, got %s", tc.version, version)
+			}
+			if want := server.URL + "/archives/vpc-" + tc.version + ".tar.gz"; location != want {
+				t.Errorf("expected location %s, got %s", want, location)
+			}
+		})
+	}
+
+	if _, _, err := c.resolve(&registryModule{Host: host, Namespace: "org", Name: "missing", Provider: "aws"}, ""); err == nil {
+		t.Error("expected an error for a missing module")
+	}
+
+	t.Setenv(registryTokenEnv(host), "")
+	if _, _, err := c.resolve(m, ""); err == nil {
+		t.Error("expected an error without the registry token")
+	}
+}
+
+func TestFetchRegistryModule(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "vpc.tar.gz")
+	writeArchive(t, archive, archiveTarGz, map[string]string{
+		"main.tf":                sourceTestModule,
+		"modules/subnet/vars.tf": sourceTestModule,
+	})
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := registryTestServer(t, "registry-secret", map[string][]byte{"vpc-1.1.0.tar.gz": data})
+	host := strings.TrimPrefix(server.URL, "http://")
+	t.Setenv(registryTokenEnv(host), "registry-secret")
+
+	m := &registryModule{Host: host, Namespace: "org", Name: "vpc", Provider: "aws"}
+	c := newRegistryClient(server.Client(), "http")
+
+	// the registry token authenticates to the registry only and the git token isn't sent
+	// to the registry host serving the package
+	fetched, err := fetchRegistryModule(c, m, "modules/subnet", &gitAuth{Token: "pkg-secret"}, "", "~> 1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fetched.Close()
+	if _, err := os.Stat(filepath.Join(fetched.Dir, "vars.tf")); err != nil {
+		t.Errorf("module is not found in %s: %v", fetched.Dir, err)
+	}
+
+	if _, err := fetchRegistryModule(c, m, "", &gitAuth{}, "main", ""); err == nil {
+		t.Error("expected an error for a ref of a registry module")
+	}
+}
@@ -52,7 +52,10 @@ func NewKubeformCmd(in io.Reader, out, err io.Writer) *cobra.Command {
 	rootCmd.AddCommand(NewCmdCompletion())
 	rootCmd.AddCommand(v.NewCmdVersion())
 	rootCmd.AddCommand(NewCmdGetTF("kf", f, ioStreams))
-	rootCmd.AddCommand(NewCmdGenModule("kf", f))
+	rootCmd.AddCommand(NewCmdGenModule("kf", f, ioStreams))
+	rootCmd.AddCommand(NewCmdCache(ioStreams))
+	rootCmd.AddCommand(NewCmdModule("kf", f, ioStreams))
+	rootCmd.AddCommand(NewCmdValidate("kf", f, ioStreams))
 
 	return rootCmd
 }
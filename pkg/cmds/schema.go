@@ -0,0 +1,227 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/ghodss/yaml"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// SensitiveExtension marks the inputs coming from terraform variables declared with `sensitive = true`
+const SensitiveExtension = "x-kubeform-sensitive"
+
+// schemaExtensions holds the vendor extensions of the input properties keyed by the variable name.
+// JSONSchemaProps has no place for arbitrary `x-` keys, so they are merged into the generated yaml
+// of the ModuleDefinition by marshalModuleDefinition.
+type schemaExtensions map[string]map[string]interface{}
+
+func (e schemaExtensions) set(variable, key string, value interface{}) {
+	if e[variable] == nil {
+		e[variable] = map[string]interface{}{}
+	}
+	e[variable][key] = value
+}
+
+// marshalModuleDefinition returns the yaml of the given ModuleDefinition with the extensions
+// added to the respective properties of spec.schema.properties.input
+func marshalModuleDefinition(modObj *v1alpha1.ModuleDefinition, extensions schemaExtensions) ([]byte, error) {
+	if len(extensions) == 0 {
+		return yaml.Marshal(modObj)
+	}
+
+	data, err := json.Marshal(modObj)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := map[string]interface{}{}
+	if err = json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	props, ok := nestedMap(obj, "spec", "schema", "properties", "input", "properties")
+	if !ok {
+		return nil, fmt.Errorf("input properties not found in the schema of module definition %s", modObj.Name)
+	}
+
+	for variable, ext := range extensions {
+		prop, ok := props[variable].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("input property %s not found in the schema of module definition %s", variable, modObj.Name)
+		}
+
+		for k, v := range ext {
+			prop[k] = v
+		}
+	}
+
+	return yaml.Marshal(obj)
+}
+
+func nestedMap(obj map[string]interface{}, fields ...string) (map[string]interface{}, bool) {
+	cur := obj
+	for _, field := range fields {
+		next, ok := cur[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+
+	return cur, true
+}
+
+// convertDefault converts a default value, as decoded by tfconfig, to the json type expected by the
+// schema. This follows the conversions terraform does itself for the default of a variable,
+// e.g. `default = 8080` for a variable of type string becomes "8080".
+func convertDefault(schema *v1.JSONSchemaProps, val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	switch schema.Type {
+	case String:
+		switch v := val.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case Number:
+		switch v := val.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case "boolean":
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case "array":
+		v, ok := val.([]interface{})
+		if !ok {
+			break
+		}
+
+		// a tuple has the same minimum and maximum number of elements
+		if schema.MinItems != nil && schema.MaxItems != nil && *schema.MinItems == *schema.MaxItems && int64(len(v)) != *schema.MinItems {
+			return nil, fmt.Errorf("tuple requires exactly %d elements, got %d", *schema.MinItems, len(v))
+		}
+
+		out := make([]interface{}, 0, len(v))
+		for i, elem := range v {
+			var err error
+			if schema.Items != nil && schema.Items.Schema != nil {
+				elem, err = convertDefault(schema.Items.Schema, elem)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %v", i, err)
+			}
+			out = append(out, elem)
+		}
+		return out, nil
+	case "object":
+		v, ok := val.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		if schema.Properties == nil {
+			out := make(map[string]interface{}, len(v))
+			for key, elem := range v {
+				var err error
+				if schema.AdditionalProperties != nil && schema.AdditionalProperties.Schema != nil {
+					elem, err = convertDefault(schema.AdditionalProperties.Schema, elem)
+					if err != nil {
+						return nil, fmt.Errorf("element %q: %v", key, err)
+					}
+				}
+				out[key] = elem
+			}
+			return out, nil
+		}
+
+		for key := range v {
+			if _, found := schema.Properties[key]; !found {
+				return nil, fmt.Errorf("unsupported attribute %q", key)
+			}
+		}
+		for _, key := range schema.Required {
+			if _, found := v[key]; !found {
+				return nil, fmt.Errorf("attribute %q is required", key)
+			}
+		}
+
+		out := make(map[string]interface{}, len(schema.Properties))
+		for key, prop := range schema.Properties {
+			prop := prop
+			elem, found := v[key]
+			if !found {
+				// optional attributes that are omitted take their own default, if any
+				if prop.Default == nil {
+					continue
+				}
+				if err := json.Unmarshal(prop.Default.Raw, &elem); err != nil {
+					return nil, err
+				}
+			}
+
+			elem, err := convertDefault(&prop, elem)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q: %v", key, err)
+			}
+			out[key] = elem
+		}
+		return out, nil
+	default:
+		// any
+		return val, nil
+	}
+
+	return nil, fmt.Errorf("%v is not a valid %s", val, schema.Type)
+}
+
+// defaultJSON converts the default value and wraps it for using as the default of the schema
+func defaultJSON(schema *v1.JSONSchemaProps, val interface{}) (*v1.JSON, error) {
+	def, err := convertDefault(schema, val)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(def)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.JSON{Raw: raw}, nil
+}
@@ -0,0 +1,215 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubeform.dev/module/api/v1alpha1"
+)
+
+func TestConvertDefault(t *testing.T) {
+	cases := []struct {
+		name string
+		typ  string
+		val  interface{}
+		want interface{}
+		err  bool
+	}{
+		{name: "string", typ: "string", val: "a", want: "a"},
+		{name: "number to string", typ: "string", val: 8080.0, want: "8080"},
+		{name: "bool to string", typ: "string", val: true, want: "true"},
+		{name: "number", typ: "number", val: 1.5, want: 1.5},
+		{name: "string to number", typ: "number", val: "42", want: 42.0},
+		{name: "invalid number", typ: "number", val: "abc", err: true},
+		{name: "string to bool", typ: "bool", val: "true", want: true},
+		{name: "invalid bool", typ: "bool", val: 1.0, err: true},
+		{name: "list", typ: "list(string)", val: []interface{}{1.0, "b"}, want: []interface{}{"1", "b"}},
+		{name: "list of wrong type", typ: "list(number)", val: "a", err: true},
+		{name: "tuple", typ: "tuple([string, string])", val: []interface{}{"a", 1.0}, want: []interface{}{"a", "1"}},
+		{name: "tuple of wrong size", typ: "tuple([string, string])", val: []interface{}{"a"}, err: true},
+		{name: "map", typ: "map(number)", val: map[string]interface{}{"a": "1"}, want: map[string]interface{}{"a": 1.0}},
+		{
+			name: "object with optional default",
+			typ:  "object({ name = string, port = optional(number, 80), tls = optional(bool) })",
+			val:  map[string]interface{}{"name": "web"},
+			want: map[string]interface{}{"name": "web", "port": 80.0},
+		},
+		{name: "object with missing attribute", typ: "object({ name = string })", val: map[string]interface{}{}, err: true},
+		{name: "object with unknown attribute", typ: "object({ name = string })", val: map[string]interface{}{"name": "a", "x": 1.0}, err: true},
+		{name: "any", typ: "any", val: []interface{}{true, 1.0}, want: []interface{}{true, 1.0}},
+		{name: "null", typ: "string", val: nil, want: nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			schema, err := parseTypeExpr(c.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := convertDefault(schema, c.val)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestVariableDefaults(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"main.tf": `
+terraform {
+  required_providers {
+    aws = { source = "hashicorp/aws" }
+  }
+}
+
+variable "name" {
+  type        = string
+  description = "Name of the bucket"
+}
+
+variable "port" {
+  type    = string
+  default = 8080
+}
+
+variable "tags" {
+  type    = map(string)
+  default = null
+}
+
+variable "password" {
+  type      = string
+  sensitive = true
+}
+
+variable "zones" {
+  type    = list(string)
+  default = []
+}
+`,
+	})
+
+	module, diags := tfconfig.LoadModule(dir)
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+	var keys []string
+	for k := range module.Variables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	props, required, extensions, err := processInput(keys, module.Variables, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &v1alpha1.ModuleDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+		Spec: v1alpha1.ModuleDefinitionSpec{
+			Schema: v1.JSONSchemaProps{
+				Type: "object",
+				Properties: map[string]v1.JSONSchemaProps{
+					"input": {Type: "object", Properties: props, Required: required},
+				},
+			},
+		},
+	}
+	data, err := marshalModuleDefinition(md, extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	input, _ := nestedMap(obj, "spec", "schema", "properties", "input")
+
+	if got := input["required"]; !reflect.DeepEqual(got, []interface{}{"name", "password"}) {
+		t.Errorf("required inputs are %v", got)
+	}
+
+	inputProps, _ := input["properties"].(map[string]interface{})
+	expected := map[string]string{
+		"name": `
+type: string
+description: Name of the bucket`,
+		"port": `
+type: string
+default: "8080"`,
+		"tags": `
+type: object
+nullable: true
+additionalProperties:
+  type: string`,
+		"password": `
+type: string
+x-kubeform-sensitive: true`,
+		"zones": `
+type: array
+default: []
+items:
+  type: string`,
+	}
+	for name, schema := range expected {
+		var want interface{}
+		if err := yaml.Unmarshal([]byte(schema), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(inputProps[name], want) {
+			got, _ := yaml.Marshal(inputProps[name])
+			t.Errorf("unexpected schema of %s, got\n%s", name, got)
+		}
+	}
+}
+
+// writeModule writes the files of a terraform module into a temporary directory
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(strings.TrimLeft(content, "\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
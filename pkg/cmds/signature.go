@@ -0,0 +1,494 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/crypto/ssh"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	SignerAnnotation     = "tf.kubeform.com/signer"
+	SigningKeyAnnotation = "tf.kubeform.com/signing-key"
+)
+
+const (
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+
+	// sshSigMagic starts the ssh signatures, see PROTOCOL.sshsig of openssh
+	sshSigMagic = "SSHSIG"
+	// sshSigNamespace is the namespace of the ssh signatures made by git
+	sshSigNamespace = "git"
+)
+
+// signatureVerifier verifies the signature of the checked out tag or commit against the
+// trusted keys only, the keys and the git config of the user are never consulted
+type signatureVerifier struct {
+	// GPGKeyring is a file of the trusted GPG public keys, armored or binary
+	GPGKeyring string
+	// SSHAllowedSigners is an allowed signers file of the trusted SSH keys, see ssh-keygen(1)
+	SSHAllowedSigners string
+}
+
+// moduleSigner is the identity that signed the module
+type moduleSigner struct {
+	Identity string
+	Key      string
+}
+
+func (sv *signatureVerifier) enabled() bool {
+	return sv.GPGKeyring != "" || sv.SSHAllowedSigners != ""
+}
+
+func (sv *signatureVerifier) validate() error {
+	if sv.GPGKeyring != "" {
+		if _, err := readGPGKeyring(sv.GPGKeyring); err != nil {
+			return fmt.Errorf("failed to read signing keys: %v", err)
+		}
+	}
+	if sv.SSHAllowedSigners != "" {
+		if _, err := readAllowedSigners(sv.SSHAllowedSigners); err != nil {
+			return fmt.Errorf("failed to read signing keys: %v", err)
+		}
+	}
+	return nil
+}
+
+// verify checks the signature of the annotated tag the module was checked out at, or of the
+// commit if it wasn't checked out at an annotated tag
+func (sv *signatureVerifier) verify(m *fetchedModule) (*moduleSigner, error) {
+	if !m.Git || m.CheckOut == "" {
+		return nil, fmt.Errorf("signatures can only be verified for git sources, %s is not checked out from a git repository, give a local repository as git::<path>", m.Dir)
+	}
+
+	repo, err := git.PlainOpenWithOptions(m.Dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, err
+	}
+
+	object, kind, typ := m.CheckOut, "commit", plumbing.CommitObject
+	if m.Tag != "" {
+		object, kind, typ = m.Tag, "tag "+m.Ref, plumbing.TagObject
+	}
+	raw, err := readRawObject(repo, typ, object)
+	if err != nil {
+		return nil, fmt.Errorf("signature verification of %s %s failed: %v", kind, m.CheckOut, err)
+	}
+
+	var payload, signature []byte
+	if m.Tag != "" {
+		payload, signature = splitTagSignature(raw)
+	} else {
+		payload, signature = splitCommitSignature(raw)
+	}
+
+	var signer *moduleSigner
+	switch {
+	case len(signature) == 0:
+		err = fmt.Errorf("no signature found")
+	case bytes.HasPrefix(signature, []byte(pgpSignatureHeader)):
+		signer, err = sv.verifyGPG(payload, signature)
+	case bytes.HasPrefix(signature, []byte(sshSignatureHeader)):
+		signer, err = sv.verifySSH(payload, signature)
+	default:
+		err = fmt.Errorf("unsupported signature format")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signature verification of %s %s failed: %v", kind, m.CheckOut, err)
+	}
+
+	return signer, nil
+}
+
+func readRawObject(repo *git.Repository, typ plumbing.ObjectType, object string) ([]byte, error) {
+	obj, err := repo.Storer.EncodedObject(typ, plumbing.NewHash(object))
+	if err != nil {
+		return nil, err
+	}
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// splitCommitSignature splits the raw commit object into the signed payload, i.e. the commit
+// without the gpgsig header, and the signature held by the header
+func splitCommitSignature(raw []byte) ([]byte, []byte) {
+	var payload, signature []byte
+	inHeaders, inSignature := true, false
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		if inHeaders {
+			switch {
+			case inSignature && bytes.HasPrefix(line, []byte(" ")):
+				signature = append(signature, line[1:]...)
+				continue
+			case bytes.HasPrefix(line, []byte("gpgsig ")):
+				inSignature = true
+				signature = append(signature, line[len("gpgsig "):]...)
+				continue
+			case bytes.Equal(line, []byte("\n")):
+				inHeaders = false
+			}
+			inSignature = false
+		}
+		payload = append(payload, line...)
+	}
+
+	return payload, signature
+}
+
+// splitTagSignature splits the raw tag object into the signed payload and the signature
+// appended to the message
+func splitTagSignature(raw []byte) ([]byte, []byte) {
+	offset := 0
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte(pgpSignatureHeader)) || bytes.HasPrefix(line, []byte(sshSignatureHeader)) {
+			return raw[:offset], raw[offset:]
+		}
+		offset += len(line)
+	}
+
+	return raw, nil
+}
+
+// verifyGPG checks the armored gpg signature against the keys of the gpg keyring. The key of
+// the signer is the fingerprint of the signing key, which may be a subkey.
+func (sv *signatureVerifier) verifyGPG(payload, signature []byte) (*moduleSigner, error) {
+	if sv.GPGKeyring == "" {
+		return nil, fmt.Errorf("signed with a gpg key, but no gpg keyring is given")
+	}
+	keyring, err := readGPGKeyring(sv.GPGKeyring)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := armor.Decode(bytes.NewReader(signature))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gpg signature: %v", err)
+	}
+	body, err := io.ReadAll(block.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gpg signature: %v", err)
+	}
+	p, err := packet.Read(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gpg signature: %v", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok || sig.IssuerKeyId == nil {
+		return nil, fmt.Errorf("invalid gpg signature")
+	}
+
+	entity, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(payload), bytes.NewReader(body), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &moduleSigner{
+		Identity: gpgIdentity(entity),
+		Key:      gpgFingerprint(entity.PrimaryKey),
+	}
+	for _, key := range keyring.KeysById(*sig.IssuerKeyId) {
+		if key.Entity == entity {
+			signer.Key = gpgFingerprint(key.PublicKey)
+		}
+	}
+
+	return signer, nil
+}
+
+// readGPGKeyring reads the armored or binary gpg keyring
+func readGPGKeyring(filename string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid gpg keyring %s: %v", filename, err)
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("no key is found in gpg keyring %s", filename)
+	}
+
+	return keyring, nil
+}
+
+// gpgIdentity returns the primary identity of the key, or the first one by name, so that the
+// same key always gives the same identity
+func gpgIdentity(entity *openpgp.Entity) string {
+	var names []string
+	for name, identity := range entity.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func gpgFingerprint(key *packet.PublicKey) string {
+	return strings.ToUpper(hex.EncodeToString(key.Fingerprint))
+}
+
+// verifySSH checks the armored ssh signature against the keys of the allowed signers file.
+// The identity of the signer is the principals of the matching entry.
+func (sv *signatureVerifier) verifySSH(payload, signature []byte) (*moduleSigner, error) {
+	if sv.SSHAllowedSigners == "" {
+		return nil, fmt.Errorf("signed with an ssh key, but no ssh allowed signers file is given")
+	}
+	signers, err := readAllowedSigners(sv.SSHAllowedSigners)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := verifySSHSignature(payload, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, s := range signers {
+		if bytes.Equal(s.Key.Marshal(), key.Marshal()) && s.allows(sshSigNamespace, now) {
+			return &moduleSigner{
+				Identity: s.Principals,
+				Key:      ssh.FingerprintSHA256(key),
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("signing key %s is not an allowed signer", ssh.FingerprintSHA256(key))
+}
+
+// sshSignature is the ssh signature blob following the magic, see PROTOCOL.sshsig of openssh
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is the data signed by the key of an ssh signature, following the magic
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// verifySSHSignature checks the armored ssh signature of the payload, made in the git
+// namespace, and returns the key that made it
+func verifySSHSignature(payload, armored []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != "SSH SIGNATURE" || !bytes.HasPrefix(block.Bytes, []byte(sshSigMagic)) {
+		return nil, fmt.Errorf("invalid ssh signature")
+	}
+	sig := &sshSignature{}
+	if err := ssh.Unmarshal(block.Bytes[len(sshSigMagic):], sig); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %v", err)
+	}
+	if sig.Version != 1 {
+		return nil, fmt.Errorf("unsupported ssh signature version %d", sig.Version)
+	}
+	if sig.Namespace != sshSigNamespace {
+		return nil, fmt.Errorf("ssh signature is made in the namespace %q instead of %q", sig.Namespace, sshSigNamespace)
+	}
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key of ssh signature: %v", err)
+	}
+	if _, ok := key.(*ssh.Certificate); ok {
+		return nil, fmt.Errorf("ssh signatures made by certificates are not supported")
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q of ssh signature", sig.HashAlgorithm)
+	}
+	h.Write(payload)
+
+	s := &ssh.Signature{}
+	if err := ssh.Unmarshal(sig.Signature, s); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %v", err)
+	}
+	if s.Format == ssh.SigAlgoRSA {
+		return nil, fmt.Errorf("ssh signatures using sha1 are not accepted")
+	}
+
+	signed := append([]byte(sshSigMagic), ssh.Marshal(&sshSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+	if err := key.Verify(signed, s); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// allowedSigner is an entry of an allowed signers file
+type allowedSigner struct {
+	Principals  string
+	Key         ssh.PublicKey
+	Namespaces  []string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+// allows tells whether the key of the entry may sign in the namespace at the time
+func (s *allowedSigner) allows(namespace string, t time.Time) bool {
+	if len(s.Namespaces) > 0 && !contains(s.Namespaces, namespace) && !contains(s.Namespaces, "*") {
+		return false
+	}
+	if !s.ValidAfter.IsZero() && t.Before(s.ValidAfter) {
+		return false
+	}
+	if !s.ValidBefore.IsZero() && t.After(s.ValidBefore) {
+		return false
+	}
+	return true
+}
+
+// readAllowedSigners reads the allowed signers file, i.e. lines of principals, options and a
+// public key. Certificate authorities are not supported, their entries are skipped.
+func readAllowedSigners(filename string) ([]allowedSigner, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var signers []allowedSigner
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid line %d of allowed signers file %s", n, filename)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(line[i:])))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %d of allowed signers file %s: %v", n, filename, err)
+		}
+
+		s := allowedSigner{
+			Principals: line[:i],
+			Key:        key,
+		}
+		skip := false
+		for _, option := range options {
+			name, value := option, ""
+			if i := strings.Index(option, "="); i >= 0 {
+				name, value = option[:i], strings.Trim(option[i+1:], `"`)
+			}
+			switch strings.ToLower(name) {
+			case "cert-authority":
+				skip = true
+			case "namespaces":
+				s.Namespaces = strings.Split(value, ",")
+			case "valid-after":
+				s.ValidAfter, err = parseAllowedSignerTime(value)
+			case "valid-before":
+				s.ValidBefore, err = parseAllowedSignerTime(value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid line %d of allowed signers file %s: %v", n, filename, err)
+			}
+		}
+		if skip {
+			klog.Warningf("skipping certificate authority %s of allowed signers file %s, certificates are not supported", s.Principals, filename)
+			continue
+		}
+
+		signers = append(signers, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return signers, nil
+}
+
+// parseAllowedSignerTime parses the YYYYMMDD[HHMM[SS]] time of the valid-after and
+// valid-before options, in UTC with a trailing Z and in local time otherwise
+func parseAllowedSignerTime(value string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(value, "Z") {
+		value, loc = strings.TrimSuffix(value, "Z"), time.UTC
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, loc)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+func setSignerAnnotations(modObj *v1alpha1.ModuleDefinition, signer *moduleSigner) {
+	if signer.Identity != "" {
+		metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, SignerAnnotation, signer.Identity)
+	}
+	metav1.SetMetaDataAnnotation(&modObj.ObjectMeta, SigningKeyAnnotation, signer.Key)
+}
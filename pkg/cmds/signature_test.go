@@ -0,0 +1,589 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSplitCommitSignature(t *testing.T) {
+	const unsigned = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author test <test@example.com> 1700000000 +0000\n" +
+		"committer test <test@example.com> 1700000000 +0000\n" +
+		"\n" +
+		"message\n" +
+		" indented line of the message\n"
+	const signature = "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n"
+
+	cases := []struct {
+		name      string
+		raw       string
+		payload   string
+		signature string
+	}{
+		{name: "unsigned", raw: unsigned, payload: unsigned},
+		{
+			name: "signed",
+			raw: strings.Replace(unsigned, "\n\n",
+				"\ngpgsig -----BEGIN SSH SIGNATURE-----\n U1NIU0lH\n -----END SSH SIGNATURE-----\n\n", 1),
+			payload:   unsigned,
+			signature: signature,
+		},
+		{
+			name: "header after the signature",
+			raw: strings.Replace(unsigned, "committer",
+				"gpgsig -----BEGIN SSH SIGNATURE-----\n U1NIU0lH\n -----END SSH SIGNATURE-----\ncommitter", 1),
+			payload:   unsigned,
+			signature: signature,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payload, signature := splitCommitSignature([]byte(c.raw))
+			if string(payload) != c.payload {
+				t.Errorf("expected payload %q, got %q", c.payload, payload)
+			}
+			if string(signature) != c.signature {
+				t.Errorf("expected signature %q, got %q", c.signature, signature)
+			}
+		})
+	}
+}
+
+func TestSplitTagSignature(t *testing.T) {
+	const unsigned = "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"type commit\n" +
+		"tag v1.0.0\n" +
+		"tagger test <test@example.com> 1700000000 +0000\n" +
+		"\n" +
+		"v1.0.0\n"
+
+	cases := []struct {
+		name      string
+		raw       string
+		payload   string
+		signature string
+	}{
+		{name: "unsigned", raw: unsigned, payload: unsigned},
+		{
+			name:      "pgp",
+			raw:       unsigned + "-----BEGIN PGP SIGNATURE-----\n\nwsBc\n-----END PGP SIGNATURE-----\n",
+			payload:   unsigned,
+			signature: "-----BEGIN PGP SIGNATURE-----\n\nwsBc\n-----END PGP SIGNATURE-----\n",
+		},
+		{
+			name:      "ssh",
+			raw:       unsigned + "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n",
+			payload:   unsigned,
+			signature: "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n",
+		},
+		{
+			name:    "header in the middle of a line",
+			raw:     unsigned + "see -----BEGIN PGP SIGNATURE-----\n",
+			payload: unsigned + "see -----BEGIN PGP SIGNATURE-----\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payload, signature := splitTagSignature([]byte(c.raw))
+			if string(payload) != c.payload {
+				t.Errorf("expected payload %q, got %q", c.payload, payload)
+			}
+			if string(signature) != c.signature {
+				t.Errorf("expected signature %q, got %q", c.signature, signature)
+			}
+		})
+	}
+}
+
+func TestReadAllowedSigners(t *testing.T) {
+	signer := testSSHSigner(t)
+	pub := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	cases := []struct {
+		name    string
+		content string
+		want    []allowedSigner
+		err     bool
+	}{
+		{
+			name:    "key",
+			content: "# trusted signers\n\nsigner@example.com " + pub + " comment\n",
+			want:    []allowedSigner{{Principals: "signer@example.com", Key: signer.PublicKey()}},
+		},
+		{
+			name:    "options",
+			content: "a@example.com,b@example.com\tnamespaces=\"git,file\",valid-after=\"20200101\",valid-before=\"202101020304Z\" " + pub + "\n",
+			want: []allowedSigner{{
+				Principals:  "a@example.com,b@example.com",
+				Key:         signer.PublicKey(),
+				Namespaces:  []string{"git", "file"},
+				ValidAfter:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local),
+				ValidBefore: time.Date(2021, 1, 2, 3, 4, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name:    "certificate authority",
+			content: "*@example.com cert-authority " + pub + "\n",
+		},
+		{name: "principals only", content: "signer@example.com\n", err: true},
+		{name: "invalid key", content: "signer@example.com ssh-ed25519 AAAA\n", err: true},
+		{name: "invalid time", content: "signer@example.com valid-after=\"2020\" " + pub + "\n", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "allowed_signers")
+			if err := os.WriteFile(filename, []byte(c.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readAllowedSigners(filename)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("expected %d signers, got %d", len(c.want), len(got))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i].Key.Marshal(), c.want[i].Key.Marshal()) {
+					t.Errorf("unexpected key of signer %d", i)
+				}
+				got[i].Key, c.want[i].Key = nil, nil
+				if !got[i].ValidAfter.Equal(c.want[i].ValidAfter) || !got[i].ValidBefore.Equal(c.want[i].ValidBefore) {
+					t.Errorf("expected validity %v - %v, got %v - %v", c.want[i].ValidAfter, c.want[i].ValidBefore, got[i].ValidAfter, got[i].ValidBefore)
+				}
+				got[i].ValidAfter, got[i].ValidBefore = time.Time{}, time.Time{}
+				c.want[i].ValidAfter, c.want[i].ValidBefore = time.Time{}, time.Time{}
+				if !reflect.DeepEqual(got[i], c.want[i]) {
+					t.Errorf("expected %+v, got %+v", c.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAllowedSignerAllows(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name   string
+		signer allowedSigner
+		want   bool
+	}{
+		{name: "any namespace", signer: allowedSigner{}, want: true},
+		{name: "git namespace", signer: allowedSigner{Namespaces: []string{"file", "git"}}, want: true},
+		{name: "wildcard namespace", signer: allowedSigner{Namespaces: []string{"*"}}, want: true},
+		{name: "other namespace", signer: allowedSigner{Namespaces: []string{"file"}}},
+		{name: "valid", signer: allowedSigner{ValidAfter: now.Add(-time.Hour), ValidBefore: now.Add(time.Hour)}, want: true},
+		{name: "not yet valid", signer: allowedSigner{ValidAfter: now.Add(time.Hour)}},
+		{name: "expired", signer: allowedSigner{ValidBefore: now.Add(-time.Hour)}},
+	}
+
+	for _, c := range cases {
+		if got := c.signer.allows(sshSigNamespace, now); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func testSSHSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// sshSign signs the payload like ssh-keygen -Y sign -n <namespace> does
+func sshSign(t *testing.T, signer ssh.Signer, namespace string, payload []byte) string {
+	t.Helper()
+
+	hash := sha512.Sum512(payload)
+	signed := append([]byte(sshSigMagic), ssh.Marshal(&sshSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Hash:          hash[:],
+	})...)
+	sig, err := signer.Sign(rand.Reader, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := append([]byte(sshSigMagic), ssh.Marshal(&sshSignature{
+		Version:       1,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}))
+}
+
+func armoredPublicKey(t *testing.T, entity *openpgp.Entity) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// signedTestRepo is a repository with commits and annotated tags signed by a gpg and an ssh key
+type signedTestRepo struct {
+	Dir     string
+	Commits map[string]string
+	Tags    map[string]string
+}
+
+func newSignedTestRepo(t *testing.T, entity *openpgp.Entity, signer ssh.Signer) *signedTestRepo {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`variable "name" {}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add("."); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &signedTestRepo{Dir: dir, Commits: map[string]string{}, Tags: map[string]string{}}
+	author := &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(1700000000, 0)}
+	commit := func(msg string, key *openpgp.Entity) plumbing.Hash {
+		t.Helper()
+		hash, err := wt.Commit(msg, &git.CommitOptions{Author: author, SignKey: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	store := func(o interface {
+		Encode(plumbing.EncodedObject) error
+	}) string {
+		t.Helper()
+		obj := repo.Storer.NewEncodedObject()
+		if err := o.Encode(obj); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := repo.Storer.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash.String()
+	}
+	payload := func(o interface {
+		EncodeWithoutSignature(plumbing.EncodedObject) error
+	}) []byte {
+		t.Helper()
+		obj := &plumbing.MemoryObject{}
+		if err := o.EncodeWithoutSignature(obj); err != nil {
+			t.Fatal(err)
+		}
+		rd, _ := obj.Reader()
+		data, _ := io.ReadAll(rd)
+		return data
+	}
+
+	r.Commits["unsigned"] = commit("unsigned", nil).String()
+	r.Commits["gpg"] = commit("gpg", entity).String()
+
+	c, err := repo.CommitObject(commit("ssh", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.PGPSignature = sshSign(t, signer, sshSigNamespace, payload(c))
+	r.Commits["ssh"] = store(c)
+
+	// the signature of the commit doesn't cover the changed message
+	c.Message = "tampered"
+	r.Commits["tampered"] = store(c)
+
+	c, err = repo.CommitObject(commit("ssh other namespace", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.PGPSignature = sshSign(t, signer, "file", payload(c))
+	r.Commits["ssh other namespace"] = store(c)
+
+	head := plumbing.NewHash(r.Commits["gpg"])
+	tag, err := repo.CreateTag("v1.0.0", head, &git.CreateTagOptions{Tagger: author, Message: "v1.0.0", SignKey: entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Tags["gpg"] = tag.Hash().String()
+
+	tag, err = repo.CreateTag("v1.0.1", head, &git.CreateTagOptions{Tagger: author, Message: "v1.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Tags["unsigned"] = tag.Hash().String()
+	to, err := repo.TagObject(tag.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	to.PGPSignature = sshSign(t, signer, sshSigNamespace, payload(to))
+	r.Tags["ssh"] = store(to)
+
+	return r
+}
+
+func TestSignatureVerifierVerify(t *testing.T) {
+	entity, err := openpgp.NewEntity("Module Signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, otherSigner := testSSHSigner(t), testSSHSigner(t)
+	repo := newSignedTestRepo(t, entity, signer)
+
+	keys := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		filename := filepath.Join(keys, name)
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	authorizedKey := func(s ssh.Signer) string {
+		return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(s.PublicKey())))
+	}
+	keyring := write("keyring.asc", armoredPublicKey(t, entity))
+	otherKeyring := write("other.asc", armoredPublicKey(t, other))
+	allowedSigners := write("allowed_signers", `signer@example.com namespaces="git" `+authorizedKey(signer)+"\n")
+	otherSigners := write("other_signers", "other@example.com "+authorizedKey(otherSigner)+"\n")
+	expiredSigners := write("expired_signers", `signer@example.com valid-before="20200101" `+authorizedKey(signer)+"\n")
+
+	gpgSigner := &moduleSigner{Identity: "Module Signer <signer@example.com>", Key: gpgFingerprint(entity.PrimaryKey)}
+	sshSigner := &moduleSigner{Identity: "signer@example.com", Key: ssh.FingerprintSHA256(signer.PublicKey())}
+
+	cases := []struct {
+		name     string
+		verifier signatureVerifier
+		commit   string
+		tag      string
+		want     *moduleSigner
+	}{
+		{name: "gpg signed commit", verifier: signatureVerifier{GPGKeyring: keyring}, commit: "gpg", want: gpgSigner},
+		{name: "gpg signed tag", verifier: signatureVerifier{GPGKeyring: keyring}, commit: "gpg", tag: "gpg", want: gpgSigner},
+		{name: "ssh signed commit", verifier: signatureVerifier{SSHAllowedSigners: allowedSigners}, commit: "ssh", want: sshSigner},
+		{name: "ssh signed tag", verifier: signatureVerifier{SSHAllowedSigners: allowedSigners}, commit: "gpg", tag: "ssh", want: sshSigner},
+		{name: "both kinds of keys", verifier: signatureVerifier{GPGKeyring: keyring, SSHAllowedSigners: allowedSigners}, commit: "ssh", want: sshSigner},
+		{name: "untrusted gpg key", verifier: signatureVerifier{GPGKeyring: otherKeyring}, commit: "gpg"},
+		{name: "untrusted ssh key", verifier: signatureVerifier{SSHAllowedSigners: otherSigners}, commit: "ssh"},
+		{name: "expired ssh key", verifier: signatureVerifier{SSHAllowedSigners: expiredSigners}, commit: "ssh"},
+		{name: "ssh signature of another namespace", verifier: signatureVerifier{SSHAllowedSigners: allowedSigners}, commit: "ssh other namespace"},
+		{name: "gpg signature without keyring", verifier: signatureVerifier{SSHAllowedSigners: allowedSigners}, commit: "gpg"},
+		{name: "ssh signature without allowed signers", verifier: signatureVerifier{GPGKeyring: keyring}, commit: "ssh"},
+		{name: "tampered commit", verifier: signatureVerifier{SSHAllowedSigners: allowedSigners}, commit: "tampered"},
+		{name: "unsigned commit", verifier: signatureVerifier{GPGKeyring: keyring, SSHAllowedSigners: allowedSigners}, commit: "unsigned"},
+		{name: "unsigned tag of signed commit", verifier: signatureVerifier{GPGKeyring: keyring}, commit: "gpg", tag: "unsigned"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := &fetchedModule{
+				Dir:      repo.Dir,
+				Git:      true,
+				Ref:      "v1.0.0",
+				CheckOut: repo.Commits[c.commit],
+				Tag:      repo.Tags[c.tag],
+			}
+			got, err := c.verifier.verify(m)
+			if c.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+
+	if _, err := (&signatureVerifier{GPGKeyring: keyring}).verify(&fetchedModule{Dir: repo.Dir}); err == nil {
+		t.Error("expected an error verifying a module not checked out from git")
+	}
+}
+
+// TestSignatureVerifierGitCLI verifies commits and tags signed by git with keys of gpg and
+// ssh-keygen, kept away from the keys of the user in a throwaway GNUPGHOME
+func TestSignatureVerifierGitCLI(t *testing.T) {
+	for _, bin := range []string{"git", "gpg", "ssh-keygen"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not installed", bin)
+		}
+	}
+
+	gnupgHome, err := os.MkdirTemp("", "kf-gnupg-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--homedir", gnupgHome, "--kill", "all").Run()
+		_ = os.RemoveAll(gnupgHome)
+	})
+	t.Setenv("GNUPGHOME", gnupgHome)
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := t.TempDir()
+	keys := t.TempDir()
+	run := func(name string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(name, args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Skipf("%s %s failed: %v: %s", name, strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	run("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "CLI Signer <cli@example.com>", "ed25519", "sign", "never")
+	var fingerprint string
+	for _, line := range strings.Split(run("gpg", "--batch", "--with-colons", "--list-keys", "cli@example.com"), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" && fingerprint == "" {
+			fingerprint = fields[9]
+		}
+	}
+	keyring := filepath.Join(keys, "keyring.asc")
+	if err := os.WriteFile(keyring, []byte(run("gpg", "--batch", "--armor", "--export", fingerprint)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sshKey := filepath.Join(keys, "id_ed25519")
+	run("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "cli@example.com", "-f", sshKey)
+	pub, err := os.ReadFile(sshKey + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedSigners := filepath.Join(keys, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, []byte("cli@example.com "+string(pub)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, _, _, _, err := ssh.ParseAuthorizedKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitArgs := func(args ...string) []string {
+		return append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	}
+	gpgGit := func(args ...string) string {
+		return run("git", gitArgs(append([]string{"-c", "user.signingkey=" + fingerprint}, args...)...)...)
+	}
+	sshGit := func(args ...string) string {
+		return run("git", gitArgs(append([]string{"-c", "gpg.format=ssh", "-c", "user.signingkey=" + sshKey}, args...)...)...)
+	}
+
+	run("git", "init", "-q")
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`variable "name" {}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("git", "add", ".")
+	gpgGit("commit", "-q", "-S", "-m", "gpg")
+	gpgCommit := run("git", "rev-parse", "HEAD")
+	sshGit("tag", "-s", "-m", "v1.0.0", "v1.0.0")
+	sshTag := run("git", "rev-parse", "v1.0.0")
+	sshGit("commit", "-q", "--allow-empty", "-S", "-m", "ssh")
+	sshCommit := run("git", "rev-parse", "HEAD")
+	gpgGit("tag", "-s", "-m", "v1.0.1", "v1.0.1")
+	gpgTag := run("git", "rev-parse", "v1.0.1")
+
+	verifier := &signatureVerifier{GPGKeyring: keyring, SSHAllowedSigners: allowedSigners}
+	gpgSigner := &moduleSigner{Identity: "CLI Signer <cli@example.com>", Key: fingerprint}
+	sshSigner := &moduleSigner{Identity: "cli@example.com", Key: ssh.FingerprintSHA256(sshPub)}
+
+	cases := []struct {
+		name   string
+		commit string
+		tag    string
+		want   *moduleSigner
+	}{
+		{name: "gpg signed commit", commit: gpgCommit, want: gpgSigner},
+		{name: "ssh signed commit", commit: sshCommit, want: sshSigner},
+		{name: "ssh signed tag", commit: gpgCommit, tag: sshTag, want: sshSigner},
+		{name: "gpg signed tag", commit: sshCommit, tag: gpgTag, want: gpgSigner},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := verifier.verify(&fetchedModule{Dir: dir, Git: true, CheckOut: c.commit, Tag: c.tag})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
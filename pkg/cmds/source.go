@@ -0,0 +1,653 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"k8s.io/klog/v2"
+)
+
+const (
+	archiveZip   = ".zip"
+	archiveTar   = ".tar"
+	archiveTarGz = ".tar.gz"
+	archiveTgz   = ".tgz"
+
+	// maxArchiveSize limits the size of a downloaded archive
+	maxArchiveSize = 100 << 20
+	// maxExtractedSize limits the total size of the files extracted from an archive
+	maxExtractedSize = 500 << 20
+)
+
+// fetchedModule is a module made available in the local filesystem by fetchModule
+type fetchedModule struct {
+	// Dir is the directory holding the terraform files of the module
+	Dir string
+	// GitRef is recorded as the moduleRef of the ModuleDefinition, empty if the module has no git origin
+	GitRef string
+	// Git tells whether the module was cloned from a git repository
+	Git bool
+	// Ref is the git ref asked for, if any, e.g. a branch that moves on
+	Ref string
+	// CheckOut is the commit the module was checked out at, if any
+	CheckOut string
+	// Tag is the annotated tag object the module was checked out at, if any
+	Tag string
+	// SSH tells whether the git repository was cloned over ssh
+	SSH bool
+
+	cleanup func()
+}
+
+func (m *fetchedModule) Close() {
+	if m.cleanup != nil {
+		m.cleanup()
+	}
+}
+
+// subdir moves the module into the subdirectory of the fetched package
+func (m *fetchedModule) subdir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	target, err := archivePath(m.Dir, dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		return fmt.Errorf("subdirectory %s does not exist in the module source", dir)
+	}
+	m.Dir = target
+
+	if m.GitRef != "" {
+		m.GitRef = subdirRef(m.GitRef, dir)
+	}
+
+	return nil
+}
+
+// subdirRef appends the subdirectory to the git ref in the go-getter form, repo//dir
+func subdirRef(ref, dir string) string {
+	repo := ref
+	if i := strings.Index(repo, "://"); i >= 0 {
+		repo = repo[i+len("://"):]
+	}
+	if strings.Contains(repo, "//") {
+		return ref + "/" + dir
+	}
+	return ref + "//" + dir
+}
+
+// fetchModule makes the module available in the local filesystem. The source can be
+//
+//   - a local directory, given as a path or a file:// url, checked out from the git
+//     repository holding it if a ref is given
+//   - a local .zip, .tar, .tar.gz or .tgz archive
+//   - an http(s) url of such an archive
+//   - a git repository url, optionally forced with the git:: prefix
+//   - a terraform registry module address, e.g. terraform-aws-modules/vpc/aws, at the newest
+//     version matching the version constraint
+//
+// Like terraform, the module can be in a subdirectory of any of these, given as
+// <source>//<subdir>. Git sources also accept the ?ref= and ?depth= query parameters.
+func fetchModule(source string, auth *gitAuth, ref, version string) (*fetchedModule, error) {
+	src, err := parseGetterSource(source)
+	if err != nil {
+		return nil, err
+	}
+	if src.Ref != "" {
+		if ref != "" && ref != src.Ref {
+			return nil, fmt.Errorf("--ref %q contradicts the ref %q given in the module source", ref, src.Ref)
+		}
+		ref = src.Ref
+	}
+
+	return fetchPackage(src, auth, ref, version)
+}
+
+// fetchPackage fetches the package, i.e. the repository, archive or directory, holding the
+// module and moves into the subdirectory of the module
+func fetchPackage(src *getterSource, auth *gitAuth, ref, version string) (*fetchedModule, error) {
+	if src.Getter == "" {
+		if _, err := os.Stat(src.Address); err != nil {
+			if m, ok := parseRegistryModule(src.Address); ok {
+				return fetchRegistryModule(newRegistryClient(http.DefaultClient, "https"), m, src.Subdir, auth, ref, version)
+			}
+		}
+	}
+	if version != "" {
+		return nil, fmt.Errorf("--version is only supported for terraform registry sources")
+	}
+	if src.Getter == gitGetter || isSSHGitURL(src.Address) {
+		return fetchGitModule(src.Address, src.Subdir, auth, ref, src.Depth)
+	}
+	if src.Depth > 0 {
+		return nil, fmt.Errorf("depth is only supported for git sources")
+	}
+
+	u, err := url.Parse(src.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *fetchedModule
+	switch {
+	case u.Scheme == "file" && ref != "":
+		return fetchLocalGitModule(u.Path, src.Subdir, ref)
+	case u.Scheme == "file":
+		m, err = fetchLocalModule(u.Path)
+	case (u.Scheme == "http" || u.Scheme == "https") && archiveType(u.Path) != "":
+		m, err = fetchHTTPArchive(http.DefaultClient, u, auth, ref)
+	case u.Scheme == "" && fileExists(src.Address) && ref != "":
+		return fetchLocalGitModule(src.Address, src.Subdir, ref)
+	case u.Scheme == "" && fileExists(src.Address):
+		m, err = fetchLocalModule(src.Address)
+	case u.Scheme == "" && (filepath.IsAbs(src.Address) || strings.HasPrefix(src.Address, "./") || strings.HasPrefix(src.Address, "../")):
+		return nil, fmt.Errorf("local module %s does not exist", src.Address)
+	default:
+		return fetchGitModule(src.Address, src.Subdir, auth, ref, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.subdir(src.Subdir); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// fetchRegistryModule resolves the module address to its package through the registry and
+// fetches the package using the auth given for the module source
+func fetchRegistryModule(c *registryClient, m *registryModule, subdir string, auth *gitAuth, ref, version string) (*fetchedModule, error) {
+	if ref != "" {
+		return nil, fmt.Errorf("ref is not supported for terraform registry sources, use --version instead")
+	}
+
+	location, selected, err := c.resolve(m, version)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("using version %s of module %s", selected, m)
+
+	// the registry hands out go-getter sources, e.g. git::https://github.com/org/repo?ref=v1.0.0
+	src, err := parseGetterSource(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download location of module %s: %v", m, err)
+	}
+	if _, ok := parseRegistryModule(src.Address); ok {
+		return nil, fmt.Errorf("invalid download location %q of module %s", location, m)
+	}
+	if subdir != "" {
+		src.Subdir = path.Join(src.Subdir, subdir)
+	}
+
+	return fetchPackage(src, auth, src.Ref, "")
+}
+
+// fetchLocalModule uses the files of the local directory as they are, or extracts the local
+// archive
+func fetchLocalModule(src string) (*fetchedModule, error) {
+	src, err := filepath.Abs(src)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		typ := archiveType(src)
+		if typ == "" {
+			return nil, fmt.Errorf("%s is neither a directory nor a supported archive (%s, %s, %s, %s)", src, archiveZip, archiveTar, archiveTarGz, archiveTgz)
+		}
+		return extractModuleArchive(src, typ)
+	}
+
+	return &fetchedModule{
+		Dir:    src,
+		GitRef: localGitOrigin(src),
+	}, nil
+}
+
+// fetchLocalGitModule checks the module out of the git repository holding the local directory
+// through the module cache, like a remote repository, so that the module is the one at the
+// ref rather than the files of the work tree. The module is recorded by the origin of the
+// repository, if any, as the module operator can't reach the local path.
+func fetchLocalGitModule(dir, subdir, ref string) (*fetchedModule, error) {
+	root, rel, ok := localGitRepo(dir)
+	if !ok {
+		return nil, fmt.Errorf("ref is only supported for git sources, %s is not a directory of a git repository", dir)
+	}
+	subdir = path.Join(rel, subdir)
+
+	cache, err := openModuleCache()
+	if err != nil {
+		return nil, err
+	}
+
+	src := "file://" + filepath.ToSlash(root)
+	m, err := cache.checkout(src, src, ref, subdir, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	m.GitRef = localGitOrigin(root)
+	if m.GitRef != "" && subdir != "" {
+		m.GitRef = subdirRef(m.GitRef, subdir)
+	}
+
+	return m, nil
+}
+
+// localGitRepo returns the root of the git repository holding the local directory, i.e. its
+// work tree or the bare repository, and the slash separated path of the directory in it
+func localGitRepo(dir string) (string, string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", "", false
+	}
+
+	for root := dir; ; {
+		if isGitDir(filepath.Join(root, git.GitDirName)) || isGitDir(root) {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", "", false
+			}
+			if rel == "." {
+				rel = ""
+			}
+			return root, filepath.ToSlash(rel), true
+		}
+
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", "", false
+		}
+		root = parent
+	}
+}
+
+// localGitPath returns the path of the git source if it is a local repository, given as a
+// file url or a path
+func localGitPath(source string) (string, bool) {
+	if u, err := url.Parse(source); err == nil && u.Scheme == "file" {
+		return u.Path, true
+	}
+	if filepath.IsAbs(source) || strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+		return source, true
+	}
+	return "", false
+}
+
+func fetchHTTPArchive(client *http.Client, u *url.URL, auth *gitAuth, ref string) (*fetchedModule, error) {
+	if ref != "" {
+		return nil, fmt.Errorf("ref is only supported for git sources, %s is an archive", u.Redacted())
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := auth.archiveToken(u); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", u.Redacted(), resp.Status)
+	}
+	if resp.ContentLength > maxArchiveSize {
+		return nil, fmt.Errorf("archive %s is larger than %d bytes", u.Redacted(), maxArchiveSize)
+	}
+
+	file, err := os.CreateTemp("", "kf-module-*"+archiveType(u.Path))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	err = copyLimited(file, resp.Body, maxArchiveSize)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", u.Redacted(), err)
+	}
+
+	return extractModuleArchive(file.Name(), archiveType(u.Path))
+}
+
+func fetchGitModule(source, subdir string, auth *gitAuth, ref string, depth int) (*fetchedModule, error) {
+	if dir, ok := localGitPath(source); ok {
+		return fetchLocalGitModule(dir, subdir, ref)
+	}
+
+	var src, gitRef string
+	if isSSHGitURL(source) {
+		src = source
+		gitRef = normalizeGitURL(source)
+	} else {
+		modifiedUrl, err := url.Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		gitRef = modifiedUrl.Host + strings.TrimSuffix(modifiedUrl.Path, ".git")
+		src = auth.cloneURL(gitRef)
+	}
+
+	// the path may hold any number of parent groups, e.g. gitlab.com/group/subgroup/repo
+	if host, repoPath := splitGitRepo(gitRef); host == "" || strings.Trim(repoPath, "/") == "" {
+		return nil, fmt.Errorf("given git repo source link %s is invalid", source)
+	}
+
+	transportAuth, err := auth.transportAuth(gitRef, src)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := openModuleCache()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := cache.checkout(gitRef, src, ref, subdir, depth, transportAuth)
+	if err != nil {
+		return nil, err
+	}
+	m.SSH = isSSHGitURL(src)
+
+	return m, nil
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func archiveType(name string) string {
+	name = strings.ToLower(name)
+	for _, typ := range []string{archiveTarGz, archiveTgz, archiveTar, archiveZip} {
+		if strings.HasSuffix(name, typ) {
+			return typ
+		}
+	}
+
+	return ""
+}
+
+// extractModuleArchive extracts the archive into a temporary directory, which is removed
+// when the fetched module is closed
+func extractModuleArchive(filename, typ string) (*fetchedModule, error) {
+	dir, err := os.MkdirTemp("", "kf-module-")
+	if err != nil {
+		return nil, err
+	}
+	m := &fetchedModule{
+		Dir: dir,
+		cleanup: func() {
+			_ = os.RemoveAll(dir)
+		},
+	}
+
+	if typ == archiveZip {
+		err = extractZip(filename, dir, maxExtractedSize)
+	} else {
+		err = extractTar(filename, dir, typ != archiveTar, maxExtractedSize)
+	}
+	if err != nil {
+		m.Close()
+		return nil, fmt.Errorf("failed to extract %s: %v", filename, err)
+	}
+
+	// archives created from a directory, e.g. the tarballs of the git hosts, hold a single top
+	// level directory with the module in it
+	if !tfconfig.IsModuleDir(dir) {
+		entries, err := os.ReadDir(dir)
+		if err == nil && len(entries) == 1 && entries[0].IsDir() {
+			m.Dir = filepath.Join(dir, entries[0].Name())
+		}
+	}
+
+	return m, nil
+}
+
+// archivePath returns the path where an archive entry is extracted, rejecting entries
+// that would end up outside the destination
+func archivePath(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(path.Clean("/"+name)))
+	if rel, err := filepath.Rel(dest, target); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("illegal file path in archive: %s", name)
+	}
+
+	return target, nil
+}
+
+// extractZip extracts the zip archive into dest, failing once the extracted files exceed limit bytes
+func extractZip(filename, dest string, limit int64) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	remaining := limit
+	for _, f := range r.File {
+		target, err := archivePath(dest, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		n, err := writeArchiveFile(target, io.LimitReader(rc, remaining+1))
+		remaining -= n
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if remaining < 0 {
+			return fmt.Errorf("extracted files are larger than %d bytes", limit)
+		}
+	}
+
+	return nil
+}
+
+// extractTar extracts the tar archive into dest, failing once the extracted files exceed limit bytes
+func extractTar(filename, dest string, gzipped bool, limit int64) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	remaining := limit
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := archivePath(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			n, err := writeArchiveFile(target, io.LimitReader(tr, remaining+1))
+			remaining -= n
+			if err != nil {
+				return err
+			}
+			if remaining < 0 {
+				return fmt.Errorf("extracted files are larger than %d bytes", limit)
+			}
+		}
+	}
+}
+
+// writeArchiveFile writes the archive entry to target and returns the number of bytes written
+func writeArchiveFile(target string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return n, err
+}
+
+// copyLimited copies src to dst, failing if src holds more than limit bytes
+func copyLimited(dst io.Writer, src io.Reader, limit int64) error {
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return err
+	}
+	if n > limit {
+		return fmt.Errorf("larger than %d bytes", limit)
+	}
+
+	return nil
+}
+
+// localGitOrigin returns the moduleRef of a module located in a local git checkout,
+// i.e. the url of its origin remote and the subdirectory of the module, if any
+func localGitOrigin(dir string) string {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	origin := normalizeGitURL(remote.Config().URLs[0])
+	if origin == "" {
+		return ""
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return ""
+	}
+	root, err := filepath.EvalSymlinks(wt.Filesystem.Root())
+	if err != nil {
+		return ""
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return ""
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return ""
+	}
+	subdir, err := filepath.Rel(root, dir)
+	if err != nil || strings.HasPrefix(subdir, "..") {
+		return ""
+	}
+	if subdir != "." {
+		return origin + "//" + filepath.ToSlash(subdir)
+	}
+
+	return origin
+}
+
+// normalizeGitURL converts a git remote url into the host/path form recorded in the moduleRef,
+// e.g. both https://github.com/org/repo.git and git@github.com:org/repo.git become github.com/org/repo
+func normalizeGitURL(remote string) string {
+	remote = strings.TrimSuffix(remote, ".git")
+
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		return u.Host + u.Path
+	}
+
+	// scp like syntax, user@host:path
+	if i := strings.Index(remote, ":"); i > 0 && !strings.Contains(remote[:i], "/") {
+		host := remote[:i]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+		return host + "/" + strings.TrimPrefix(remote[i+1:], "/")
+	}
+
+	return ""
+}
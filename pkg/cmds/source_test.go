@@ -0,0 +1,411 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+const sourceTestModule = `
+variable "name" {
+  type = string
+}
+`
+
+func TestArchivePath(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+		err  bool
+	}{
+		{name: "main.tf", want: "main.tf"},
+		{name: "modules/vpc/main.tf", want: "modules/vpc/main.tf"},
+		{name: "./a/../b.tf", want: "b.tf"},
+		{name: "/etc/passwd", want: "etc/passwd"},
+		{name: "../evil.tf", want: "evil.tf"},
+		{name: "a/../../evil.tf", want: "evil.tf"},
+	}
+
+	dest := t.TempDir()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := archivePath(dest, c.name)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dest, filepath.FromSlash(c.want)); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveStaysInDestination(t *testing.T) {
+	dir := t.TempDir()
+	entries := map[string]string{
+		"module/main.tf":          sourceTestModule,
+		"module/../../escaped.tf": "escaped",
+		"/abs.tf":                 "abs",
+	}
+
+	for _, typ := range []string{archiveZip, archiveTarGz, archiveTar} {
+		t.Run(typ, func(t *testing.T) {
+			filename := filepath.Join(dir, "module"+typ)
+			writeArchive(t, filename, typ, entries)
+
+			m, err := extractModuleArchive(filename, typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			// more than one top level entry, the module directory is the destination itself
+			root := m.Dir
+			if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escaped.tf")); err == nil {
+				t.Fatal("archive entry was extracted outside of the destination")
+			}
+			for _, name := range []string{"escaped.tf", "abs.tf", "module/main.tf"} {
+				if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+					t.Errorf("%s is not extracted in the destination: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchLocalModule(t *testing.T) {
+	moduleDir := writeModule(t, map[string]string{
+		"main.tf":             sourceTestModule,
+		"modules/vpc/main.tf": sourceTestModule,
+	})
+
+	archives := t.TempDir()
+	for _, typ := range []string{archiveZip, archiveTgz} {
+		writeArchive(t, filepath.Join(archives, "module"+typ), typ, map[string]string{
+			"repo-1.0.0/main.tf":             sourceTestModule,
+			"repo-1.0.0/modules/vpc/main.tf": sourceTestModule,
+		})
+	}
+
+	cases := []struct {
+		name   string
+		source string
+		ref    string
+		subdir string
+		err    bool
+	}{
+		{name: "directory", source: moduleDir},
+		{name: "file url", source: "file://" + moduleDir},
+		{name: "subdirectory", source: moduleDir + "//modules/vpc", subdir: "modules/vpc"},
+		{name: "zip archive", source: filepath.Join(archives, "module.zip")},
+		{name: "tgz archive in subdirectory", source: filepath.Join(archives, "module.tgz") + "//modules/vpc", subdir: "modules/vpc"},
+		{name: "missing directory", source: filepath.Join(moduleDir, "missing") + "/", err: true},
+		{name: "missing subdirectory", source: moduleDir + "//modules/db", err: true},
+		{name: "subdirectory outside", source: moduleDir + "//../x", err: true},
+		{name: "ref of a directory", source: moduleDir, ref: "v1", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := fetchModule(c.source, &gitAuth{}, c.ref, "")
+			if c.err {
+				if err == nil {
+					m.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			if _, err := os.Stat(filepath.Join(m.Dir, "main.tf")); err != nil {
+				t.Errorf("module is not found in %s: %v", m.Dir, err)
+			}
+			if c.subdir != "" && filepath.Base(m.Dir) != filepath.Base(c.subdir) {
+				t.Errorf("module directory %s is not the subdirectory %s", m.Dir, c.subdir)
+			}
+			if m.GitRef != "" {
+				t.Errorf("module without git origin has the git ref %s", m.GitRef)
+			}
+		})
+	}
+}
+
+func TestFetchLocalGitModule(t *testing.T) {
+	t.Setenv(CacheDirEnv, t.TempDir())
+
+	repoDir, commits := testGitRepo(t)
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{"https://github.com/org/modules.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	// the work tree differs from every commit
+	if err := os.WriteFile(filepath.Join(repoDir, "main.tf"), []byte(`variable "dirty" {}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		source   string
+		ref      string
+		git      bool
+		checkOut string
+		tag      string
+		gitRef   string
+		file     string
+		content  string
+		err      bool
+	}{
+		{
+			name:     "git file url",
+			source:   "git::file://" + repoDir,
+			git:      true,
+			checkOut: commits["v2"],
+			gitRef:   "github.com/org/modules",
+			file:     "main.tf",
+			content:  `variable "v2" {}`,
+		},
+		{
+			name:     "git path with subdirectory and ref",
+			source:   "git::" + repoDir + "//modules/vpc?ref=feature",
+			git:      true,
+			checkOut: commits["feature"],
+			gitRef:   "github.com/org/modules//modules/vpc",
+			file:     "main.tf",
+			content:  `variable "vpc" {}`,
+		},
+		{
+			name:     "file url with commit",
+			source:   "file://" + repoDir + "?ref=" + commits["v1"],
+			git:      true,
+			checkOut: commits["v1"],
+			gitRef:   "github.com/org/modules",
+			file:     "main.tf",
+			content:  `variable "v1" {}`,
+		},
+		{
+			name:     "path with tag",
+			source:   repoDir,
+			ref:      "v2.0.0",
+			git:      true,
+			checkOut: commits["v2"],
+			tag:      commits["v2.0.0"],
+			gitRef:   "github.com/org/modules",
+			file:     "main.tf",
+			content:  `variable "v2" {}`,
+		},
+		{
+			name:     "path of a directory in the repository",
+			source:   filepath.Join(repoDir, "modules", "db"),
+			ref:      commits["v1"],
+			git:      true,
+			checkOut: commits["v1"],
+			gitRef:   "github.com/org/modules//modules/db",
+			file:     "main.tf",
+			content:  `variable "db" {}`,
+		},
+		{
+			name:    "work tree without ref",
+			source:  "file://" + repoDir,
+			gitRef:  "github.com/org/modules",
+			file:    "main.tf",
+			content: `variable "dirty" {}`,
+		},
+		{name: "missing ref", source: "git::file://" + repoDir + "?ref=v3", err: true},
+		{name: "ref of a directory outside of git", source: t.TempDir(), ref: "v1", err: true},
+		{name: "git path outside of git", source: "git::" + t.TempDir(), err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := fetchModule(c.source, &gitAuth{}, c.ref, "")
+			if c.err {
+				if err == nil {
+					m.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			if m.Git != c.git || m.CheckOut != c.checkOut || m.Tag != c.tag || m.GitRef != c.gitRef {
+				t.Errorf("expected git %v, commit %q, tag %q and git ref %q, got %v, %q, %q and %q", c.git, c.checkOut, c.tag, c.gitRef, m.Git, m.CheckOut, m.Tag, m.GitRef)
+			}
+			data, err := os.ReadFile(filepath.Join(m.Dir, c.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != c.content {
+				t.Errorf("expected %s to hold %q, got %q", c.file, c.content, data)
+			}
+		})
+	}
+}
+
+func TestFetchHTTPArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "module.tar.gz")
+	writeArchive(t, archive, archiveTarGz, map[string]string{
+		"main.tf": sourceTestModule,
+	})
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/module.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &gitAuth{Token: "secret", HostTypes: map[string]string{u.Host: GitHostGeneric}}
+
+	m, err := fetchHTTPArchive(server.Client(), u, auth, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := os.Stat(filepath.Join(m.Dir, "main.tf")); err != nil {
+		t.Error(err)
+	}
+
+	// the token is only sent to the configured git hosts
+	if _, err := fetchHTTPArchive(server.Client(), u, &gitAuth{Token: "secret"}, ""); err == nil {
+		t.Error("expected an error for the download without the token")
+	}
+}
+
+func TestExtractArchiveSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	entries := map[string]string{
+		"main.tf":      sourceTestModule,
+		"variables.tf": sourceTestModule,
+	}
+
+	for _, typ := range []string{archiveZip, archiveTarGz} {
+		t.Run(typ, func(t *testing.T) {
+			filename := filepath.Join(dir, "module"+typ)
+			writeArchive(t, filename, typ, entries)
+
+			extract := func(limit int64) error {
+				dest := t.TempDir()
+				if typ == archiveZip {
+					return extractZip(filename, dest, limit)
+				}
+				return extractTar(filename, dest, true, limit)
+			}
+
+			if err := extract(int64(2 * len(sourceTestModule))); err != nil {
+				t.Errorf("archive within the limit: %v", err)
+			}
+			if err := extract(int64(2*len(sourceTestModule) - 1)); err == nil {
+				t.Error("expected an error for the archive over the limit")
+			}
+		})
+	}
+}
+
+// writeArchive writes the entries into an archive of the type, the names are kept as given
+func writeArchive(t *testing.T, filename, typ string, entries map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	switch typ {
+	case archiveZip:
+		w := zip.NewWriter(&buf)
+		for name, content := range entries {
+			f, err := w.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		var gz *gzip.Writer
+		var tw *tar.Writer
+		if typ == archiveTar {
+			tw = tar.NewWriter(&buf)
+		} else {
+			gz = gzip.NewWriter(&buf)
+			tw = tar.NewWriter(gz)
+		}
+		for name, content := range entries {
+			hdr := &tar.Header{
+				Name:     name,
+				Mode:     0o644,
+				Size:     int64(len(content)),
+				Typeflag: tar.TypeReg,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if gz != nil {
+			if err := gz.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+)
+
+var (
+	overrideBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type:       "variable",
+				LabelNames: []string{"name"},
+			},
+			{
+				Type:       "output",
+				LabelNames: []string{"name"},
+			},
+		},
+	}
+	variableAttrSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "type"},
+			{Name: "default"},
+			{Name: "description"},
+			{Name: "sensitive"},
+		},
+	}
+	outputAttrSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "description"},
+			{Name: "sensitive"},
+		},
+	}
+)
+
+// loadModule loads the module with tfconfig. tfconfig replaces a variable or an output of the
+// primary files with the block of an override file as a whole, while terraform merges them
+// attribute by attribute, so the overridden variables and outputs are merged here the same way.
+func loadModule(dir string) (*tfconfig.Module, error) {
+	module, diags := tfconfig.LoadModule(dir)
+	if diags.HasErrors() {
+		return nil, diags.Err()
+	}
+
+	primary, overrides, err := moduleFileNames(dir)
+	if err != nil || len(overrides) == 0 {
+		return module, err
+	}
+
+	merged, diags := tfconfig.LoadModuleFromFilesystem(&moduleFilesFS{FS: tfconfig.NewOsFs(), names: primary}, dir)
+	if diags.HasErrors() {
+		return nil, diags.Err()
+	}
+
+	parser := hclparse.NewParser()
+	for _, name := range overrides {
+		override, diags := tfconfig.LoadModuleFromFilesystem(&moduleFilesFS{FS: tfconfig.NewOsFs(), names: []string{name}}, dir)
+		if diags.HasErrors() {
+			return nil, diags.Err()
+		}
+		file, err := parseConfigFile(parser, filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		content, _, hclDiags := file.Body.PartialContent(overrideBlockSchema)
+		if hclDiags.HasErrors() {
+			return nil, hclDiags
+		}
+		for _, block := range content.Blocks {
+			name := block.Labels[0]
+			switch block.Type {
+			case "variable":
+				attrs, _, hclDiags := block.Body.PartialContent(variableAttrSchema)
+				if hclDiags.HasErrors() {
+					return nil, hclDiags
+				}
+				mergeVariable(merged, override.Variables[name], attrs.Attributes)
+			case "output":
+				attrs, _, hclDiags := block.Body.PartialContent(outputAttrSchema)
+				if hclDiags.HasErrors() {
+					return nil, hclDiags
+				}
+				mergeOutput(merged, override.Outputs[name], attrs.Attributes)
+			}
+		}
+	}
+
+	module.Variables, module.Outputs = merged.Variables, merged.Outputs
+	return module, nil
+}
+
+func mergeVariable(module *tfconfig.Module, override *tfconfig.Variable, attrs hcl.Attributes) {
+	original, found := module.Variables[override.Name]
+	if !found {
+		module.Variables[override.Name] = override
+		return
+	}
+
+	v := *original
+	if _, found := attrs["type"]; found {
+		v.Type = override.Type
+	}
+	if _, found := attrs["default"]; found {
+		v.Default = override.Default
+		v.Required = false
+	}
+	if _, found := attrs["description"]; found {
+		v.Description = override.Description
+	}
+	if _, found := attrs["sensitive"]; found {
+		v.Sensitive = override.Sensitive
+	}
+	module.Variables[override.Name] = &v
+}
+
+func mergeOutput(module *tfconfig.Module, override *tfconfig.Output, attrs hcl.Attributes) {
+	original, found := module.Outputs[override.Name]
+	if !found {
+		module.Outputs[override.Name] = override
+		return
+	}
+
+	o := *original
+	if _, found := attrs["description"]; found {
+		o.Description = override.Description
+	}
+	if _, found := attrs["sensitive"]; found {
+		o.Sensitive = override.Sensitive
+	}
+	module.Outputs[override.Name] = &o
+}
+
+// moduleFilesFS lists only the given files of the module directory, for loading a part of the
+// module with tfconfig
+type moduleFilesFS struct {
+	tfconfig.FS
+	names []string
+}
+
+func (fs *moduleFilesFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	infos, err := fs.FS.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []os.FileInfo
+	for _, info := range infos {
+		if contains(fs.names, info.Name()) {
+			out = append(out, info)
+		}
+	}
+	return out, nil
+}
+
+// parseModuleFiles parses the configuration files of the module directory, in the native (.tf)
+// and the json (.tf.json) syntax. The override files come last, so their definitions replace the
+// ones of the primary files like they do in terraform. tfconfig only reports a summary of the
+// module, this gives access to the expressions it leaves out.
+func parseModuleFiles(dir string) ([]*hcl.File, error) {
+	primary, overrides, err := moduleFileNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := hclparse.NewParser()
+	files := make([]*hcl.File, 0, len(primary)+len(overrides))
+
+	for _, name := range append(primary, overrides...) {
+		file, err := parseConfigFile(parser, filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// moduleFileNames returns the names of the primary and the override configuration files of the
+// module directory
+func moduleFileNames(dir string) ([]string, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var primary, overrides []string
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := configFileExt(name)
+		if entry.IsDir() || ext == "" || isIgnoredFile(name) {
+			continue
+		}
+
+		base := strings.TrimSuffix(name, ext)
+		if base == "override" || strings.HasSuffix(base, "_override") {
+			overrides = append(overrides, name)
+		} else {
+			primary = append(primary, name)
+		}
+	}
+
+	return primary, overrides, nil
+}
+
+func parseConfigFile(parser *hclparse.Parser, filename string) (*hcl.File, error) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if configFileExt(filename) == ".tf.json" {
+		file, diags = parser.ParseJSONFile(filename)
+	} else {
+		file, diags = parser.ParseHCLFile(filename)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return file, nil
+}
+
+func configFileExt(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".tf"):
+		return ".tf"
+	case strings.HasSuffix(name, ".tf.json"):
+		return ".tf.json"
+	}
+	return ""
+}
+
+// isIgnoredFile checks for the hidden and the editor backup files terraform ignores
+func isIgnoredFile(name string) bool {
+	return strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, "~") ||
+		(strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#"))
+}
+
+// syntaxExpr returns the native syntax form of an expression of the file. The expressions of the
+// json files are parsed from their source the way terraform interprets them, a string as a
+// template and anything else as a literal value.
+func syntaxExpr(file *hcl.File, expr hcl.Expression) (hclsyntax.Expression, bool) {
+	if e, ok := expr.(hclsyntax.Expression); ok {
+		return e, true
+	}
+
+	rng := expr.Range()
+	if rng.Start.Byte < 0 || rng.End.Byte > len(file.Bytes) || rng.Start.Byte > rng.End.Byte {
+		return nil, false
+	}
+	src := file.Bytes[rng.Start.Byte:rng.End.Byte]
+
+	var s string
+	if err := json.Unmarshal(src, &s); err == nil {
+		tmpl, diags := hclsyntax.ParseTemplate([]byte(s), rng.Filename, rng.Start)
+		if diags.HasErrors() {
+			return nil, false
+		}
+		if wrap, ok := tmpl.(*hclsyntax.TemplateWrapExpr); ok {
+			return wrap.Wrapped, true
+		}
+		return tmpl, true
+	}
+
+	e, diags := hclsyntax.ParseExpression(src, rng.Filename, rng.Start)
+	if diags.HasErrors() {
+		return nil, false
+	}
+	return e, true
+}
@@ -0,0 +1,264 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+const (
+	Any    = "any"
+	List   = "list"
+	Set    = "set"
+	Map    = "map"
+	Object = "object"
+	Tuple  = "tuple"
+
+	Optional = "optional"
+)
+
+// parseTypeExpr converts a terraform type constraint into the equivalent json schema.
+// The type is expected in the raw source form reported by tfconfig, e.g.
+// `list(object({ name = string, port = optional(number, 80) }))`.
+func parseTypeExpr(typ string) (*v1.JSONSchemaProps, error) {
+	if typ == "" {
+		return anySchema(), nil
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(typ), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return typeExprSchema(expr)
+}
+
+func typeExprSchema(expr hcl.Expression) (*v1.JSONSchemaProps, error) {
+	// primitive types and the legacy bare collection keywords (`list`, `map`, `set`)
+	switch kw := hcl.ExprAsKeyword(expr); kw {
+	case "":
+	case String:
+		return &v1.JSONSchemaProps{Type: String}, nil
+	case Number:
+		return &v1.JSONSchemaProps{Type: Number}, nil
+	case Bool:
+		return &v1.JSONSchemaProps{Type: "boolean"}, nil
+	case Any:
+		return anySchema(), nil
+	case List, Set:
+		return &v1.JSONSchemaProps{
+			Type: "array",
+			Items: &v1.JSONSchemaPropsOrArray{
+				Schema: anySchema(),
+			},
+		}, nil
+	case Map:
+		return &v1.JSONSchemaProps{
+			Type: "object",
+			AdditionalProperties: &v1.JSONSchemaPropsOrBool{
+				Allows: true,
+				Schema: anySchema(),
+			},
+		}, nil
+	case Object, Tuple:
+		return nil, fmt.Errorf("the %s type constructor requires one argument specifying the element types", kw)
+	default:
+		return nil, fmt.Errorf("the keyword %q is not a valid type specification", kw)
+	}
+
+	call, diags := hcl.ExprCall(expr)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("a type specification is either a primitive type keyword (bool, number, string) or a complex type constructor call, like list(string)")
+	}
+
+	switch call.Name {
+	case Optional:
+		return nil, fmt.Errorf("optional modifier is only allowed for the attributes of an object type")
+	case List, Set, Map, Object, Tuple:
+		if len(call.Arguments) != 1 {
+			return nil, fmt.Errorf("the %s type constructor requires one argument specifying the element type", call.Name)
+		}
+	default:
+		return nil, fmt.Errorf("keyword %q is not a valid type constructor", call.Name)
+	}
+
+	arg := call.Arguments[0]
+
+	switch call.Name {
+	case List, Set:
+		elem, err := typeExprSchema(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		return &v1.JSONSchemaProps{
+			Type: "array",
+			Items: &v1.JSONSchemaPropsOrArray{
+				Schema: elem,
+			},
+		}, nil
+	case Map:
+		elem, err := typeExprSchema(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		return &v1.JSONSchemaProps{
+			Type: "object",
+			AdditionalProperties: &v1.JSONSchemaPropsOrBool{
+				Allows: true,
+				Schema: elem,
+			},
+		}, nil
+	case Tuple:
+		elemExprs, diags := hcl.ExprList(arg)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("tuple type constructor requires a list of element types")
+		}
+
+		elems := make([]*v1.JSONSchemaProps, 0, len(elemExprs))
+		for _, elemExpr := range elemExprs {
+			elem, err := typeExprSchema(elemExpr)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+
+		size := int64(len(elems))
+		return &v1.JSONSchemaProps{
+			Type: "array",
+			Items: &v1.JSONSchemaPropsOrArray{
+				Schema: tupleItemSchema(elems),
+			},
+			MinItems: &size,
+			MaxItems: &size,
+		}, nil
+	}
+
+	// object type
+	attrs, diags := hcl.ExprMap(arg)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("object type constructor requires a map whose keys are attribute names and whose values are the corresponding attribute types")
+	}
+
+	props := make(map[string]v1.JSONSchemaProps, len(attrs))
+	var required []string
+
+	for _, attr := range attrs {
+		key, diags := attr.Key.Value(nil)
+		if diags.HasErrors() || key.Type() != cty.String || key.IsNull() {
+			return nil, fmt.Errorf("object constructor map keys must be attribute names")
+		}
+		name := key.AsString()
+
+		prop, isOptional, err := objectAttrSchema(attr.Value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %v", name, err)
+		}
+
+		props[name] = *prop
+		if !isOptional {
+			required = append(required, name)
+		}
+	}
+
+	sort.Strings(required)
+
+	return &v1.JSONSchemaProps{
+		Type:       "object",
+		Properties: props,
+		Required:   required,
+	}, nil
+}
+
+// objectAttrSchema handles the type of a single object attribute, which, unlike
+// every other type position, may be wrapped in optional(type[, default]).
+func objectAttrSchema(expr hcl.Expression) (*v1.JSONSchemaProps, bool, error) {
+	call, diags := hcl.ExprCall(expr)
+	if diags.HasErrors() || call.Name != Optional {
+		prop, err := typeExprSchema(expr)
+		return prop, false, err
+	}
+
+	if len(call.Arguments) == 0 || len(call.Arguments) > 2 {
+		return nil, false, fmt.Errorf("optional modifier requires the attribute type and optionally a default value")
+	}
+
+	prop, err := typeExprSchema(call.Arguments[0])
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(call.Arguments) == 2 {
+		val, diags := call.Arguments[1].Value(nil)
+		if diags.HasErrors() {
+			return nil, false, fmt.Errorf("default value of an optional attribute must be a constant: %v", diags.Error())
+		}
+
+		if !val.IsNull() {
+			raw, err := ctyjson.Marshal(val, val.Type())
+			if err != nil {
+				return nil, false, err
+			}
+
+			var def interface{}
+			if err = json.Unmarshal(raw, &def); err != nil {
+				return nil, false, err
+			}
+
+			prop.Default, err = defaultJSON(prop, def)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid default value for optional attribute: %v", err)
+			}
+		}
+	}
+
+	return prop, true, nil
+}
+
+// anySchema accepts a value of any type. Structural schemas can't list the accepted types in an
+// anyOf, so the value is preserved as is.
+func anySchema() *v1.JSONSchemaProps {
+	preserve := true
+	return &v1.JSONSchemaProps{
+		XPreserveUnknownFields: &preserve,
+	}
+}
+
+// tupleItemSchema returns the single items schema of a tuple. Structural schemas don't support
+// a schema per position, so the element type is kept only when every element has the same type.
+func tupleItemSchema(elems []*v1.JSONSchemaProps) *v1.JSONSchemaProps {
+	if len(elems) == 0 {
+		return anySchema()
+	}
+	for _, elem := range elems[1:] {
+		if !reflect.DeepEqual(elem, elems[0]) {
+			return anySchema()
+		}
+	}
+	return elems[0]
+}
@@ -0,0 +1,179 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+)
+
+func TestParseTypeExpr(t *testing.T) {
+	cases := []struct {
+		typ    string
+		schema string
+		err    bool
+	}{
+		{typ: "string", schema: `type: string`},
+		{typ: "number", schema: `type: number`},
+		{typ: "bool", schema: `type: boolean`},
+		{typ: "", schema: `x-kubernetes-preserve-unknown-fields: true`},
+		{typ: "any", schema: `x-kubernetes-preserve-unknown-fields: true`},
+		{
+			typ: "list(any)",
+			schema: `
+type: array
+items:
+  x-kubernetes-preserve-unknown-fields: true`,
+		},
+		{
+			typ: "map(list(string))",
+			schema: `
+type: object
+additionalProperties:
+  type: array
+  items:
+    type: string`,
+		},
+		{
+			typ: "set(number)",
+			schema: `
+type: array
+items:
+  type: number`,
+		},
+		{
+			typ: "tuple([string, string])",
+			schema: `
+type: array
+items:
+  type: string
+minItems: 2
+maxItems: 2`,
+		},
+		{
+			typ: "tuple([string, number, bool])",
+			schema: `
+type: array
+items:
+  x-kubernetes-preserve-unknown-fields: true
+minItems: 3
+maxItems: 3`,
+		},
+		{
+			typ: `list(object({ name = string, port = optional(number, 80), tags = optional(map(string)) }))`,
+			schema: `
+type: array
+items:
+  type: object
+  required: [name]
+  properties:
+    name:
+      type: string
+    port:
+      type: number
+      default: 80
+    tags:
+      type: object
+      additionalProperties:
+        type: string`,
+		},
+		{
+			typ: `object({ size = optional(string, 10) })`,
+			schema: `
+type: object
+properties:
+  size:
+    type: string
+    default: "10"`,
+		},
+		{typ: "list", schema: "type: array\nitems:\n  x-kubernetes-preserve-unknown-fields: true"},
+		{typ: "optional(string)", err: true},
+		{typ: "object", err: true},
+		{typ: "list(string, number)", err: true},
+		{typ: "foo", err: true},
+		{typ: "foo(string)", err: true},
+		{typ: "object({ a = optional(string, [1]) })", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.typ, func(t *testing.T) {
+			prop, err := parseTypeExpr(c.typ)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", prop)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertSchema(t, prop, c.schema)
+			assertStructural(t, prop)
+		})
+	}
+}
+
+// assertSchema compares the schema with the expected one given in yaml
+func assertSchema(t *testing.T, prop *v1.JSONSchemaProps, expected string) {
+	t.Helper()
+
+	var want, got interface{}
+	if err := yaml.Unmarshal([]byte(expected), &want); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(prop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		out, _ := yaml.Marshal(got)
+		t.Errorf("unexpected schema, got\n%s", out)
+	}
+}
+
+// assertStructural checks that the schema can be used for a property of a custom resource
+func assertStructural(t *testing.T, prop *v1.JSONSchemaProps) {
+	t.Helper()
+
+	root := &v1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]v1.JSONSchemaProps{
+			"value": *prop,
+		},
+	}
+	internal := &apiextensions.JSONSchemaProps{}
+	if err := v1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(root, internal, nil); err != nil {
+		t.Fatal(err)
+	}
+	s, err := structuralschema.NewStructural(internal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := structuralschema.ValidateStructural(nil, s); len(errs) > 0 {
+		t.Errorf("schema is not structural: %v", errs.ToAggregate())
+	}
+}
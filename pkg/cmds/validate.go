@@ -0,0 +1,309 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"kubeform.dev/module/api/v1alpha1"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+type ValidateOptions struct {
+	FilenameOptions resource.FilenameOptions
+	ModuleDefs      []string
+
+	NewBuilder func() *resource.Builder
+	// DynamicClient returns the client the Module Definitions missing locally are read with,
+	// it is only called when needed so that no cluster access is required otherwise
+	DynamicClient func() (dynamic.Interface, error)
+
+	genericclioptions.IOStreams
+}
+
+func NewCmdValidate(parent string, f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ValidateOptions{IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:               "validate -f FILENAME",
+		Short:             "Validate the inputs of Modules against the schema of their Module Definitions",
+		DisableAutoGenTag: true,
+		Args:              cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmdutil.AddFilenameOptionFlags(cmd, &o.FilenameOptions, "files containing the Modules to validate")
+	cmd.Flags().StringSliceVar(&o.ModuleDefs, "module-def", nil, "files containing the Module Definitions of the Modules, read from the cluster if not given")
+
+	return cmd
+}
+
+func (o *ValidateOptions) Complete(f cmdutil.Factory) error {
+	o.NewBuilder = f.NewBuilder
+	o.DynamicClient = f.DynamicClient
+	return nil
+}
+
+func (o *ValidateOptions) Validate() error {
+	if len(o.FilenameOptions.Filenames) == 0 && o.FilenameOptions.Kustomize == "" {
+		return fmt.Errorf("you must specify the files containing the Modules using -f")
+	}
+	return nil
+}
+
+func (o *ValidateOptions) Run() error {
+	objs, err := loadLocalObjects(o.NewBuilder, o.FilenameOptions)
+	if err != nil {
+		return err
+	}
+
+	defs := map[string]*unstructured.Unstructured{}
+	if len(o.ModuleDefs) > 0 {
+		defObjs, err := loadLocalObjects(o.NewBuilder, resource.FilenameOptions{Filenames: o.ModuleDefs})
+		if err != nil {
+			return err
+		}
+		objs = append(objs, defObjs...)
+	}
+
+	var modules []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GroupVersionKind().Group != v1alpha1.GroupVersion.Group {
+			klog.V(2).Infof("skipping %s %s, it is neither a Module nor a Module Definition", obj.GetKind(), obj.GetName())
+			continue
+		}
+		switch obj.GetKind() {
+		case "ModuleDefinition":
+			defs[obj.GetName()] = obj
+		case "Module":
+			modules = append(modules, obj)
+		}
+	}
+	if len(modules) == 0 {
+		return fmt.Errorf("no Module is found in the given files")
+	}
+
+	invalid := 0
+	for _, m := range modules {
+		name := m.GetName()
+		if ns := m.GetNamespace(); ns != "" {
+			name = ns + "/" + name
+		}
+
+		errs, err := o.validateModule(m, defs)
+		if err != nil {
+			return fmt.Errorf("failed to validate Module %s: %v", name, err)
+		}
+		if len(errs) == 0 {
+			fmt.Fprintf(o.Out, "module %s is valid\n", name)
+			continue
+		}
+
+		invalid++
+		fmt.Fprintf(o.Out, "module %s is invalid:\n", name)
+		for _, e := range errs {
+			fmt.Fprintf(o.Out, "  %s\n", e.Error())
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d Modules are invalid", invalid, len(modules))
+	}
+
+	return nil
+}
+
+// validateModule validates the input of the Module against the schema of its Module Definition,
+// read from the cluster unless it is found in defs
+func (o *ValidateOptions) validateModule(m *unstructured.Unstructured, defs map[string]*unstructured.Unstructured) (field.ErrorList, error) {
+	defName, _, _ := unstructured.NestedString(m.Object, "spec", "moduleDef")
+	if defName == "" {
+		return field.ErrorList{field.Required(field.NewPath("spec", "moduleDef"), "")}, nil
+	}
+
+	def, ok := defs[defName]
+	if !ok {
+		client, err := o.DynamicClient()
+		if err != nil {
+			return nil, fmt.Errorf("the Module Definition %s is not given with --module-def and can't be read from the cluster: %v", defName, err)
+		}
+		def, err = client.Resource(moduleDefinitionResource).Get(context.TODO(), defName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		defs[defName] = def
+	}
+
+	inputSchema, found, err := unstructured.NestedFieldNoCopy(def.Object, "spec", "schema", "properties", "input")
+	if err != nil || !found {
+		return nil, fmt.Errorf("the Module Definition %s has no spec.schema.properties.input", defName)
+	}
+	var schema map[string]interface{}
+	if err := normalizeJSON(inputSchema, &schema); err != nil {
+		return nil, err
+	}
+
+	var input interface{} = map[string]interface{}{}
+	if in, found, _ := unstructured.NestedFieldNoCopy(m.Object, "spec", "resource", "input"); found {
+		if err := normalizeJSON(in, &input); err != nil {
+			return nil, err
+		}
+	}
+
+	path := field.NewPath("spec", "resource", "input")
+	for _, p := range validationRulePaths(path, schema) {
+		klog.Warningf("the validation rules of %s are only checked by the API server", p)
+	}
+
+	return validateInput(path, input, schema)
+}
+
+// validateInput validates the input the way the API server does. The fields unknown to the schema
+// are reported too, as the API server silently drops them. The validation rules are left to the
+// API server, see validationRulePaths.
+func validateInput(path *field.Path, input interface{}, schema map[string]interface{}) (field.ErrorList, error) {
+	var props v1.JSONSchemaProps
+	if err := normalizeJSON(schema, &props); err != nil {
+		return nil, err
+	}
+	var internal apiextensions.JSONSchemaProps
+	if err := v1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(&props, &internal, nil); err != nil {
+		return nil, err
+	}
+
+	validator, _, err := validation.NewSchemaValidator(&apiextensions.CustomResourceValidation{OpenAPIV3Schema: &internal})
+	if err != nil {
+		return nil, err
+	}
+	errs := validation.ValidateCustomResource(path, input, validator)
+
+	structural, err := structuralschema.NewStructural(&internal)
+	if err != nil {
+		return nil, err
+	}
+	pruned := runtime.DeepCopyJSONValue(input)
+	pruning.Prune(pruned, structural, false)
+	errs = append(errs, prunedFields(path, input, pruned)...)
+	// the validator walks the properties in map order
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+
+	return errs, nil
+}
+
+// prunedFields reports the fields of the value missing in its pruned copy
+func prunedFields(path *field.Path, value, pruned interface{}) field.ErrorList {
+	var errs field.ErrorList
+	switch value := value.(type) {
+	case map[string]interface{}:
+		prunedObj, _ := pruned.(map[string]interface{})
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := prunedObj[k]; ok {
+				errs = append(errs, prunedFields(path.Child(k), value[k], p)...)
+			} else {
+				errs = append(errs, field.Forbidden(path.Child(k), "unknown field, it is not in the schema"))
+			}
+		}
+	case []interface{}:
+		prunedList, _ := pruned.([]interface{})
+		for i := range value {
+			if i < len(prunedList) {
+				errs = append(errs, prunedFields(path.Index(i), value[i], prunedList[i])...)
+			}
+		}
+	}
+	return errs
+}
+
+// validationRulePaths returns the paths of the schema having x-kubernetes-validations, the
+// elements of a list or a map are denoted by [*]
+func validationRulePaths(path *field.Path, schema map[string]interface{}) []string {
+	var paths []string
+	if _, ok := schema[ValidationsExtension]; ok {
+		paths = append(paths, path.String())
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if sub, ok := props[name].(map[string]interface{}); ok {
+			paths = append(paths, validationRulePaths(path.Child(name), sub)...)
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties"} {
+		if sub, ok := schema[key].(map[string]interface{}); ok {
+			paths = append(paths, validationRulePaths(path.Key("*"), sub)...)
+		}
+	}
+	return paths
+}
+
+// loadLocalObjects reads the objects of the files without contacting the cluster
+func loadLocalObjects(newBuilder func() *resource.Builder, filenames resource.FilenameOptions) ([]*unstructured.Unstructured, error) {
+	infos, err := newBuilder().
+		Local().
+		Unstructured().
+		FilenameParam(false, &filenames).
+		Flatten().
+		Do().
+		Infos()
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]*unstructured.Unstructured, 0, len(infos))
+	for _, info := range infos {
+		obj, ok := info.Object.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object %T in %s", info.Object, info.Source)
+		}
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func TestValidateInput(t *testing.T) {
+	const schema = `
+type: object
+required: [name]
+properties:
+  name: {type: string, maxLength: 5}
+  size: {type: number, minimum: 1, exclusiveMinimum: true}
+  zone: {type: string, enum: [a, b]}
+  tags: {type: object, maxProperties: 1, additionalProperties: {type: string}}
+  subnets:
+    type: array
+    items:
+      type: object
+      properties:
+        cidr: {type: string}
+`
+
+	cases := []struct {
+		name   string
+		input  string
+		errors []string
+	}{
+		{
+			name:  "valid",
+			input: `{name: vpc, size: 2, zone: a, tags: {env: dev}, subnets: [{cidr: 10.0.0.0/24}]}`,
+		},
+		{
+			name:   "missing required",
+			input:  `{}`,
+			errors: []string{"spec.resource.input.name: Required value"},
+		},
+		{
+			name:  "constraints",
+			input: `{name: network, size: 1, zone: c, tags: {a: x, b: y}}`,
+			errors: []string{
+				`spec.resource.input.name: Invalid value: "network": name in body should be at most 5 chars long`,
+				`spec.resource.input.size: Invalid value: 1: size in body should be greater than 1`,
+				`spec.resource.input.tags: Invalid value: 1: tags in body should have at most 1 properties`,
+				`spec.resource.input.zone: Unsupported value: "c": supported values: "a", "b"`,
+			},
+		},
+		{
+			name:   "wrong type",
+			input:  `{name: 1}`,
+			errors: []string{`spec.resource.input.name: Invalid value: "number": name in body must be of type string: "number"`},
+		},
+		{
+			name:  "unknown fields",
+			input: `{name: vpc, region: x, subnets: [{cidr: 10.0.0.0/24, az: a}]}`,
+			errors: []string{
+				"spec.resource.input.region: Forbidden: unknown field, it is not in the schema",
+				"spec.resource.input.subnets[0].az: Forbidden: unknown field, it is not in the schema",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var s map[string]interface{}
+			if err := yaml.Unmarshal([]byte(schema), &s); err != nil {
+				t.Fatal(err)
+			}
+			var input interface{}
+			if err := yaml.Unmarshal([]byte(c.input), &input); err != nil {
+				t.Fatal(err)
+			}
+
+			errs, err := validateInput(field.NewPath("spec", "resource", "input"), input, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			if !reflect.DeepEqual(got, c.errors) {
+				t.Errorf("expected errors\n%q\ngot\n%q", c.errors, got)
+			}
+		})
+	}
+}
+
+func TestValidationRulePaths(t *testing.T) {
+	var schema map[string]interface{}
+	err := yaml.Unmarshal([]byte(`
+type: object
+properties:
+  name: {type: string, x-kubernetes-validations: [{rule: "self != ''"}]}
+  subnets:
+    type: array
+    items: {type: string, x-kubernetes-validations: [{rule: "self != ''"}]}
+  zone: {type: string}
+`), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := validationRulePaths(field.NewPath("input"), schema)
+	want := []string{"input.name", "input.subnets[*]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestValidateRun(t *testing.T) {
+	const moduleDef = `apiVersion: tf.kubeform.com/v1alpha1
+kind: ModuleDefinition
+metadata:
+  name: vpc
+spec:
+  schema:
+    type: object
+    properties:
+      input:
+        type: object
+        required: [name]
+        properties:
+          name: {type: string}
+`
+	const modules = `apiVersion: tf.kubeform.com/v1alpha1
+kind: Module
+metadata:
+  name: prod
+  namespace: infra
+spec:
+  moduleDef: vpc
+  resource:
+    input:
+      name: prod
+---
+apiVersion: tf.kubeform.com/v1alpha1
+kind: Module
+metadata:
+  name: dev
+spec:
+  moduleDef: vpc
+  resource:
+    input:
+      name: 1
+`
+
+	dir := t.TempDir()
+	defFile := filepath.Join(dir, "moduledef.yaml")
+	moduleFile := filepath.Join(dir, "modules.yaml")
+	if err := os.WriteFile(defFile, []byte(moduleDef), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(moduleFile, []byte(modules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	o := &ValidateOptions{
+		FilenameOptions: resource.FilenameOptions{Filenames: []string{moduleFile}},
+		ModuleDefs:      []string{defFile},
+		NewBuilder:      resource.NewLocalBuilder,
+		IOStreams:       genericclioptions.IOStreams{Out: &out, ErrOut: &out},
+	}
+	err := o.Run()
+	if want := "1 of 2 Modules are invalid"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+
+	want := `module infra/prod is valid
+module dev is invalid:
+  spec.resource.input.name: Invalid value: "number": name in body must be of type string: "number"
+`
+	if out.String() != want {
+		t.Errorf("expected output\n%s\ngot\n%s", want, out.String())
+	}
+}
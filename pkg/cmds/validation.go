@@ -0,0 +1,438 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/klog/v2"
+)
+
+// ValidationsExtension holds the CEL rules generated from the terraform validation blocks
+// that can't be expressed with the json schema constraints
+const ValidationsExtension = "x-kubernetes-validations"
+
+const defaultValidationMessage = "Invalid value for variable"
+
+// variableValidation is a `validation` block of a terraform variable
+type variableValidation struct {
+	Condition    hclsyntax.Expression
+	ErrorMessage string
+}
+
+// validationRule is an item of x-kubernetes-validations
+type validationRule struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	variableBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type:       "variable",
+				LabelNames: []string{"name"},
+			},
+		},
+	}
+	validationBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type: "validation",
+			},
+		},
+	}
+	validationSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name:     "condition",
+				Required: true,
+			},
+			{
+				Name: "error_message",
+			},
+		},
+	}
+)
+
+// loadVariableValidations returns the validation blocks of the variables keyed by the variable name.
+// The validation blocks of a variable in an override file replace the original ones. A condition
+// that can't be parsed is an error, unless skipUntranslatable is set, then that block is left out.
+func loadVariableValidations(files []*hcl.File, skipUntranslatable bool) (map[string][]variableValidation, error) {
+	validations := map[string][]variableValidation{}
+
+	for _, file := range files {
+		content, _, diags := file.Body.PartialContent(variableBlockSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, block := range content.Blocks {
+			name := block.Labels[0]
+
+			varContent, _, diags := block.Body.PartialContent(validationBlockSchema)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			var blockValidations []variableValidation
+			for _, validationBlock := range varContent.Blocks {
+				attrs, diags := validationBlock.Body.Content(validationSchema)
+				if diags.HasErrors() {
+					return nil, diags
+				}
+
+				condExpr := attrs.Attributes["condition"].Expr
+				condition, ok := syntaxExpr(file, condExpr)
+				if !ok {
+					if !skipUntranslatable {
+						return nil, fmt.Errorf("%s: validation condition of variable %s can't be parsed, use --skip-untranslatable-validations to generate without it", condExpr.Range(), name)
+					}
+					klog.Warningf("%s: skipping the validation of variable %s, its condition can't be parsed", condExpr.Range(), name)
+					continue
+				}
+
+				message := defaultValidationMessage
+				if attr, found := attrs.Attributes["error_message"]; found {
+					val, diags := attr.Expr.Value(nil)
+					if !diags.HasErrors() && val.Type() == cty.String && !val.IsNull() {
+						message = val.AsString()
+					}
+				}
+
+				blockValidations = append(blockValidations, variableValidation{
+					Condition:    condition,
+					ErrorMessage: message,
+				})
+			}
+
+			if len(blockValidations) > 0 {
+				validations[name] = blockValidations
+			}
+		}
+	}
+
+	return validations, nil
+}
+
+// applyValidations maps the conditions of the validation blocks of a variable onto the schema
+// constraints of its property. The conditions are split on `&&`, the parts that match one of the
+// well known patterns below are turned into schema constraints and the rest is translated into a
+// CEL rule with the error message of the validation block. A part that can't be translated is an
+// error, unless skipUntranslatable is set, then only that part is left out.
+//
+//	contains([...], var.x)           enum
+//	can(regex("...", var.x))         pattern
+//	length(var.x) <op> n             minLength/maxLength, minItems/maxItems, minProperties/maxProperties
+//	var.x <op> n                     minimum/maximum
+//	var.x == null || <cond>          <cond>, for nullable variables
+func applyValidations(name string, prop *v1.JSONSchemaProps, validations []variableValidation, extensions schemaExtensions, skipUntranslatable bool) error {
+	var rules []validationRule
+
+	for _, validation := range validations {
+		var rest []string
+
+		for _, cond := range splitConjunction(validation.Condition) {
+			if applySchemaConstraint(name, prop, cond) {
+				continue
+			}
+
+			rule, err := celExpr(cond, name, nil)
+			if err != nil {
+				if !skipUntranslatable {
+					return fmt.Errorf("%s: validation of variable %s can't be translated into a schema constraint or CEL rule: %v, use --skip-untranslatable-validations to generate without it", cond.Range(), name, err)
+				}
+				klog.Warningf("%s: skipping the part of the validation of variable %s that can't be translated: %v", cond.Range(), name, err)
+				continue
+			}
+			rest = append(rest, rule)
+		}
+
+		if len(rest) > 0 {
+			rules = append(rules, validationRule{
+				Rule:    strings.Join(rest, " && "),
+				Message: validation.ErrorMessage,
+			})
+		}
+	}
+
+	if len(rules) > 0 {
+		extensions.set(name, ValidationsExtension, rules)
+	}
+	return nil
+}
+
+func splitConjunction(expr hclsyntax.Expression) []hclsyntax.Expression {
+	if bin, ok := expr.(*hclsyntax.BinaryOpExpr); ok && bin.Op == hclsyntax.OpLogicalAnd {
+		return append(splitConjunction(bin.LHS), splitConjunction(bin.RHS)...)
+	}
+
+	return []hclsyntax.Expression{expr}
+}
+
+func applySchemaConstraint(name string, prop *v1.JSONSchemaProps, expr hclsyntax.Expression) bool {
+	switch e := expr.(type) {
+	case *hclsyntax.FunctionCallExpr:
+		switch {
+		case e.Name == "contains" && len(e.Args) == 2 && isVarRef(e.Args[1], name):
+			return applyEnum(prop, e.Args[0])
+		case e.Name == "can" && len(e.Args) == 1:
+			re, ok := e.Args[0].(*hclsyntax.FunctionCallExpr)
+			if !ok || re.Name != "regex" || len(re.Args) != 2 || !isVarRef(re.Args[1], name) {
+				return false
+			}
+			return applyPattern(prop, re.Args[0])
+		}
+	case *hclsyntax.BinaryOpExpr:
+		if e.Op == hclsyntax.OpLogicalOr {
+			// the json schema constraints are not evaluated for null values
+			switch {
+			case prop.Nullable && isNullCheck(e.LHS, name):
+				return applySchemaConstraint(name, prop, e.RHS)
+			case prop.Nullable && isNullCheck(e.RHS, name):
+				return applySchemaConstraint(name, prop, e.LHS)
+			}
+			return false
+		}
+
+		op, lhs, rhs := e.Op, e.LHS, e.RHS
+		bound, ok := constNumber(rhs)
+		if !ok {
+			// n <op> var.x
+			if bound, ok = constNumber(lhs); !ok {
+				return false
+			}
+			op, lhs = flipComparison(op), rhs
+			if op == nil {
+				return false
+			}
+		}
+
+		if isVarRef(lhs, name) {
+			return applyRange(prop, op, bound)
+		}
+
+		if call, ok := lhs.(*hclsyntax.FunctionCallExpr); ok && call.Name == "length" && len(call.Args) == 1 && isVarRef(call.Args[0], name) {
+			return applyLength(prop, op, bound)
+		}
+	}
+
+	return false
+}
+
+func applyEnum(prop *v1.JSONSchemaProps, expr hclsyntax.Expression) bool {
+	if prop.Enum != nil {
+		return false
+	}
+
+	val, ok := constValue(expr)
+	if !ok || !(val.Type().IsTupleType() || val.Type().IsListType() || val.Type().IsSetType()) {
+		return false
+	}
+
+	var enum []v1.JSON
+	for it := val.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		item, err := defaultJSON(prop, ctyToInterface(elem))
+		if err != nil {
+			return false
+		}
+		enum = append(enum, *item)
+	}
+
+	prop.Enum = enum
+	return true
+}
+
+func applyPattern(prop *v1.JSONSchemaProps, expr hclsyntax.Expression) bool {
+	if prop.Type != String || prop.Pattern != "" {
+		return false
+	}
+
+	val, ok := constValue(expr)
+	if !ok || val.Type() != cty.String {
+		return false
+	}
+
+	prop.Pattern = val.AsString()
+	return true
+}
+
+func applyRange(prop *v1.JSONSchemaProps, op *hclsyntax.Operation, bound float64) bool {
+	if prop.Type != Number {
+		return false
+	}
+
+	switch op {
+	case hclsyntax.OpGreaterThan, hclsyntax.OpGreaterThanOrEqual:
+		if prop.Minimum != nil {
+			return false
+		}
+		prop.Minimum = &bound
+		prop.ExclusiveMinimum = op == hclsyntax.OpGreaterThan
+	case hclsyntax.OpLessThan, hclsyntax.OpLessThanOrEqual:
+		if prop.Maximum != nil {
+			return false
+		}
+		prop.Maximum = &bound
+		prop.ExclusiveMaximum = op == hclsyntax.OpLessThan
+	case hclsyntax.OpEqual:
+		if prop.Minimum != nil || prop.Maximum != nil {
+			return false
+		}
+		prop.Minimum, prop.Maximum = &bound, &bound
+	default:
+		return false
+	}
+
+	return true
+}
+
+func applyLength(prop *v1.JSONSchemaProps, op *hclsyntax.Operation, bound float64) bool {
+	if bound != math.Trunc(bound) {
+		return false
+	}
+
+	var minField, maxField **int64
+	switch prop.Type {
+	case String:
+		minField, maxField = &prop.MinLength, &prop.MaxLength
+	case "array":
+		minField, maxField = &prop.MinItems, &prop.MaxItems
+	case "object":
+		minField, maxField = &prop.MinProperties, &prop.MaxProperties
+	default:
+		return false
+	}
+
+	n := int64(bound)
+	switch op {
+	case hclsyntax.OpGreaterThan:
+		n++
+		fallthrough
+	case hclsyntax.OpGreaterThanOrEqual:
+		if *minField != nil {
+			return false
+		}
+		*minField = &n
+	case hclsyntax.OpLessThan:
+		n--
+		fallthrough
+	case hclsyntax.OpLessThanOrEqual:
+		if *maxField != nil || n < 0 {
+			return false
+		}
+		*maxField = &n
+	case hclsyntax.OpEqual:
+		if *minField != nil || *maxField != nil {
+			return false
+		}
+		*minField, *maxField = &n, &n
+	default:
+		return false
+	}
+
+	return true
+}
+
+func flipComparison(op *hclsyntax.Operation) *hclsyntax.Operation {
+	switch op {
+	case hclsyntax.OpGreaterThan:
+		return hclsyntax.OpLessThan
+	case hclsyntax.OpGreaterThanOrEqual:
+		return hclsyntax.OpLessThanOrEqual
+	case hclsyntax.OpLessThan:
+		return hclsyntax.OpGreaterThan
+	case hclsyntax.OpLessThanOrEqual:
+		return hclsyntax.OpGreaterThanOrEqual
+	case hclsyntax.OpEqual:
+		return hclsyntax.OpEqual
+	}
+
+	return nil
+}
+
+// isVarRef checks whether the expression is exactly `var.<name>`
+func isVarRef(expr hclsyntax.Expression, name string) bool {
+	trav, ok := expr.(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(trav.Traversal) != 2 || trav.Traversal.RootName() != "var" {
+		return false
+	}
+
+	attr, ok := trav.Traversal[1].(hcl.TraverseAttr)
+	return ok && attr.Name == name
+}
+
+func isNullCheck(expr hclsyntax.Expression, name string) bool {
+	bin, ok := expr.(*hclsyntax.BinaryOpExpr)
+	if !ok || bin.Op != hclsyntax.OpEqual {
+		return false
+	}
+
+	isNull := func(e hclsyntax.Expression) bool {
+		val, ok := constValue(e)
+		return ok && val.IsNull()
+	}
+
+	return (isVarRef(bin.LHS, name) && isNull(bin.RHS)) || (isNull(bin.LHS) && isVarRef(bin.RHS, name))
+}
+
+// constValue evaluates the expression if it doesn't refer to anything
+func constValue(expr hclsyntax.Expression) (cty.Value, bool) {
+	if len(expr.Variables()) > 0 {
+		return cty.NilVal, false
+	}
+
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || !val.IsWhollyKnown() {
+		return cty.NilVal, false
+	}
+
+	return val, true
+}
+
+func constNumber(expr hclsyntax.Expression) (float64, bool) {
+	val, ok := constValue(expr)
+	if !ok || val.Type() != cty.Number || val.IsNull() {
+		return 0, false
+	}
+
+	f, _ := val.AsBigFloat().Float64()
+	return f, true
+}
+
+func ctyToInterface(val cty.Value) interface{} {
+	raw, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil
+	}
+
+	return out
+}
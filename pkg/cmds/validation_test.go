@@ -0,0 +1,277 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestApplyValidations(t *testing.T) {
+	cases := []struct {
+		name       string
+		typ        string
+		nullable   bool
+		conditions []string
+		skip       bool
+		schema     string
+		err        bool
+	}{
+		{
+			name:       "enum",
+			typ:        "string",
+			conditions: []string{`contains(["gp2", "gp3"], var.x)`},
+			schema: `
+type: string
+enum: [gp2, gp3]`,
+		},
+		{
+			name:       "enum of numbers converted to the variable type",
+			typ:        "string",
+			conditions: []string{`contains([1, 2], var.x)`},
+			schema: `
+type: string
+enum: ["1", "2"]`,
+		},
+		{
+			name:       "pattern",
+			typ:        "string",
+			conditions: []string{`can(regex("^[a-z]+$", var.x))`},
+			schema: `
+type: string
+pattern: ^[a-z]+$`,
+		},
+		{
+			name:       "string length range",
+			typ:        "string",
+			conditions: []string{`length(var.x) >= 3 && length(var.x) <= 10`},
+			schema: `
+type: string
+minLength: 3
+maxLength: 10`,
+		},
+		{
+			name:       "exclusive bounds",
+			typ:        "number",
+			conditions: []string{`var.x > 0 && 100 > var.x`},
+			schema: `
+type: number
+minimum: 0
+exclusiveMinimum: true
+maximum: 100
+exclusiveMaximum: true`,
+		},
+		{
+			name:       "list length",
+			typ:        "list(string)",
+			conditions: []string{`length(var.x) > 0`},
+			schema: `
+type: array
+items:
+  type: string
+minItems: 1`,
+		},
+		{
+			name:       "map length",
+			typ:        "map(string)",
+			conditions: []string{`length(var.x) < 5`},
+			schema: `
+type: object
+additionalProperties:
+  type: string
+maxProperties: 4`,
+		},
+		{
+			name:       "null check of a nullable variable",
+			typ:        "string",
+			nullable:   true,
+			conditions: []string{`var.x == null || contains(["a"], var.x)`},
+			schema: `
+type: string
+nullable: true
+enum: [a]`,
+		},
+		{
+			name:       "cel rule",
+			typ:        "string",
+			conditions: []string{`startswith(var.x, "ami-") && length(var.x) > 4`},
+			schema: `
+type: string
+minLength: 5
+x-kubernetes-validations:
+- rule: self.startsWith("ami-")
+  message: invalid value`,
+		},
+		{
+			name:       "cel quantifier",
+			typ:        "list(number)",
+			conditions: []string{`alltrue([for v in var.x : v > 0])`},
+			schema: `
+type: array
+items:
+  type: number
+x-kubernetes-validations:
+- rule: self.all(v, (v > 0.0))
+  message: invalid value`,
+		},
+		{
+			name:       "cel numbers",
+			typ:        "list(number)",
+			conditions: []string{`var.x[0] % 2 == 0 || length(var.x) > 1.5`},
+			schema: `
+type: array
+items:
+  type: number
+x-kubernetes-validations:
+- rule: ((double(int(self[0]) % int(2.0)) == 0.0) || (double(size(self)) > 1.5))
+  message: invalid value`,
+		},
+		{
+			name:       "untranslatable part",
+			typ:        "string",
+			conditions: []string{`length(var.x) > 0 && cidrhost(var.x, 1) != ""`},
+			err:        true,
+		},
+		{
+			name:       "untranslatable part skipped",
+			typ:        "string",
+			conditions: []string{`length(var.x) > 0 && cidrhost(var.x, 1) != "" && endswith(var.x, "/16")`},
+			skip:       true,
+			schema: `
+type: string
+minLength: 1
+x-kubernetes-validations:
+- rule: self.endsWith("/16")
+  message: invalid value`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prop, err := parseTypeExpr(c.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prop.Nullable = c.nullable
+
+			var validations []variableValidation
+			for _, cond := range c.conditions {
+				expr, diags := hclsyntax.ParseExpression([]byte(cond), "main.tf", hcl.Pos{Line: 1, Column: 1})
+				if diags.HasErrors() {
+					t.Fatal(diags)
+				}
+				validations = append(validations, variableValidation{
+					Condition:    expr,
+					ErrorMessage: "invalid value",
+				})
+			}
+
+			extensions := schemaExtensions{}
+			err = applyValidations("x", prop, validations, extensions, c.skip)
+			if c.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// compare the json form, as the schema and its extensions are written out
+			data, err := json.Marshal(prop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range extensions["x"] {
+				data, err := json.Marshal(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ext interface{}
+				if err := json.Unmarshal(data, &ext); err != nil {
+					t.Fatal(err)
+				}
+				got[k] = ext
+			}
+
+			var want map[string]interface{}
+			if err := yaml.Unmarshal([]byte(c.schema), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				out, _ := yaml.Marshal(got)
+				t.Errorf("unexpected schema, got\n%s", out)
+			}
+		})
+	}
+}
+
+func TestLoadVariableValidations(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"main.tf": `
+variable "size" {
+  type = number
+
+  validation {
+    condition     = var.size > 0
+    error_message = "Size must be positive."
+  }
+}
+`,
+		"vars.tf.json": `{
+  "variable": {
+    "tier": {
+      "type": "string",
+      "validation": {
+        "condition": "${var.tier ==}",
+        "error_message": "Unknown tier."
+      }
+    }
+  }
+}`,
+	})
+
+	files, err := parseModuleFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadVariableValidations(files, false); err == nil {
+		t.Fatal("expected an error for the condition that can't be parsed")
+	}
+
+	validations, err := loadVariableValidations(files, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validations["size"]) != 1 {
+		t.Errorf("expected the validation of size, got %v", validations["size"])
+	}
+	if _, found := validations["tier"]; found {
+		t.Errorf("expected the validation of tier to be left out")
+	}
+}